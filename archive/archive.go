@@ -0,0 +1,207 @@
+// Package archive reads and writes broker details as a portable file of JSON
+// lines: a header naming the format and the store the details came from, one
+// line per instance and binding, and a trailer counting the details and
+// holding a checksum of every line before it.
+package archive
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"time"
+
+	"code.cloudfoundry.org/service-broker-store/brokerstore"
+	"github.com/pivotal-cf/brokerapi"
+)
+
+const (
+	// Format names the archive format in every header.
+	Format = "migrate_mysql_to_credhub-archive"
+
+	// Version is the version of the archive format written by this package,
+	// and the latest version it reads.
+	Version = 1
+)
+
+const (
+	headerLine   = "header"
+	instanceLine = "instance"
+	bindingLine  = "binding"
+	trailerLine  = "trailer"
+)
+
+// Header describes where the details of an archive came from.
+type Header struct {
+	Format    string    `json:"format"`
+	Version   int       `json:"version"`
+	Source    string    `json:"source"`
+	StoreID   string    `json:"store_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Trailer counts the details of an archive. The checksum is the SHA-256 of
+// every line before the trailer, including their newlines.
+type Trailer struct {
+	Instances int    `json:"instances"`
+	Bindings  int    `json:"bindings"`
+	Checksum  string `json:"checksum"`
+}
+
+type line struct {
+	Type string `json:"type"`
+	*Header
+	ID      string          `json:"id,omitempty"`
+	Details json.RawMessage `json:"details,omitempty"`
+	*Trailer
+}
+
+// ErrTruncated is returned when an archive ends before its trailer.
+var ErrTruncated = errors.New("the archive ends before its trailer")
+
+// ErrChecksumMismatch is returned when the lines of an archive do not match
+// the checksum in its trailer.
+var ErrChecksumMismatch = errors.New("the archive does not match its checksum")
+
+// Writer writes an archive line by line, so that details can be written as
+// they are read from a store.
+type Writer struct {
+	w       io.Writer
+	hash    hash.Hash
+	trailer Trailer
+}
+
+// NewWriter writes the header of an archive to w. The format and version
+// of the header are filled in.
+func NewWriter(w io.Writer, header Header) (*Writer, error) {
+	header.Format = Format
+	header.Version = Version
+
+	writer := &Writer{w: w, hash: sha256.New()}
+	err := writer.writeLine(line{Type: headerLine, Header: &header})
+	if err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+func (w *Writer) WriteInstance(id string, details brokerstore.ServiceInstance) error {
+	b, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+
+	w.trailer.Instances++
+	return w.writeLine(line{Type: instanceLine, ID: id, Details: b})
+}
+
+func (w *Writer) WriteBinding(id string, details brokerapi.BindDetails) error {
+	b, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+
+	w.trailer.Bindings++
+	return w.writeLine(line{Type: bindingLine, ID: id, Details: b})
+}
+
+// Close writes the trailer of the archive. It does not close the underlying
+// writer.
+func (w *Writer) Close() error {
+	trailer := w.trailer
+	trailer.Checksum = "sha256:" + hex.EncodeToString(w.hash.Sum(nil))
+	return w.writeLine(line{Type: trailerLine, Trailer: &trailer})
+}
+
+func (w *Writer) writeLine(l line) error {
+	b, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+
+	w.hash.Write(b)
+	_, err = w.w.Write(b)
+	return err
+}
+
+// Contents are the details read from an archive.
+type Contents struct {
+	Header    Header
+	Instances map[string]brokerstore.ServiceInstance
+	Bindings  map[string]brokerapi.BindDetails
+}
+
+// Read reads a whole archive, and refuses one with an unknown format, one
+// that was cut short, or one that does not match its trailer.
+func Read(r io.Reader) (Contents, error) {
+	contents := Contents{
+		Instances: map[string]brokerstore.ServiceInstance{},
+		Bindings:  map[string]brokerapi.BindDetails{},
+	}
+
+	reader := bufio.NewReader(r)
+	hash := sha256.New()
+	for number := 1; ; number++ {
+		b, err := reader.ReadBytes('\n')
+		if err == io.EOF && len(b) == 0 {
+			if number == 1 {
+				return Contents{}, errors.New("the archive is empty")
+			}
+			return Contents{}, ErrTruncated
+		}
+		if err != nil && err != io.EOF {
+			return Contents{}, err
+		}
+
+		var l line
+		err = json.Unmarshal(b, &l)
+		if err != nil {
+			return Contents{}, fmt.Errorf("cannot parse line %d of the archive: %s", number, err)
+		}
+
+		if number == 1 {
+			if l.Type != headerLine || l.Header == nil || l.Header.Format != Format {
+				return Contents{}, fmt.Errorf("the file is not a %s", Format)
+			}
+			if l.Header.Version > Version {
+				return Contents{}, fmt.Errorf("the archive has version %d, but only versions up to %d can be read", l.Header.Version, Version)
+			}
+			contents.Header = *l.Header
+			hash.Write(b)
+			continue
+		}
+
+		switch l.Type {
+		case instanceLine:
+			var details brokerstore.ServiceInstance
+			err = json.Unmarshal(l.Details, &details)
+			contents.Instances[l.ID] = details
+		case bindingLine:
+			var details brokerapi.BindDetails
+			err = json.Unmarshal(l.Details, &details)
+			contents.Bindings[l.ID] = details
+		case trailerLine:
+			if l.Trailer == nil || l.Trailer.Checksum != "sha256:"+hex.EncodeToString(hash.Sum(nil)) {
+				return Contents{}, ErrChecksumMismatch
+			}
+			if l.Trailer.Instances != len(contents.Instances) || l.Trailer.Bindings != len(contents.Bindings) {
+				return Contents{}, fmt.Errorf("the archive holds %d instance(s) and %d binding(s), but its trailer counts %d and %d", len(contents.Instances), len(contents.Bindings), l.Trailer.Instances, l.Trailer.Bindings)
+			}
+			if _, err := reader.ReadByte(); err != io.EOF {
+				return Contents{}, errors.New("the archive continues after its trailer")
+			}
+			return contents, nil
+		default:
+			err = fmt.Errorf("unknown type %q", l.Type)
+		}
+		if err != nil {
+			return Contents{}, fmt.Errorf("cannot parse line %d of the archive: %s", number, err)
+		}
+		hash.Write(b)
+	}
+}
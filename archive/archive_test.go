@@ -0,0 +1,122 @@
+package archive_test
+
+import (
+	"bytes"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf/brokerapi"
+
+	"code.cloudfoundry.org/migrate_mysql_to_credhub/archive"
+	"code.cloudfoundry.org/service-broker-store/brokerstore"
+)
+
+var _ = Describe("Archive", func() {
+	var (
+		buffer    *bytes.Buffer
+		createdAt time.Time
+	)
+
+	BeforeEach(func() {
+		buffer = &bytes.Buffer{}
+		createdAt = time.Date(2019, 10, 1, 12, 0, 0, 0, time.UTC)
+
+		writer, err := archive.NewWriter(buffer, archive.Header{Source: "mysql://some-host:3306/some-db", StoreID: "some-store-id", CreatedAt: createdAt})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(writer.WriteInstance("123", brokerstore.ServiceInstance{ServiceID: "some-service", OrganizationGUID: "some-org"})).To(Succeed())
+		Expect(writer.WriteBinding("456", brokerapi.BindDetails{AppGUID: "some-app", RawParameters: []byte(`{"paramsHash":"some-hash"}`)})).To(Succeed())
+		Expect(writer.Close()).To(Succeed())
+	})
+
+	lines := func() []string {
+		return strings.SplitAfter(strings.TrimSuffix(buffer.String(), "\n"), "\n")
+	}
+
+	It("writes a header, a line per detail and a trailer", func() {
+		Expect(lines()).To(HaveLen(4))
+		Expect(lines()[0]).To(MatchJSON(`{"type":"header","format":"migrate_mysql_to_credhub-archive","version":1,"source":"mysql://some-host:3306/some-db","store_id":"some-store-id","created_at":"2019-10-01T12:00:00Z"}`))
+		Expect(lines()[1]).To(ContainSubstring(`"type":"instance","id":"123","details":{`))
+		Expect(lines()[2]).To(ContainSubstring(`"type":"binding","id":"456","details":{`))
+		Expect(lines()[3]).To(MatchRegexp(`^{"type":"trailer","instances":1,"bindings":1,"checksum":"sha256:[0-9a-f]{64}"}$`))
+	})
+
+	It("reads back what was written", func() {
+		contents, err := archive.Read(buffer)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(contents.Header).To(Equal(archive.Header{
+			Format:    archive.Format,
+			Version:   archive.Version,
+			Source:    "mysql://some-host:3306/some-db",
+			StoreID:   "some-store-id",
+			CreatedAt: createdAt,
+		}))
+		Expect(contents.Instances).To(Equal(map[string]brokerstore.ServiceInstance{
+			"123": brokerstore.ServiceInstance{ServiceID: "some-service", OrganizationGUID: "some-org"},
+		}))
+		Expect(contents.Bindings).To(HaveLen(1))
+		Expect(contents.Bindings["456"].AppGUID).To(Equal("some-app"))
+		Expect(contents.Bindings["456"].RawParameters).To(MatchJSON(`{"paramsHash":"some-hash"}`))
+	})
+
+	Context("when a detail was changed", func() {
+		It("refuses the archive", func() {
+			changed := strings.Replace(buffer.String(), "some-org", "other-org", 1)
+			_, err := archive.Read(strings.NewReader(changed))
+			Expect(err).To(Equal(archive.ErrChecksumMismatch))
+		})
+	})
+
+	Context("when the archive was cut short", func() {
+		It("refuses the archive", func() {
+			l := lines()
+			_, err := archive.Read(strings.NewReader(strings.Join(l[:3], "")))
+			Expect(err).To(Equal(archive.ErrTruncated))
+		})
+	})
+
+	Context("when the archive continues after its trailer", func() {
+		It("refuses the archive", func() {
+			_, err := archive.Read(strings.NewReader(buffer.String() + lines()[1]))
+			Expect(err).To(MatchError("the archive continues after its trailer"))
+		})
+	})
+
+	Context("when the final newline was removed", func() {
+		It("reads the archive", func() {
+			_, err := archive.Read(strings.NewReader(strings.TrimSuffix(buffer.String(), "\n")))
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Context("when the file is not an archive", func() {
+		It("refuses it", func() {
+			_, err := archive.Read(strings.NewReader(`{"kind":"instance","id":"123","checksum":"abc"}` + "\n"))
+			Expect(err).To(MatchError("the file is not a migrate_mysql_to_credhub-archive"))
+		})
+	})
+
+	Context("when the file is empty", func() {
+		It("refuses it", func() {
+			_, err := archive.Read(strings.NewReader(""))
+			Expect(err).To(MatchError("the archive is empty"))
+		})
+	})
+
+	Context("when the archive has a later version", func() {
+		It("refuses it", func() {
+			later := strings.Replace(buffer.String(), `"version":1`, `"version":2`, 1)
+			_, err := archive.Read(strings.NewReader(later))
+			Expect(err).To(MatchError("the archive has version 2, but only versions up to 1 can be read"))
+		})
+	})
+
+	Context("when a line cannot be parsed", func() {
+		It("names the line", func() {
+			l := lines()
+			_, err := archive.Read(strings.NewReader(l[0] + "not json\n" + l[3]))
+			Expect(err).To(MatchError(HavePrefix("cannot parse line 2 of the archive")))
+		})
+	})
+})
@@ -0,0 +1,295 @@
+package archive
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// EncryptedFormat names the format of an encrypted archive in its header.
+const EncryptedFormat = "migrate_mysql_to_credhub-encrypted-archive"
+
+const (
+	encryptionVersion = 1
+	cipherName        = "AES-256-GCM"
+	keySize           = 32
+	noncePrefixSize   = 7
+	chunkSize         = 64 * 1024
+
+	scryptN      = 1 << 15
+	scryptR      = 8
+	scryptP      = 1
+	maxScryptN   = 1 << 20
+	scryptSaltSz = 16
+)
+
+// ErrTampered is returned when an encrypted archive cannot be authenticated,
+// either because it was changed or cut short, or because the key or
+// passphrase is not the one it was encrypted with.
+var ErrTampered = errors.New("the archive was changed or the key is wrong")
+
+// Secret encrypts an archive, with a 256-bit Key or else with a key derived
+// from Passphrase by scrypt. An empty Secret leaves the archive unencrypted.
+type Secret struct {
+	Key        []byte
+	Passphrase []byte
+}
+
+func (s Secret) empty() bool {
+	return len(s.Key) == 0 && len(s.Passphrase) == 0
+}
+
+// ReadKeyFile reads a 256-bit key held in a file as 32 bytes or as 64
+// hexadecimal digits.
+func ReadKeyFile(path string) ([]byte, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == keySize {
+		return b, nil
+	}
+
+	key, err := hex.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil || len(key) != keySize {
+		return nil, fmt.Errorf("the key file %s must hold %d bytes or %d hexadecimal digits", path, keySize, 2*keySize)
+	}
+	return key, nil
+}
+
+// encryptionHeader is the first line of an encrypted archive, in clear text
+// so that the key can be derived, and authenticated along with every chunk.
+type encryptionHeader struct {
+	Format    string `json:"format"`
+	Version   int    `json:"version"`
+	Cipher    string `json:"cipher"`
+	KDF       string `json:"kdf"`
+	Salt      []byte `json:"salt,omitempty"`
+	N         int    `json:"n,omitempty"`
+	R         int    `json:"r,omitempty"`
+	P         int    `json:"p,omitempty"`
+	Nonce     []byte `json:"nonce"`
+	ChunkSize int    `json:"chunk_size"`
+}
+
+func (h encryptionHeader) key(secret Secret) ([]byte, error) {
+	switch h.KDF {
+	case "none":
+		if len(secret.Key) != keySize {
+			return nil, errors.New("the archive is encrypted with a key rather than a passphrase")
+		}
+		return secret.Key, nil
+	case "scrypt":
+		if len(secret.Passphrase) == 0 {
+			return nil, errors.New("the archive is encrypted with a passphrase rather than a key")
+		}
+		if h.N <= 1 || h.N > maxScryptN || h.N&(h.N-1) != 0 {
+			return nil, fmt.Errorf("the archive has an unsupported scrypt cost of %d", h.N)
+		}
+		// the header is not authenticated until the key is derived, so r and
+		// p, which scrypt's memory and time grow with, must be as written
+		if h.R != scryptR || h.P != scryptP {
+			return nil, fmt.Errorf("the archive has unsupported scrypt parameters r=%d and p=%d", h.R, h.P)
+		}
+		if len(h.Salt) != scryptSaltSz {
+			return nil, fmt.Errorf("the archive has a scrypt salt of %d bytes rather than %d", len(h.Salt), scryptSaltSz)
+		}
+		return scrypt.Key(secret.Passphrase, h.Salt, h.N, h.R, h.P, keySize)
+	default:
+		return nil, fmt.Errorf("the archive has an unsupported key derivation %q", h.KDF)
+	}
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// chunks seals or opens the chunks of an encrypted archive. Each chunk has
+// its own nonce, made of the random prefix from the header, the number of
+// the chunk and whether it is the last, so that chunks cannot be reordered,
+// dropped or cut off without failing authentication.
+type chunks struct {
+	aead    cipher.AEAD
+	prefix  []byte
+	header  []byte
+	counter uint32
+}
+
+func (c *chunks) nonce(last bool) []byte {
+	nonce := make([]byte, c.aead.NonceSize())
+	copy(nonce, c.prefix)
+	binary.BigEndian.PutUint32(nonce[noncePrefixSize:], c.counter)
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+	c.counter++
+	return nonce
+}
+
+type encryptingWriter struct {
+	w      io.Writer
+	chunks *chunks
+	buffer []byte
+}
+
+// NewEncryptingWriter writes the header of an encrypted archive to w, and
+// returns a writer that encrypts what is written to it. Closing it writes the
+// last chunk, but does not close w.
+func NewEncryptingWriter(w io.Writer, secret Secret) (io.WriteCloser, error) {
+	header := encryptionHeader{
+		Format:    EncryptedFormat,
+		Version:   encryptionVersion,
+		Cipher:    cipherName,
+		KDF:       "none",
+		Nonce:     make([]byte, noncePrefixSize),
+		ChunkSize: chunkSize,
+	}
+	if len(secret.Key) == 0 {
+		header.KDF = "scrypt"
+		header.Salt = make([]byte, scryptSaltSz)
+		header.N, header.R, header.P = scryptN, scryptR, scryptP
+		if _, err := rand.Read(header.Salt); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := rand.Read(header.Nonce); err != nil {
+		return nil, err
+	}
+
+	key, err := header.key(secret)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+	b = append(b, '\n')
+	if _, err := w.Write(b); err != nil {
+		return nil, err
+	}
+
+	return &encryptingWriter{w: w, chunks: &chunks{aead: aead, prefix: header.Nonce, header: b}}, nil
+}
+
+func (w *encryptingWriter) Write(p []byte) (int, error) {
+	w.buffer = append(w.buffer, p...)
+	// a full chunk is only sealed once more follows, as the last chunk is
+	// sealed differently
+	for len(w.buffer) > chunkSize {
+		if err := w.seal(w.buffer[:chunkSize], false); err != nil {
+			return 0, err
+		}
+		w.buffer = w.buffer[chunkSize:]
+	}
+	return len(p), nil
+}
+
+func (w *encryptingWriter) Close() error {
+	return w.seal(w.buffer, true)
+}
+
+func (w *encryptingWriter) seal(plaintext []byte, last bool) error {
+	sealed := w.chunks.aead.Seal(nil, w.chunks.nonce(last), plaintext, w.chunks.header)
+	_, err := w.w.Write(sealed)
+	return err
+}
+
+type decryptingReader struct {
+	r      *bufio.Reader
+	chunks *chunks
+	size   int
+	buffer []byte
+	done   bool
+}
+
+// NewDecryptingReader reads the header of an encrypted archive from r, and
+// returns a reader of what was encrypted. Reading fails with ErrTampered as
+// soon as a chunk cannot be authenticated.
+func NewDecryptingReader(r io.Reader, secret Secret) (io.Reader, error) {
+	reader := bufio.NewReader(r)
+	b, err := reader.ReadBytes('\n')
+	if err != nil {
+		return nil, ErrTampered
+	}
+
+	var header encryptionHeader
+	if err := json.Unmarshal(b, &header); err != nil || header.Format != EncryptedFormat {
+		return nil, fmt.Errorf("the file is not a %s", EncryptedFormat)
+	}
+	if header.Version > encryptionVersion {
+		return nil, fmt.Errorf("the archive has encryption version %d, but only versions up to %d can be read", header.Version, encryptionVersion)
+	}
+	if header.Cipher != cipherName || len(header.Nonce) != noncePrefixSize || header.ChunkSize <= 0 || header.ChunkSize > 16*chunkSize {
+		return nil, fmt.Errorf("the archive has unsupported encryption parameters")
+	}
+
+	key, err := header.key(secret)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &decryptingReader{
+		r:      reader,
+		chunks: &chunks{aead: aead, prefix: header.Nonce, header: b},
+		size:   header.ChunkSize + aead.Overhead(),
+	}, nil
+}
+
+func (r *decryptingReader) Read(p []byte) (int, error) {
+	for len(r.buffer) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.buffer)
+	r.buffer = r.buffer[n:]
+	return n, nil
+}
+
+func (r *decryptingReader) open() error {
+	sealed := make([]byte, r.size)
+	n, err := io.ReadFull(r.r, sealed)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return err
+	}
+
+	_, err = r.r.Peek(1)
+	last := err == io.EOF
+
+	plaintext, err := r.chunks.aead.Open(nil, r.chunks.nonce(last), sealed[:n], r.chunks.header)
+	if err != nil {
+		return ErrTampered
+	}
+	r.buffer = plaintext
+	r.done = last
+	return nil
+}
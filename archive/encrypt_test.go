@@ -0,0 +1,250 @@
+package archive_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf/brokerapi"
+
+	"code.cloudfoundry.org/migrate_mysql_to_credhub/archive"
+	"code.cloudfoundry.org/service-broker-store/brokerstore"
+)
+
+var _ = Describe("Encryption", func() {
+	var (
+		key       []byte
+		plaintext []byte
+	)
+
+	BeforeEach(func() {
+		key = bytes.Repeat([]byte{7}, 32)
+		// long enough to span several chunks
+		plaintext = bytes.Repeat([]byte("some broker details\n"), 10000)
+	})
+
+	encrypt := func(secret archive.Secret, plaintext []byte) []byte {
+		buffer := &bytes.Buffer{}
+		writer, err := archive.NewEncryptingWriter(buffer, secret)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = writer.Write(plaintext)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(writer.Close()).To(Succeed())
+		return buffer.Bytes()
+	}
+
+	decrypt := func(secret archive.Secret, ciphertext []byte) ([]byte, error) {
+		reader, err := archive.NewDecryptingReader(bytes.NewReader(ciphertext), secret)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.ReadAll(reader)
+	}
+
+	It("decrypts what was encrypted with a key", func() {
+		ciphertext := encrypt(archive.Secret{Key: key}, plaintext)
+		Expect(ciphertext).NotTo(ContainSubstring("some broker details"))
+		Expect(string(ciphertext)).To(HavePrefix(`{"format":"migrate_mysql_to_credhub-encrypted-archive","version":1,"cipher":"AES-256-GCM","kdf":"none",`))
+
+		Expect(decrypt(archive.Secret{Key: key}, ciphertext)).To(Equal(plaintext))
+	})
+
+	It("decrypts what was encrypted with a passphrase", func() {
+		ciphertext := encrypt(archive.Secret{Passphrase: []byte("some-passphrase")}, []byte("some broker details\n"))
+		Expect(string(ciphertext)).To(ContainSubstring(`"kdf":"scrypt"`))
+
+		Expect(decrypt(archive.Secret{Passphrase: []byte("some-passphrase")}, ciphertext)).To(Equal([]byte("some broker details\n")))
+
+		_, err := decrypt(archive.Secret{Passphrase: []byte("other-passphrase")}, ciphertext)
+		Expect(err).To(Equal(archive.ErrTampered))
+
+		_, err = decrypt(archive.Secret{Key: key}, ciphertext)
+		Expect(err).To(MatchError("the archive is encrypted with a passphrase rather than a key"))
+	})
+
+	It("encrypts an empty archive", func() {
+		Expect(decrypt(archive.Secret{Key: key}, encrypt(archive.Secret{Key: key}, nil))).To(BeEmpty())
+	})
+
+	It("encrypts the same details differently each time", func() {
+		Expect(encrypt(archive.Secret{Key: key}, plaintext)).NotTo(Equal(encrypt(archive.Secret{Key: key}, plaintext)))
+	})
+
+	Context("when the key is wrong", func() {
+		It("refuses the archive", func() {
+			_, err := decrypt(archive.Secret{Key: bytes.Repeat([]byte{8}, 32)}, encrypt(archive.Secret{Key: key}, plaintext))
+			Expect(err).To(Equal(archive.ErrTampered))
+		})
+	})
+
+	Context("when a byte of the archive was changed", func() {
+		It("refuses the archive", func() {
+			ciphertext := encrypt(archive.Secret{Key: key}, plaintext)
+			ciphertext[len(ciphertext)/2] ^= 1
+
+			_, err := decrypt(archive.Secret{Key: key}, ciphertext)
+			Expect(err).To(Equal(archive.ErrTampered))
+		})
+	})
+
+	Context("when the header was changed", func() {
+		It("refuses the archive", func() {
+			ciphertext := encrypt(archive.Secret{Key: key}, plaintext)
+			changed := bytes.Replace(ciphertext, []byte(`"chunk_size":65536`), []byte(`"chunk_size":65537`), 1)
+
+			_, err := decrypt(archive.Secret{Key: key}, changed)
+			Expect(err).To(Equal(archive.ErrTampered))
+		})
+	})
+
+	Context("when the key derivation parameters were changed", func() {
+		var ciphertext []byte
+
+		changeHeader := func(change func(header map[string]interface{})) []byte {
+			headerLength := bytes.IndexByte(ciphertext, '\n')
+			header := map[string]interface{}{}
+			Expect(json.Unmarshal(ciphertext[:headerLength], &header)).To(Succeed())
+			change(header)
+			changed, err := json.Marshal(header)
+			Expect(err).NotTo(HaveOccurred())
+			return append(changed, ciphertext[headerLength:]...)
+		}
+
+		BeforeEach(func() {
+			ciphertext = encrypt(archive.Secret{Passphrase: []byte("some-passphrase")}, []byte("some broker details\n"))
+		})
+
+		It("refuses an oversized r before deriving the key", func() {
+			changed := changeHeader(func(header map[string]interface{}) {
+				header["r"] = 1 << 30
+			})
+
+			_, err := decrypt(archive.Secret{Passphrase: []byte("some-passphrase")}, changed)
+			Expect(err).To(MatchError("the archive has unsupported scrypt parameters r=1073741824 and p=1"))
+		})
+
+		It("refuses another p", func() {
+			changed := changeHeader(func(header map[string]interface{}) {
+				header["p"] = 64
+			})
+
+			_, err := decrypt(archive.Secret{Passphrase: []byte("some-passphrase")}, changed)
+			Expect(err).To(MatchError("the archive has unsupported scrypt parameters r=8 and p=64"))
+		})
+
+		It("refuses a salt of another length", func() {
+			changed := changeHeader(func(header map[string]interface{}) {
+				header["salt"] = []byte("short")
+			})
+
+			_, err := decrypt(archive.Secret{Passphrase: []byte("some-passphrase")}, changed)
+			Expect(err).To(MatchError("the archive has a scrypt salt of 5 bytes rather than 16"))
+		})
+	})
+
+	Context("when the archive was cut short between chunks", func() {
+		It("refuses the archive", func() {
+			ciphertext := encrypt(archive.Secret{Key: key}, plaintext)
+			headerLength := bytes.IndexByte(ciphertext, '\n') + 1
+
+			_, err := decrypt(archive.Secret{Key: key}, ciphertext[:headerLength+64*1024+16])
+			Expect(err).To(Equal(archive.ErrTampered))
+		})
+	})
+
+	Context("when the file is not encrypted", func() {
+		It("refuses it", func() {
+			_, err := decrypt(archive.Secret{Key: key}, []byte(`{"format":"migrate_mysql_to_credhub-archive"}`+"\n"))
+			Expect(err).To(MatchError("the file is not a migrate_mysql_to_credhub-encrypted-archive"))
+		})
+	})
+
+	Describe("#ReadKeyFile", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "key")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("reads a key of 32 bytes", func() {
+			path := filepath.Join(dir, "key")
+			Expect(ioutil.WriteFile(path, key, 0600)).To(Succeed())
+			Expect(archive.ReadKeyFile(path)).To(Equal(key))
+		})
+
+		It("reads a key of 64 hexadecimal digits", func() {
+			path := filepath.Join(dir, "key")
+			Expect(ioutil.WriteFile(path, []byte(strings.Repeat("07", 32)+"\n"), 0600)).To(Succeed())
+			Expect(archive.ReadKeyFile(path)).To(Equal(key))
+		})
+
+		It("refuses a key of another length", func() {
+			path := filepath.Join(dir, "key")
+			Expect(ioutil.WriteFile(path, []byte("abcd"), 0600)).To(Succeed())
+			_, err := archive.ReadKeyFile(path)
+			Expect(err).To(MatchError("the key file " + path + " must hold 32 bytes or 64 hexadecimal digits"))
+		})
+	})
+
+	Describe("opening an archive", func() {
+		var (
+			dir  string
+			path string
+		)
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "archive")
+			Expect(err).NotTo(HaveOccurred())
+			path = filepath.Join(dir, "broker.archive")
+
+			buffer := &bytes.Buffer{}
+			encrypted, err := archive.NewEncryptingWriter(buffer, archive.Secret{Key: key})
+			Expect(err).NotTo(HaveOccurred())
+			writer, err := archive.NewWriter(encrypted, archive.Header{Source: "some-source"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(writer.WriteInstance("123", brokerstore.ServiceInstance{ServiceID: "some-service"})).To(Succeed())
+			Expect(writer.WriteBinding("456", brokerapi.BindDetails{AppGUID: "some-app"})).To(Succeed())
+			Expect(writer.Close()).To(Succeed())
+			Expect(encrypted.Close()).To(Succeed())
+			Expect(ioutil.WriteFile(path, buffer.Bytes(), 0600)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("decrypts an encrypted archive", func() {
+			store, err := archive.Open(path, archive.Secret{Key: key})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(store.RetrieveInstanceDetails("123")).To(Equal(brokerstore.ServiceInstance{ServiceID: "some-service"}))
+		})
+
+		It("refuses an encrypted archive without a secret", func() {
+			_, err := archive.Open(path, archive.Secret{})
+			Expect(err).To(MatchError("the archive is encrypted, but no key or passphrase was given"))
+		})
+
+		It("refuses an archive that is not encrypted when given a secret", func() {
+			buffer := &bytes.Buffer{}
+			writer, err := archive.NewWriter(buffer, archive.Header{Source: "some-source"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(writer.Close()).To(Succeed())
+			Expect(ioutil.WriteFile(path, buffer.Bytes(), 0600)).To(Succeed())
+
+			_, err = archive.Open(path, archive.Secret{Key: key})
+			Expect(err).To(MatchError("the archive is not encrypted, but a key or passphrase was given"))
+		})
+	})
+})
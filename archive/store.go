@@ -0,0 +1,163 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"reflect"
+
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/service-broker-store/brokerstore"
+	"github.com/pivotal-cf/brokerapi"
+)
+
+// ErrReadOnly is returned when details are written to or deleted from an
+// archive Store.
+var ErrReadOnly = errors.New("an archive cannot be changed")
+
+// Store holds the details read from an archive, so that they can be
+// migrated into another store. It never counts as retired, and retiring it
+// does nothing, so that the archive can be imported again.
+type Store struct {
+	path     string
+	contents Contents
+}
+
+// Open reads the archive at path into a Store. An encrypted archive is
+// decrypted with secret, and an archive that is not encrypted is refused
+// when a secret is given, so that it cannot stand in for an encrypted one.
+func Open(path string, secret Secret) (*Store, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var r io.Reader = reader
+	switch {
+	case isEncrypted(reader) && secret.empty():
+		return nil, errors.New("the archive is encrypted, but no key or passphrase was given")
+	case isEncrypted(reader):
+		r, err = NewDecryptingReader(reader, secret)
+		if err != nil {
+			return nil, err
+		}
+	case !secret.empty():
+		return nil, errors.New("the archive is not encrypted, but a key or passphrase was given")
+	}
+
+	contents, err := Read(r)
+	if err != nil {
+		return nil, err
+	}
+	return NewStore(path, contents), nil
+}
+
+// isEncrypted reports whether the first line of an archive is the header of
+// an encrypted one, without consuming it.
+func isEncrypted(reader *bufio.Reader) bool {
+	b, _ := reader.Peek(reader.Size())
+	if i := bytes.IndexByte(b, '\n'); i >= 0 {
+		b = b[:i]
+	}
+
+	var header struct {
+		Format string `json:"format"`
+	}
+	return json.Unmarshal(b, &header) == nil && header.Format == EncryptedFormat
+}
+
+func NewStore(path string, contents Contents) *Store {
+	return &Store{path: path, contents: contents}
+}
+
+func (s *Store) String() string {
+	return "archive:" + s.path
+}
+
+// Header describes where the details of the archive came from.
+func (s *Store) Header() Header {
+	return s.contents.Header
+}
+
+func (s *Store) Retire() error {
+	return nil
+}
+
+func (s *Store) IsRetired() (bool, error) {
+	return false, nil
+}
+
+func (s *Store) RetrieveInstanceDetails(id string) (brokerstore.ServiceInstance, error) {
+	details, ok := s.contents.Instances[id]
+	if !ok {
+		return brokerstore.ServiceInstance{}, brokerapi.ErrInstanceDoesNotExist
+	}
+	return details, nil
+}
+
+func (s *Store) RetrieveBindingDetails(id string) (brokerapi.BindDetails, error) {
+	details, ok := s.contents.Bindings[id]
+	if !ok {
+		return brokerapi.BindDetails{}, brokerapi.ErrBindingDoesNotExist
+	}
+	return details, nil
+}
+
+func (s *Store) RetrieveAllInstanceDetails() (map[string]brokerstore.ServiceInstance, error) {
+	instances := map[string]brokerstore.ServiceInstance{}
+	for id, details := range s.contents.Instances {
+		instances[id] = details
+	}
+	return instances, nil
+}
+
+func (s *Store) RetrieveAllBindingDetails() (map[string]brokerapi.BindDetails, error) {
+	bindings := map[string]brokerapi.BindDetails{}
+	for id, details := range s.contents.Bindings {
+		bindings[id] = details
+	}
+	return bindings, nil
+}
+
+func (s *Store) CreateInstanceDetails(id string, details brokerstore.ServiceInstance) error {
+	return ErrReadOnly
+}
+
+func (s *Store) CreateBindingDetails(id string, details brokerapi.BindDetails) error {
+	return ErrReadOnly
+}
+
+func (s *Store) DeleteInstanceDetails(id string) error {
+	return ErrReadOnly
+}
+
+func (s *Store) DeleteBindingDetails(id string) error {
+	return ErrReadOnly
+}
+
+func (s *Store) IsInstanceConflict(id string, details brokerstore.ServiceInstance) bool {
+	existing, ok := s.contents.Instances[id]
+	return ok && !reflect.DeepEqual(existing, details)
+}
+
+func (s *Store) IsBindingConflict(id string, details brokerapi.BindDetails) bool {
+	existing, ok := s.contents.Bindings[id]
+	return ok && !reflect.DeepEqual(existing, details)
+}
+
+func (s *Store) Restore(logger lager.Logger) error {
+	return nil
+}
+
+func (s *Store) Save(logger lager.Logger) error {
+	return nil
+}
+
+func (s *Store) Cleanup() error {
+	return nil
+}
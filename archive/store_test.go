@@ -0,0 +1,92 @@
+package archive_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf/brokerapi"
+
+	"code.cloudfoundry.org/migrate_mysql_to_credhub/archive"
+	"code.cloudfoundry.org/service-broker-store/brokerstore"
+)
+
+var _ = Describe("Store", func() {
+	var (
+		dir   string
+		path  string
+		store *archive.Store
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "archive")
+		Expect(err).NotTo(HaveOccurred())
+		path = filepath.Join(dir, "broker.archive")
+
+		buffer := &bytes.Buffer{}
+		writer, err := archive.NewWriter(buffer, archive.Header{Source: "mysql://some-host:3306/some-db", StoreID: "some-store-id"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(writer.WriteInstance("123", brokerstore.ServiceInstance{ServiceID: "some-service"})).To(Succeed())
+		Expect(writer.WriteBinding("456", brokerapi.BindDetails{AppGUID: "some-app"})).To(Succeed())
+		Expect(writer.Close()).To(Succeed())
+		Expect(ioutil.WriteFile(path, buffer.Bytes(), 0600)).To(Succeed())
+
+		store, err = archive.Open(path, archive.Secret{})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("lists the details of the archive", func() {
+		instances, err := store.RetrieveAllInstanceDetails()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(instances).To(Equal(map[string]brokerstore.ServiceInstance{"123": brokerstore.ServiceInstance{ServiceID: "some-service"}}))
+
+		bindings, err := store.RetrieveAllBindingDetails()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bindings).To(Equal(map[string]brokerapi.BindDetails{"456": brokerapi.BindDetails{AppGUID: "some-app"}}))
+	})
+
+	It("retrieves a single detail", func() {
+		instance, err := store.RetrieveInstanceDetails("123")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(instance.ServiceID).To(Equal("some-service"))
+
+		_, err = store.RetrieveBindingDetails("789")
+		Expect(err).To(Equal(brokerapi.ErrBindingDoesNotExist))
+	})
+
+	It("describes where the details came from", func() {
+		Expect(store.Header().StoreID).To(Equal("some-store-id"))
+		Expect(store.String()).To(Equal("archive:" + path))
+	})
+
+	It("is never retired", func() {
+		Expect(store.Retire()).To(Succeed())
+		Expect(store.IsRetired()).To(BeFalse())
+	})
+
+	It("cannot be changed", func() {
+		Expect(store.CreateInstanceDetails("789", brokerstore.ServiceInstance{})).To(Equal(archive.ErrReadOnly))
+		Expect(store.DeleteBindingDetails("456")).To(Equal(archive.ErrReadOnly))
+	})
+
+	Context("when the archive was changed", func() {
+		BeforeEach(func() {
+			b, err := ioutil.ReadFile(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ioutil.WriteFile(path, bytes.Replace(b, []byte("some-app"), []byte("other-app"), 1), 0600)).To(Succeed())
+		})
+
+		It("refuses to open it", func() {
+			_, err := archive.Open(path, archive.Secret{})
+			Expect(err).To(Equal(archive.ErrChecksumMismatch))
+		})
+	})
+})
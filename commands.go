@@ -0,0 +1,443 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/migrate_mysql_to_credhub/archive"
+	"code.cloudfoundry.org/migrate_mysql_to_credhub/migrator"
+)
+
+type command struct {
+	name             string
+	shortDescription string
+	longDescription  string
+	data             interface{}
+}
+
+// commands share the connection options of opts. Only migrate and rollback
+// write to either store.
+var commands = []command{
+	{
+		name:             "migrate",
+		shortDescription: "Migrate broker state from SQL to CredHub",
+		longDescription:  "Copy every instance and binding from SQL to CredHub, verify them, activate CredHub and retire SQL. Any two stores can be migrated between with --from and --to.",
+		data:             &migrateCommand{},
+	},
+	{
+		name:             "rollback",
+		shortDescription: "Migrate broker state from CredHub back to SQL",
+		longDescription:  "Copy every instance and binding from CredHub back to SQL, verify them, make SQL authoritative again and deactivate CredHub. A migration between the stores given by --from and --to is rolled back in the same way.",
+		data:             &rollbackCommand{},
+	},
+	{
+		name:             "plan",
+		shortDescription: "Report what a migration would write",
+		longDescription:  "Report the locations a migration would write and the details it would conflict with, without writing to either store.",
+		data:             &planCommand{},
+	},
+	{
+		name:             "verify",
+		shortDescription: "Compare the details held by both stores",
+		longDescription:  "Compare the details held by both stores, including any the target holds that the source does not, without writing to either store.",
+		data:             &verifyCommand{},
+	},
+	{
+		name:             "export",
+		shortDescription: "Write broker state from SQL to an archive",
+		longDescription:  "Write every instance and binding held in SQL to an archive file with a header naming their source and a checksum, without changing SQL. The archive is encrypted when given a key or passphrase file.",
+		data:             &exportCommand{},
+	},
+	{
+		name:             "import",
+		shortDescription: "Migrate broker state from an archive to CredHub or SQL",
+		longDescription:  "Copy every instance and binding from an archive written by export to CredHub or SQL, and verify them. Importing into CredHub activates it.",
+		data:             &importCommand{},
+	},
+	{
+		name:             "status",
+		shortDescription: "Report the migration state of both stores",
+		longDescription:  "Report whether the source store is retired and the target store is activated, and how many details each holds, without changing either. Exits non-zero when only one of them is.",
+		data:             &statusCommand{},
+	},
+}
+
+// storeOptions select the stores to migrate between. The store given by --to
+// is connected to with the target store options where they are given.
+type storeOptions struct {
+	From string `long:"from" env:"MIGRATE_FROM" default:"sql" choice:"sql" choice:"credhub" choice:"vault" choice:"kubernetes" choice:"filesystem" description:"Store to migrate broker state from"`
+
+	To string `long:"to" env:"MIGRATE_TO" default:"credhub" choice:"sql" choice:"credhub" choice:"vault" choice:"kubernetes" choice:"filesystem" description:"Store to migrate broker state to"`
+}
+
+// storeKinds are the kinds of store connected to with the shared options and
+// with the target store options.
+func (o storeOptions) storeKinds() (string, string) {
+	return o.From, o.To
+}
+
+// connector is a command that connects to stores, so that only the options
+// of the stores it selects are required.
+type connector interface {
+	storeKinds() (source, target string)
+}
+
+// store can be either side of a migration, and names where it keeps details
+// and both of its markers.
+type store interface {
+	migrator.MarkedStore
+	migrator.Locator
+	RetirementMarkerLocation() string
+	String() string
+}
+
+type directionOptions struct {
+	storeOptions
+
+	Reverse bool `long:"reverse" env:"MIGRATE_REVERSE" description:"Consider a rollback from the --to store to the --from store rather than a migration from --from to --to"`
+}
+
+type pageOptions struct {
+	PageSize int `long:"pageSize" env:"MIGRATE_PAGE_SIZE" default:"500" description:"Number of SQL rows to read at a time, or 0 to read every row at once"`
+}
+
+type copyOptions struct {
+	pageOptions
+
+	JournalPath string `long:"journalPath" env:"MIGRATE_JOURNAL_PATH" description:"Path to a journal file recording migration progress, so that a failed migration can be resumed"`
+
+	OnConflict string `long:"onConflict" env:"MIGRATE_ON_CONFLICT" default:"fail" choice:"fail" choice:"skip" choice:"overwrite" description:"What to do with details the target store already holds with different content: stop before writing anything (fail), leave them in place (skip) or replace them (overwrite)"`
+}
+
+func (o copyOptions) migratorOptions() []migrator.Option {
+	options := []migrator.Option{
+		migrator.WithConflictPolicy(migrator.ConflictPolicy(o.OnConflict)),
+		migrator.WithPageSize(o.PageSize),
+	}
+	if o.JournalPath != "" {
+		options = append(options, migrator.WithJournal(migrator.NewFileJournal(o.JournalPath)))
+	}
+	return options
+}
+
+type migrationOptions struct {
+	copyOptions
+
+	RollbackOnFailure bool `long:"rollbackOnFailure" env:"MIGRATE_ROLLBACK_ON_FAILURE" description:"Delete the details written to the target store if the migration fails before it is activated, and write back any it overwrote"`
+
+	ReportPath string `long:"reportPath" env:"MIGRATE_REPORT_PATH" description:"Path to write a JSON report of the migration to"`
+
+	Concurrency int `long:"concurrency" env:"MIGRATE_CONCURRENCY" default:"1" description:"Number of details to write to the target store at once"`
+}
+
+func (o migrationOptions) migratorOptions() []migrator.Option {
+	options := append(o.copyOptions.migratorOptions(), migrator.WithConcurrency(o.Concurrency))
+	if o.RollbackOnFailure {
+		options = append(options, migrator.WithRollbackOnFailure())
+	}
+	return options
+}
+
+type migrateCommand struct {
+	storeOptions
+	migrationOptions
+}
+
+func (c *migrateCommand) Execute(args []string) error {
+	logger := newLogger().Session("migrate")
+	fromStore, toStore, _, ok := c.stores(logger, false)
+	if !ok {
+		return nil
+	}
+
+	migrate(logger, migrator.NewMigrator(logger, c.migratorOptions()...), fromStore, toStore, c.ReportPath)
+	return nil
+}
+
+type rollbackCommand struct {
+	storeOptions
+	migrationOptions
+}
+
+func (c *rollbackCommand) Execute(args []string) error {
+	logger := newLogger().Session("rollback")
+	fromStore, toStore, _, ok := c.stores(logger, true)
+	if !ok {
+		return nil
+	}
+
+	migrate(logger, migrator.NewMigrator(logger, c.migratorOptions()...), fromStore, toStore, c.ReportPath)
+	return nil
+}
+
+type planCommand struct {
+	directionOptions
+	copyOptions
+}
+
+func (c *planCommand) Execute(args []string) error {
+	logger := newLogger().Session("plan")
+	fromStore, toStore, target, ok := c.stores(logger, c.Reverse)
+	if !ok {
+		return nil
+	}
+
+	plan, err := migrator.NewMigrator(logger, c.migratorOptions()...).Plan(fromStore, toStore)
+	if err != nil {
+		logger.Fatal("failed-to-plan-migration", err)
+	}
+	WritePlan(os.Stdout, plan, target)
+	return nil
+}
+
+type verifyCommand struct {
+	directionOptions
+	pageOptions
+}
+
+func (c *verifyCommand) Execute(args []string) error {
+	logger := newLogger().Session("verify")
+	fromStore, toStore, _, ok := c.stores(logger, c.Reverse)
+	if !ok {
+		return nil
+	}
+
+	err := migrator.NewMigrator(logger, migrator.WithPageSize(c.PageSize)).Verify(fromStore, toStore)
+	if err != nil {
+		logger.Fatal("failed-to-verify", err)
+	}
+	return nil
+}
+
+type statusCommand struct {
+	directionOptions
+}
+
+func (c *statusCommand) Execute(args []string) error {
+	logger := newLogger().Session("status")
+	fromStore, toStore, _, ok := c.stores(logger, c.Reverse)
+	if !ok {
+		return nil
+	}
+
+	status, err := migrator.NewMigrator(logger).Status(fromStore, toStore)
+	if err != nil {
+		logger.Fatal("failed-to-get-status", err)
+	}
+	WriteStatus(os.Stdout, status)
+	// the table says which marker is missing, so exit without a stack trace
+	if status.Inconsistent() {
+		os.Exit(1)
+	}
+	return nil
+}
+
+type encryptionOptions struct {
+	ArchiveKeyFile string `long:"archiveKeyFile" env:"MIGRATE_ARCHIVE_KEY_FILE" description:"Path to a file holding a 256-bit key, as 32 bytes or 64 hexadecimal digits, to encrypt the archive with"`
+
+	ArchivePassphraseFile string `long:"archivePassphraseFile" env:"MIGRATE_ARCHIVE_PASSPHRASE_FILE" description:"Path to a file holding a passphrase to derive the key to encrypt the archive with"`
+}
+
+func (o encryptionOptions) secret() (archive.Secret, error) {
+	switch {
+	case o.ArchiveKeyFile != "" && o.ArchivePassphraseFile != "":
+		return archive.Secret{}, errors.New("only one of `--archiveKeyFile' and `--archivePassphraseFile' can be specified")
+	case o.ArchiveKeyFile != "":
+		key, err := archive.ReadKeyFile(o.ArchiveKeyFile)
+		return archive.Secret{Key: key}, err
+	case o.ArchivePassphraseFile != "":
+		b, err := ioutil.ReadFile(o.ArchivePassphraseFile)
+		if err != nil {
+			return archive.Secret{}, err
+		}
+		passphrase := strings.TrimRight(string(b), "\r\n")
+		if passphrase == "" {
+			return archive.Secret{}, errors.New("the passphrase file " + o.ArchivePassphraseFile + " is empty")
+		}
+		return archive.Secret{Passphrase: []byte(passphrase)}, nil
+	default:
+		return archive.Secret{}, nil
+	}
+}
+
+type exportCommand struct {
+	encryptionOptions
+	pageOptions
+
+	ArchivePath string `long:"archivePath" env:"MIGRATE_ARCHIVE_PATH" required:"true" description:"Path to write the archive to"`
+}
+
+func (c *exportCommand) storeKinds() (string, string) {
+	return "sql", ""
+}
+
+func (c *exportCommand) Execute(args []string) error {
+	logger := newLogger().Session("export")
+	secret, err := c.secret()
+	if err != nil {
+		logger.Fatal("failed-to-read-archive-secret", err)
+	}
+	dbStore := openSQLStore(logger, sourceConnections().db, true)
+
+	err = WriteFileAtomically(c.ArchivePath, func(file io.Writer) error {
+		out := file
+		var encrypted io.WriteCloser
+		if c.ArchiveKeyFile != "" || c.ArchivePassphraseFile != "" {
+			var err error
+			encrypted, err = archive.NewEncryptingWriter(file, secret)
+			if err != nil {
+				return err
+			}
+			out = encrypted
+		}
+
+		writer, err := archive.NewWriter(out, archive.Header{
+			Source:    dbStore.String(),
+			StoreID:   opts.StoreID,
+			CreatedAt: time.Now().UTC(),
+		})
+		if err != nil {
+			return err
+		}
+
+		err = migrator.NewMigrator(logger, migrator.WithPageSize(c.PageSize)).Export(dbStore, writer)
+		if err != nil {
+			return err
+		}
+
+		err = writer.Close()
+		if err == nil && encrypted != nil {
+			err = encrypted.Close()
+		}
+		return err
+	})
+	if err != nil {
+		logger.Fatal("failed-to-export", err, lager.Data{"path": c.ArchivePath})
+	}
+	return nil
+}
+
+type importCommand struct {
+	migrationOptions
+	encryptionOptions
+
+	ArchivePath string `long:"archivePath" env:"MIGRATE_ARCHIVE_PATH" required:"true" description:"Path to the archive to import"`
+
+	Into string `long:"into" env:"MIGRATE_INTO" default:"credhub" choice:"credhub" choice:"sql" description:"Store to import the archive into"`
+}
+
+// storeKinds gives the store imported into as the source, as it is
+// connected to with the shared options.
+func (c *importCommand) storeKinds() (string, string) {
+	return c.Into, ""
+}
+
+func (c *importCommand) Execute(args []string) error {
+	logger := newLogger().Session("import")
+	secret, err := c.secret()
+	if err != nil {
+		logger.Fatal("failed-to-read-archive-secret", err)
+	}
+	fromStore, err := archive.Open(c.ArchivePath, secret)
+	if err != nil {
+		logger.Fatal("failed-to-read-archive", err, lager.Data{"path": c.ArchivePath})
+	}
+
+	header := fromStore.Header()
+	logger.Info("read-archive", lager.Data{"source": header.Source, "store-id": header.StoreID, "created-at": header.CreatedAt})
+
+	connections := sourceConnections()
+	var toStore migrator.ActivatableStore
+	if c.Into == "sql" {
+		toStore = migrator.ImportTarget(openSQLStore(logger, connections.db, true))
+	} else {
+		if header.StoreID != "" && header.StoreID != opts.StoreID {
+			logger.Info("importing-into-another-store-id", lager.Data{"archive-store-id": header.StoreID, "store-id": opts.StoreID})
+		}
+		toStore = openCredhubStore(logger, connections.credhub)
+	}
+	err = CheckImportTarget(toStore)
+	if err != nil {
+		logger.Fatal("cannot-import-into-store", err)
+	}
+
+	migrate(logger, migrator.NewMigrator(logger, c.migratorOptions()...), fromStore, toStore, c.ReportPath)
+	return nil
+}
+
+// stores opens the stores given by --from and --to as the source and target
+// of a migration, or of its rollback when reverse is set. It returns false
+// when there is no SQL database to migrate from.
+func (o storeOptions) stores(logger lager.Logger, reverse bool) (migrator.RetirableStore, migrator.ActivatableStore, migrator.Locator, bool) {
+	fromConnections := sourceConnections()
+	toConnections := targetConnections()
+	if o.From == o.To && fromConnections.describe(o.From) == toConnections.describe(o.To) {
+		logger.Fatal("cannot-migrate-store-to-itself", errors.New("the source and target stores are the same, so give the target store options of the store to migrate to"))
+	}
+
+	from := openStore(logger, o.From, fromConnections, reverse)
+	if from == nil {
+		return nil, nil, nil, false
+	}
+	to := openStore(logger, o.To, toConnections, true)
+	logger.Info("stores", lager.Data{"from": from.String(), "to": to.String(), "reverse": reverse})
+
+	fromStore, toStore := migrator.Between(from, to, reverse)
+	if reverse {
+		return fromStore, toStore, rollbackLocator{from}, true
+	}
+	return fromStore, toStore, to, true
+}
+
+// openStore opens a store of the given kind. Unless required is set, it
+// returns nil when the SQL database does not exist.
+func openStore(logger lager.Logger, kind string, c connections, required bool) store {
+	switch kind {
+	case "credhub":
+		return openCredhubStore(logger, c.credhub)
+	case "vault":
+		return openVaultStore(logger, c.vault)
+	case "kubernetes":
+		return openKubernetesStore(logger, c.kubernetes)
+	case "filesystem":
+		return openFSStore(logger, c.fs)
+	}
+
+	dbStore := openSQLStore(logger, c.db, required)
+	if dbStore == nil {
+		return nil
+	}
+	return dbStore
+}
+
+// rollbackLocator names the retirement marker of the store a rollback
+// copies details back to, as that is the marker the rollback removes.
+type rollbackLocator struct {
+	store
+}
+
+func (l rollbackLocator) MarkerLocation() string {
+	return l.RetirementMarkerLocation()
+}
+
+func migrate(logger lager.Logger, m migrator.Migrator, fromStore migrator.RetirableStore, toStore migrator.ActivatableStore, reportPath string) {
+	logger.Info("migrating")
+	defer logger.Info("ends")
+
+	report, migrateErr := m.Migrate(fromStore, toStore)
+	WriteReport(os.Stdout, report)
+	if reportPath != "" {
+		err := SaveReport(reportPath, report)
+		if err != nil {
+			logger.Error("failed-to-save-report", err, lager.Data{"path": reportPath})
+		}
+	}
+	if migrateErr != nil {
+		logger.Fatal("failed-to-migrate", migrateErr)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	flags "github.com/jessevdk/go-flags"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// LoadConfig reads the file named by the --config option, or by the
+// MIGRATE_CONFIG environment variable, and makes each value in it the
+// default of the options with the same long name, of any command. Values
+// given on the command line or in environment variables therefore take
+// precedence over the file, which takes precedence over the defaults of the
+// options.
+func LoadConfig(parser *flags.Parser, args []string) error {
+	var configOpts struct {
+		Config string `long:"config" env:"MIGRATE_CONFIG"`
+	}
+	_, err := flags.NewParser(&configOpts, flags.IgnoreUnknown).ParseArgs(args)
+	if err != nil {
+		return err
+	}
+	if configOpts.Config == "" {
+		return nil
+	}
+
+	b, err := ioutil.ReadFile(configOpts.Config)
+	if err != nil {
+		return err
+	}
+
+	// YAML is a superset of JSON, so either can be read as YAML
+	values := map[string]interface{}{}
+	err = yaml.Unmarshal(b, &values)
+	if err != nil {
+		return fmt.Errorf("cannot parse config file %s: %s", configOpts.Config, err)
+	}
+
+	for name, value := range values {
+		options := findOptions(parser.Command, name)
+		if len(options) == 0 || name == "config" {
+			return fmt.Errorf("unknown option `%s' in config file %s", name, configOpts.Config)
+		}
+		for _, option := range options {
+			option.Default = configValues(value)
+		}
+	}
+
+	return nil
+}
+
+// findOptions returns the options with the given long name of command and of
+// each of its subcommands, as commands such as migrate and plan share
+// options.
+func findOptions(command *flags.Command, name string) []*flags.Option {
+	var options []*flags.Option
+	if option := command.Group.FindOptionByLongName(name); option != nil {
+		options = append(options, option)
+	}
+	for _, subcommand := range command.Commands() {
+		options = append(options, findOptions(subcommand, name)...)
+	}
+	return options
+}
+
+func configValues(value interface{}) []string {
+	if list, ok := value.([]interface{}); ok {
+		var values []string
+		for _, v := range list {
+			values = append(values, fmt.Sprint(v))
+		}
+		return values
+	}
+	return []string{fmt.Sprint(value)}
+}
+
+// ReadSecret returns value, or else the contents of the file at path without
+// a trailing newline. Exactly one of the two must be given.
+func ReadSecret(name, value, path string) (string, error) {
+	switch {
+	case value != "" && path != "":
+		return "", fmt.Errorf("only one of `--%s' and `--%sFile' can be specified", name, name)
+	case path != "":
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(b), "\r\n"), nil
+	case value != "":
+		return value, nil
+	default:
+		return "", &flags.Error{
+			Type:    flags.ErrRequired,
+			Message: fmt.Sprintf("the required flag `--%s' or `--%sFile' was not specified", name, name),
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package main_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "code.cloudfoundry.org/migrate_mysql_to_credhub"
+
+	flags "github.com/jessevdk/go-flags"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Config", func() {
+	var (
+		dir    string
+		parser *flags.Parser
+		opts   struct {
+			Config   string   `long:"config"`
+			Username string   `long:"username" env:"MIGRATE_TEST_USERNAME"`
+			Port     int      `long:"port" default:"1234"`
+			Verbose  bool     `long:"verbose"`
+			Statuses []int    `long:"status" default:"502"`
+			Password string   `long:"password" required:"true"`
+			Names    []string `long:"name"`
+		}
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "config")
+		Expect(err).NotTo(HaveOccurred())
+
+		opts.Username, opts.Port, opts.Verbose, opts.Statuses, opts.Password, opts.Names = "", 0, false, nil, "", nil
+		parser = flags.NewParser(&opts, flags.None)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+		os.Unsetenv("MIGRATE_TEST_USERNAME")
+		os.Unsetenv("MIGRATE_CONFIG")
+	})
+
+	writeConfig := func(content string) string {
+		path := filepath.Join(dir, "config.yml")
+		Expect(ioutil.WriteFile(path, []byte(content), 0600)).To(Succeed())
+		return path
+	}
+
+	parse := func(args ...string) error {
+		err := LoadConfig(parser, args)
+		if err != nil {
+			return err
+		}
+		_, err = parser.ParseArgs(args)
+		return err
+	}
+
+	It("reads option values from a YAML file", func() {
+		path := writeConfig("username: some-user\nport: 5678\nverbose: true\nstatus: [500, 503]\npassword: some-password\n")
+
+		Expect(parse("--config", path)).To(Succeed())
+		Expect(opts.Username).To(Equal("some-user"))
+		Expect(opts.Port).To(Equal(5678))
+		Expect(opts.Verbose).To(BeTrue())
+		Expect(opts.Statuses).To(Equal([]int{500, 503}))
+		Expect(opts.Password).To(Equal("some-password"))
+	})
+
+	It("reads option values from a JSON file", func() {
+		path := writeConfig(`{"username": "some-user", "password": "some-password", "name": ["a", "b"]}`)
+
+		Expect(parse("--config=" + path)).To(Succeed())
+		Expect(opts.Username).To(Equal("some-user"))
+		Expect(opts.Names).To(Equal([]string{"a", "b"}))
+	})
+
+	It("finds the file through the environment", func() {
+		os.Setenv("MIGRATE_CONFIG", writeConfig("password: some-password\n"))
+
+		Expect(parse()).To(Succeed())
+		Expect(opts.Password).To(Equal("some-password"))
+	})
+
+	It("keeps the defaults of options the file does not give", func() {
+		path := writeConfig("password: some-password\n")
+
+		Expect(parse("--config", path)).To(Succeed())
+		Expect(opts.Port).To(Equal(1234))
+		Expect(opts.Statuses).To(Equal([]int{502}))
+	})
+
+	It("is overridden by the environment", func() {
+		path := writeConfig("username: some-user\npassword: some-password\n")
+		os.Setenv("MIGRATE_TEST_USERNAME", "env-user")
+
+		Expect(parse("--config", path)).To(Succeed())
+		Expect(opts.Username).To(Equal("env-user"))
+	})
+
+	It("is overridden by the command line", func() {
+		path := writeConfig("username: some-user\npassword: some-password\nstatus: [500]\n")
+		os.Setenv("MIGRATE_TEST_USERNAME", "env-user")
+
+		Expect(parse("--config", path, "--username", "cli-user", "--status", "504")).To(Succeed())
+		Expect(opts.Username).To(Equal("cli-user"))
+		Expect(opts.Statuses).To(Equal([]int{504}))
+	})
+
+	It("is not needed", func() {
+		Expect(parse("--password", "some-password")).To(Succeed())
+		Expect(opts.Port).To(Equal(1234))
+	})
+
+	Context("when the option belongs to a command", func() {
+		var command struct {
+			PageSize int `long:"pageSize" env:"MIGRATE_TEST_PAGE_SIZE" default:"500"`
+		}
+
+		BeforeEach(func() {
+			command.PageSize = 0
+			_, err := parser.AddCommand("copy", "", "", &command)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			os.Unsetenv("MIGRATE_TEST_PAGE_SIZE")
+		})
+
+		It("reads its value from the file", func() {
+			path := writeConfig("password: some-password\npageSize: 50\n")
+
+			Expect(parse("--config", path, "copy")).To(Succeed())
+			Expect(command.PageSize).To(Equal(50))
+		})
+
+		It("is overridden by the environment", func() {
+			path := writeConfig("password: some-password\npageSize: 50\n")
+			os.Setenv("MIGRATE_TEST_PAGE_SIZE", "20")
+
+			Expect(parse("--config", path, "copy")).To(Succeed())
+			Expect(command.PageSize).To(Equal(20))
+		})
+	})
+
+	Context("when the file gives an unknown option", func() {
+		It("returns an error", func() {
+			path := writeConfig("password: some-password\nsome-option: some-value\n")
+			Expect(parse("--config", path)).To(MatchError("unknown option `some-option' in config file " + path))
+		})
+	})
+
+	Context("when the file cannot be parsed", func() {
+		It("returns an error", func() {
+			path := writeConfig("password: [")
+			Expect(parse("--config", path)).To(MatchError(ContainSubstring("cannot parse config file " + path)))
+		})
+	})
+
+	Context("when the file does not exist", func() {
+		It("returns an error", func() {
+			Expect(parse("--config", filepath.Join(dir, "missing.yml"))).To(HaveOccurred())
+		})
+	})
+
+	Describe("#ReadSecret", func() {
+		It("returns the value given", func() {
+			Expect(ReadSecret("password", "some-password", "")).To(Equal("some-password"))
+		})
+
+		It("reads the file given, without a trailing newline", func() {
+			path := filepath.Join(dir, "password")
+			Expect(ioutil.WriteFile(path, []byte("some-password\n"), 0600)).To(Succeed())
+
+			Expect(ReadSecret("password", "", path)).To(Equal("some-password"))
+		})
+
+		It("refuses both a value and a file", func() {
+			_, err := ReadSecret("password", "some-password", "some-path")
+			Expect(err).To(MatchError("only one of `--password' and `--passwordFile' can be specified"))
+		})
+
+		It("requires a value or a file", func() {
+			_, err := ReadSecret("password", "", "")
+			Expect(err).To(MatchError("the required flag `--password' or `--passwordFile' was not specified"))
+		})
+	})
+})
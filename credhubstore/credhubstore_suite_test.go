@@ -0,0 +1,13 @@
+package credhubstore_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestCredhubstore(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Credhubstore Suite")
+}
@@ -0,0 +1,236 @@
+package credhubstore
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"code.cloudfoundry.org/credhub-cli/credhub"
+	"code.cloudfoundry.org/credhub-cli/credhub/auth"
+	"code.cloudfoundry.org/credhub-cli/credhub/credentials"
+	"code.cloudfoundry.org/credhub-cli/credhub/credentials/values"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/service-broker-store/brokerstore/credhub_shims"
+)
+
+// RetryPolicy decides which failed CredHub calls are retried, how often and
+// how long apart.
+type RetryPolicy struct {
+	// MaxAttempts is the number of times a call is made before its error is
+	// returned.
+	MaxAttempts int
+
+	// InitialBackoff is the delay before the first retry, which doubles with
+	// every further retry up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+
+	// Jitter varies each delay by up to this fraction of it, either way.
+	Jitter float64
+
+	// RetryableStatuses are the HTTP statuses that are retried, when the
+	// connection to CredHub is made through a RetryingAuth.
+	RetryableStatuses []int
+
+	// RetryableErrors are the names of the credhub.Errors that are retried.
+	RetryableErrors []string
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:       5,
+		InitialBackoff:    500 * time.Millisecond,
+		MaxBackoff:        10 * time.Second,
+		Jitter:            0.2,
+		RetryableStatuses: []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+		RetryableErrors:   []string{"server_error", "temporarily_unavailable"},
+	}
+}
+
+// StatusError is returned in place of a CredHub or UAA response whose status
+// is retryable.
+type StatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected response: %s", e.Status)
+}
+
+func (p RetryPolicy) retryable(err error) bool {
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+
+	switch e := err.(type) {
+	case *StatusError:
+		for _, status := range p.RetryableStatuses {
+			if e.StatusCode == status {
+				return true
+			}
+		}
+	case *credhub.Error:
+		for _, name := range p.RetryableErrors {
+			if e.Name == name {
+				return true
+			}
+		}
+	case net.Error:
+		return e.Timeout()
+	}
+	return false
+}
+
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	delay := p.InitialBackoff
+	for i := 1; i < retry && delay < p.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if p.MaxBackoff > 0 && delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+
+	if p.Jitter > 0 {
+		delay += time.Duration(float64(delay) * p.Jitter * (2*rand.Float64() - 1))
+	}
+	return delay
+}
+
+// RetryingAuth authenticates like the CredhubAuth it wraps, and also makes
+// CredHub and UAA responses with a retryable status fail with a StatusError,
+// as the CredHub client does not otherwise report the status of a response.
+type RetryingAuth struct {
+	credhub_shims.CredhubAuth
+	Statuses []int
+}
+
+func (a *RetryingAuth) UaaClientCredentials(clientID, clientSecret string) auth.Builder {
+	builder := a.CredhubAuth.UaaClientCredentials(clientID, clientSecret)
+	return func(config auth.Config) (auth.Strategy, error) {
+		client := config.Client()
+		next := client.Transport
+		if next == nil {
+			next = http.DefaultTransport
+		}
+		client.Transport = &statusTransport{next: next, statuses: a.Statuses}
+		return builder(config)
+	}
+}
+
+type statusTransport struct {
+	next     http.RoundTripper
+	statuses []int
+}
+
+func (t *statusTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	for _, status := range t.statuses {
+		if resp.StatusCode == status {
+			resp.Body.Close()
+			return nil, &StatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+		}
+	}
+	return resp, nil
+}
+
+type retryingCredhub struct {
+	logger  lager.Logger
+	credhub credhub_shims.Credhub
+	policy  RetryPolicy
+}
+
+// NewRetryingCredhub returns a Credhub that retries the failed calls of the
+// given one according to policy.
+func NewRetryingCredhub(logger lager.Logger, credhub credhub_shims.Credhub, policy RetryPolicy) credhub_shims.Credhub {
+	return &retryingCredhub{
+		logger:  logger.Session("retrying-credhub"),
+		credhub: credhub,
+		policy:  policy,
+	}
+}
+
+func (c *retryingCredhub) retry(call, name string, fn func() error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil || attempt >= c.policy.MaxAttempts || !c.policy.retryable(err) {
+			return err
+		}
+
+		delay := c.policy.backoff(attempt)
+		c.logger.Info("retrying", lager.Data{"call": call, "name": name, "attempt": attempt, "delay": delay.String(), "error": err.Error()})
+		time.Sleep(delay)
+	}
+}
+
+func (c *retryingCredhub) SetJSON(name string, value values.JSON) (credentials.JSON, error) {
+	var cred credentials.JSON
+	err := c.retry("set-json", name, func() error {
+		var err error
+		cred, err = c.credhub.SetJSON(name, value)
+		return err
+	})
+	return cred, err
+}
+
+func (c *retryingCredhub) GetLatestJSON(name string) (credentials.JSON, error) {
+	var cred credentials.JSON
+	err := c.retry("get-latest-json", name, func() error {
+		var err error
+		cred, err = c.credhub.GetLatestJSON(name)
+		return err
+	})
+	return cred, err
+}
+
+func (c *retryingCredhub) SetValue(name string, value values.Value) (credentials.Value, error) {
+	var cred credentials.Value
+	err := c.retry("set-value", name, func() error {
+		var err error
+		cred, err = c.credhub.SetValue(name, value)
+		return err
+	})
+	return cred, err
+}
+
+func (c *retryingCredhub) GetLatestValue(name string) (credentials.Value, error) {
+	var cred credentials.Value
+	err := c.retry("get-latest-value", name, func() error {
+		var err error
+		cred, err = c.credhub.GetLatestValue(name)
+		return err
+	})
+	return cred, err
+}
+
+func (c *retryingCredhub) FindByPath(path string) (credentials.FindResults, error) {
+	var results credentials.FindResults
+	err := c.retry("find-by-path", path, func() error {
+		var err error
+		results, err = c.credhub.FindByPath(path)
+		return err
+	})
+	return results, err
+}
+
+// Delete also succeeds when a retry finds that an earlier attempt, whose
+// response was lost, already deleted the credential.
+func (c *retryingCredhub) Delete(name string) error {
+	attempts := 0
+	return c.retry("delete", name, func() error {
+		attempts++
+		err := c.credhub.Delete(name)
+		if _, ok := err.(*credhub.NotFoundError); ok && attempts > 1 {
+			return nil
+		}
+		return err
+	})
+}
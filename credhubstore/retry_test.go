@@ -0,0 +1,141 @@
+package credhubstore_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+
+	"code.cloudfoundry.org/credhub-cli/credhub"
+	"code.cloudfoundry.org/credhub-cli/credhub/auth"
+	"code.cloudfoundry.org/credhub-cli/credhub/credentials"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/migrate_mysql_to_credhub/credhubstore"
+	"code.cloudfoundry.org/migrate_mysql_to_credhub/credhubstore/fakes"
+	"code.cloudfoundry.org/service-broker-store/brokerstore/credhub_shims"
+)
+
+var _ = Describe("Retries", func() {
+	var (
+		logger      *lagertest.TestLogger
+		fakeCredhub *fakes.FakeCredhub
+		policy      credhubstore.RetryPolicy
+		retrying    credhub_shims.Credhub
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("retry-test")
+		fakeCredhub = &fakes.FakeCredhub{}
+		policy = credhubstore.DefaultRetryPolicy()
+		policy.InitialBackoff = time.Millisecond
+		policy.MaxBackoff = 2 * time.Millisecond
+	})
+
+	JustBeforeEach(func() {
+		retrying = credhubstore.NewRetryingCredhub(logger, fakeCredhub, policy)
+	})
+
+	Context("when a call fails with a retryable error", func() {
+		BeforeEach(func() {
+			fakeCredhub.SetJSONReturnsOnCall(0, credentials.JSON{}, &credhub.Error{Name: "server_error"})
+			fakeCredhub.SetJSONReturnsOnCall(1, credentials.JSON{}, &url.Error{Op: "Put", URL: "https://credhub", Err: &credhubstore.StatusError{StatusCode: 502, Status: "502 Bad Gateway"}})
+			fakeCredhub.SetJSONReturnsOnCall(2, credentials.JSON{}, nil)
+		})
+
+		It("retries it until it succeeds", func() {
+			_, err := retrying.SetJSON("/some-store-id/123", nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeCredhub.SetJSONCallCount()).To(Equal(3))
+		})
+
+		It("logs each retry", func() {
+			retrying.SetJSON("/some-store-id/123", nil)
+			Expect(logger).To(gbytes.Say(`retrying.*"attempt":1.*"call":"set-json".*server_error`))
+			Expect(logger).To(gbytes.Say(`retrying.*"attempt":2.*502 Bad Gateway`))
+		})
+	})
+
+	Context("when a call keeps failing", func() {
+		BeforeEach(func() {
+			policy.MaxAttempts = 3
+			fakeCredhub.FindByPathReturns(credentials.FindResults{}, &credhub.Error{Name: "temporarily_unavailable"})
+		})
+
+		It("returns the error after the last attempt", func() {
+			_, err := retrying.FindByPath("/some-store-id")
+			Expect(err).To(MatchError("temporarily_unavailable"))
+			Expect(fakeCredhub.FindByPathCallCount()).To(Equal(3))
+		})
+	})
+
+	Context("when a call fails with an error that is not retryable", func() {
+		BeforeEach(func() {
+			fakeCredhub.GetLatestJSONReturns(credentials.JSON{}, errors.New("not-retryable"))
+		})
+
+		It("returns the error at once", func() {
+			_, err := retrying.GetLatestJSON("/some-store-id/123")
+			Expect(err).To(MatchError("not-retryable"))
+			Expect(fakeCredhub.GetLatestJSONCallCount()).To(Equal(1))
+		})
+	})
+
+	Context("when a retried delete finds the credential already deleted", func() {
+		BeforeEach(func() {
+			fakeCredhub.DeleteReturnsOnCall(0, &credhub.Error{Name: "server_error"})
+			fakeCredhub.DeleteReturnsOnCall(1, &credhub.NotFoundError{Description: "not found"})
+		})
+
+		It("succeeds", func() {
+			Expect(retrying.Delete("/some-store-id/123")).To(Succeed())
+			Expect(fakeCredhub.DeleteCallCount()).To(Equal(2))
+		})
+	})
+
+	Describe("RetryingAuth", func() {
+		var (
+			server    *httptest.Server
+			responses []int
+		)
+
+		BeforeEach(func() {
+			responses = []int{http.StatusBadGateway, http.StatusOK}
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				status := responses[0]
+				responses = responses[1:]
+				w.WriteHeader(status)
+				w.Write([]byte(`{"data":[{"type":"value","name":"/some-store-id/migrated-from-sql","value":"true"}]}`))
+			}))
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("makes responses with a retryable status fail with a StatusError", func() {
+			retryingAuth := &credhubstore.RetryingAuth{CredhubAuth: &noopAuth{}, Statuses: policy.RetryableStatuses}
+			client, err := credhub.New(server.URL, credhub.Auth(retryingAuth.UaaClientCredentials("some-client", "some-secret")))
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = client.GetLatestValue("/some-store-id/migrated-from-sql")
+			urlErr, ok := err.(*url.Error)
+			Expect(ok).To(BeTrue())
+			Expect(urlErr.Err).To(Equal(&credhubstore.StatusError{StatusCode: http.StatusBadGateway, Status: "502 Bad Gateway"}))
+
+			value, err := client.GetLatestValue("/some-store-id/migrated-from-sql")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(value.Value).To(BeEquivalentTo("true"))
+		})
+	})
+})
+
+type noopAuth struct{}
+
+func (a *noopAuth) UaaClientCredentials(clientID, clientSecret string) auth.Builder {
+	return auth.Noop
+}
@@ -0,0 +1,295 @@
+package credhubstore
+
+import (
+	"encoding/json"
+	"strings"
+
+	"code.cloudfoundry.org/credhub-cli/credhub"
+	"code.cloudfoundry.org/credhub-cli/credhub/credentials/values"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/migrate_mysql_to_credhub/migrator"
+	"code.cloudfoundry.org/service-broker-store/brokerstore"
+	"code.cloudfoundry.org/service-broker-store/brokerstore/credhub_shims"
+	"github.com/pivotal-cf/brokerapi"
+)
+
+//go:generate counterfeiter -o fakes/fake_credhub.go code.cloudfoundry.org/service-broker-store/brokerstore/credhub_shims.Credhub
+
+const (
+	activationMarker = "migrated-from-sql"
+	retirementMarker = "migrated-to-another-store"
+)
+
+// Layout decides where under the store namespace details are kept.
+type Layout string
+
+const (
+	// FlatLayout keeps instances and bindings side by side at /<storeID>/<id>,
+	// as brokerstore.CredhubStore does.
+	FlatLayout Layout = "flat"
+
+	// SplitLayout keeps instances at /<storeID>/instances/<id> and bindings at
+	// /<storeID>/bindings/<id>, so that their IDs cannot collide.
+	SplitLayout Layout = "split"
+)
+
+// Store is a brokerstore.CredhubStore that can also list the details it
+// holds and remove its activation marker. It also keeps a retirement marker,
+// so that it can be the source of a migration to another store. With the
+// split layout, instances and bindings are kept by brokerstore.CredhubStores
+// of their own namespaces under the store namespace.
+type Store struct {
+	*brokerstore.CredhubStore
+	migrator.StoreComparer
+	instances   *brokerstore.CredhubStore
+	bindings    *brokerstore.CredhubStore
+	logger      lager.Logger
+	credhubShim credhub_shims.Credhub
+	storeID     string
+	layout      Layout
+}
+
+func NewStore(logger lager.Logger, credhubShim credhub_shims.Credhub, storeID string) *Store {
+	return NewStoreWithLayout(logger, credhubShim, storeID, FlatLayout)
+}
+
+func NewStoreWithLayout(logger lager.Logger, credhubShim credhub_shims.Credhub, storeID string, layout Layout) *Store {
+	credhubStore := brokerstore.NewCredhubStore(logger, credhubShim, storeID)
+	s := &Store{
+		CredhubStore: credhubStore,
+		instances:    credhubStore,
+		bindings:     credhubStore,
+		logger:       logger,
+		credhubShim:  credhubShim,
+		storeID:      storeID,
+		layout:       layout,
+	}
+	if layout == SplitLayout {
+		s.instances = brokerstore.NewCredhubStore(logger, credhubShim, storeID+"/instances")
+		s.bindings = brokerstore.NewCredhubStore(logger, credhubShim, storeID+"/bindings")
+	}
+	s.StoreComparer = migrator.NewStoreComparer(s.RetrieveInstanceDetails, s.RetrieveBindingDetails)
+	return s
+}
+
+func (s *Store) String() string {
+	return "credhub:/" + s.storeID
+}
+
+func (s *Store) Deactivate() error {
+	s.logger.Info("deactivating-credhub")
+	return s.credhubShim.Delete(s.MarkerLocation())
+}
+
+func (s *Store) Retire() error {
+	s.logger.Info("retiring-credhub")
+	_, err := s.credhubShim.SetValue(s.RetirementMarkerLocation(), "true")
+	return err
+}
+
+func (s *Store) IsRetired() (bool, error) {
+	logger := s.logger.Session("is-retired")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	results, err := s.credhubShim.FindByPath(s.RetirementMarkerLocation())
+	if err != nil {
+		return false, err
+	}
+
+	return len(results.Credentials) > 0, nil
+}
+
+func (s *Store) Unretire() error {
+	s.logger.Info("unretiring-credhub")
+	return s.credhubShim.Delete(s.RetirementMarkerLocation())
+}
+
+func (s *Store) CreateInstanceDetails(id string, details brokerstore.ServiceInstance) error {
+	return s.instances.CreateInstanceDetails(id, details)
+}
+
+func (s *Store) CreateBindingDetails(id string, details brokerapi.BindDetails) error {
+	return s.bindings.CreateBindingDetails(id, details)
+}
+
+// RetrieveInstanceDetails returns brokerapi.ErrInstanceDoesNotExist for an
+// instance that CredHub does not hold, as the other stores do.
+func (s *Store) RetrieveInstanceDetails(id string) (brokerstore.ServiceInstance, error) {
+	details, err := s.instances.RetrieveInstanceDetails(id)
+	if _, ok := err.(*credhub.NotFoundError); ok {
+		return brokerstore.ServiceInstance{}, brokerapi.ErrInstanceDoesNotExist
+	}
+	return details, err
+}
+
+// RetrieveBindingDetails returns brokerapi.ErrBindingDoesNotExist for a
+// binding that CredHub does not hold, as the other stores do.
+func (s *Store) RetrieveBindingDetails(id string) (brokerapi.BindDetails, error) {
+	details, err := s.bindings.RetrieveBindingDetails(id)
+	if _, ok := err.(*credhub.NotFoundError); ok {
+		return brokerapi.BindDetails{}, brokerapi.ErrBindingDoesNotExist
+	}
+	return details, err
+}
+
+func (s *Store) RetrieveAllInstanceDetails() (map[string]brokerstore.ServiceInstance, error) {
+	logger := s.logger.Session("retrieve-all-instance-details")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	if s.layout == SplitLayout {
+		instances := map[string]brokerstore.ServiceInstance{}
+		err := s.retrieveUnder(logger, s.namespaced("instances"), func(id string, value values.JSON) error {
+			var instance brokerstore.ServiceInstance
+			err := toStruct(value, &instance)
+			instances[id] = instance
+			return err
+		})
+		return instances, err
+	}
+
+	instances, _, err := s.retrieveAllFlat(logger)
+	return instances, err
+}
+
+func (s *Store) RetrieveAllBindingDetails() (map[string]brokerapi.BindDetails, error) {
+	logger := s.logger.Session("retrieve-all-binding-details")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	if s.layout == SplitLayout {
+		bindings := map[string]brokerapi.BindDetails{}
+		err := s.retrieveUnder(logger, s.namespaced("bindings"), func(id string, value values.JSON) error {
+			var binding brokerapi.BindDetails
+			err := toStruct(value, &binding)
+			bindings[id] = binding
+			return err
+		})
+		return bindings, err
+	}
+
+	_, bindings, err := s.retrieveAllFlat(logger)
+	return bindings, err
+}
+
+func (s *Store) DeleteInstanceDetails(id string) error {
+	return s.instances.DeleteInstanceDetails(id)
+}
+
+func (s *Store) DeleteBindingDetails(id string) error {
+	return s.bindings.DeleteBindingDetails(id)
+}
+
+// IsInstanceConflict is the one of the StoreComparer, which compares
+// parameters hashed by another store, rather than the one of brokerstore.CredhubStore.
+func (s *Store) IsInstanceConflict(id string, details brokerstore.ServiceInstance) bool {
+	return s.StoreComparer.IsInstanceConflict(id, details)
+}
+
+func (s *Store) IsBindingConflict(id string, details brokerapi.BindDetails) bool {
+	return s.StoreComparer.IsBindingConflict(id, details)
+}
+
+func (s *Store) InstanceLocation(id string) string {
+	if s.layout == SplitLayout {
+		return s.namespaced("instances", id)
+	}
+	return s.namespaced(id)
+}
+
+func (s *Store) BindingLocation(id string) string {
+	if s.layout == SplitLayout {
+		return s.namespaced("bindings", id)
+	}
+	return s.namespaced(id)
+}
+
+func (s *Store) MarkerLocation() string {
+	return s.namespaced(activationMarker)
+}
+
+func (s *Store) RetirementMarkerLocation() string {
+	return s.namespaced(retirementMarker)
+}
+
+// retrieveUnder reads every credential directly under path, other than the
+// markers.
+func (s *Store) retrieveUnder(logger lager.Logger, path string, found func(id string, value values.JSON) error) error {
+	results, err := s.credhubShim.FindByPath(path)
+	if err != nil {
+		logger.Error("failed-to-find-credentials", err, lager.Data{"path": path})
+		return err
+	}
+
+	for _, credential := range results.Credentials {
+		id := strings.TrimPrefix(credential.Name, path+"/")
+		if id == credential.Name || strings.Contains(id, "/") || credential.Name == s.MarkerLocation() || credential.Name == s.RetirementMarkerLocation() {
+			continue
+		}
+
+		creds, err := s.credhubShim.GetLatestJSON(credential.Name)
+		if err != nil {
+			logger.Error("failed-to-get-credential", err, lager.Data{"name": credential.Name})
+			return err
+		}
+
+		err = found(id, creds.Value)
+		if err != nil {
+			logger.Error("failed-to-parse-credential", err, lager.Data{"name": credential.Name})
+			return err
+		}
+	}
+
+	return nil
+}
+
+// retrieveAllFlat reads every credential in a flat namespace. Instances and
+// bindings share the namespace, so they are told apart by the fields that
+// only one of them serialises.
+func (s *Store) retrieveAllFlat(logger lager.Logger) (map[string]brokerstore.ServiceInstance, map[string]brokerapi.BindDetails, error) {
+	instances := map[string]brokerstore.ServiceInstance{}
+	bindings := map[string]brokerapi.BindDetails{}
+
+	err := s.retrieveUnder(logger, s.namespaced(), func(id string, value values.JSON) error {
+		switch {
+		case hasKey(value, "organization_guid"):
+			var instance brokerstore.ServiceInstance
+			if err := toStruct(value, &instance); err != nil {
+				return err
+			}
+			instances[id] = instance
+		case hasKey(value, "app_guid"):
+			var binding brokerapi.BindDetails
+			if err := toStruct(value, &binding); err != nil {
+				return err
+			}
+			bindings[id] = binding
+		default:
+			logger.Info("skipping-unrecognised-credential", lager.Data{"id": id})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return instances, bindings, nil
+}
+
+func (s *Store) namespaced(elements ...string) string {
+	return "/" + strings.Join(append([]string{s.storeID}, elements...), "/")
+}
+
+func hasKey(value values.JSON, key string) bool {
+	_, ok := value[key]
+	return ok
+}
+
+func toStruct(value values.JSON, target interface{}) error {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, target)
+}
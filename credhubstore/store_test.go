@@ -0,0 +1,338 @@
+package credhubstore_test
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf/brokerapi"
+
+	"code.cloudfoundry.org/credhub-cli/credhub"
+	"code.cloudfoundry.org/credhub-cli/credhub/credentials"
+	"code.cloudfoundry.org/credhub-cli/credhub/credentials/values"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/migrate_mysql_to_credhub/credhubstore"
+	"code.cloudfoundry.org/migrate_mysql_to_credhub/credhubstore/fakes"
+	"code.cloudfoundry.org/migrate_mysql_to_credhub/migrator"
+	"code.cloudfoundry.org/service-broker-store/brokerstore"
+)
+
+var _ = Describe("Store", func() {
+	var (
+		fakeCredhub *fakes.FakeCredhub
+		store       *credhubstore.Store
+	)
+
+	BeforeEach(func() {
+		fakeCredhub = newInMemoryCredhub()
+		store = credhubstore.NewStore(lagertest.NewTestLogger("credhubstore-test"), fakeCredhub, "some-store-id")
+	})
+
+	Context("when the store holds instances and bindings", func() {
+		BeforeEach(func() {
+			Expect(store.CreateInstanceDetails("instance-1", brokerstore.ServiceInstance{ServiceID: "some-service", OrganizationGUID: "some-org"})).To(Succeed())
+			Expect(store.CreateInstanceDetails("instance-2", brokerstore.ServiceInstance{ServiceID: "some-service", ServiceFingerPrint: map[string]interface{}{"share": "some-share"}})).To(Succeed())
+			Expect(store.CreateBindingDetails("binding-1", brokerapi.BindDetails{AppGUID: "some-app", RawParameters: []byte(`{"paramsHash":"some-hash"}`)})).To(Succeed())
+			Expect(store.Activate()).To(Succeed())
+			Expect(store.Retire()).To(Succeed())
+		})
+
+		It("lists every instance", func() {
+			instances, err := store.RetrieveAllInstanceDetails()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(instances).To(Equal(map[string]brokerstore.ServiceInstance{
+				"instance-1": brokerstore.ServiceInstance{ServiceID: "some-service", OrganizationGUID: "some-org"},
+				"instance-2": brokerstore.ServiceInstance{ServiceID: "some-service", ServiceFingerPrint: map[string]interface{}{"share": "some-share"}},
+			}))
+		})
+
+		It("lists every binding", func() {
+			bindings, err := store.RetrieveAllBindingDetails()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bindings).To(HaveLen(1))
+			Expect(bindings["binding-1"].AppGUID).To(Equal("some-app"))
+			Expect(bindings["binding-1"].RawParameters).To(MatchJSON(`{"paramsHash":"some-hash"}`))
+		})
+
+		It("only looks under the store namespace", func() {
+			_, err := store.RetrieveAllInstanceDetails()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeCredhub.FindByPathArgsForCall(fakeCredhub.FindByPathCallCount() - 1)).To(Equal("/some-store-id"))
+		})
+
+		Context("when a credential is neither an instance nor a binding", func() {
+			BeforeEach(func() {
+				_, err := fakeCredhub.SetJSON("/some-store-id/something-else", values.JSON{"foo": "bar"})
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("is skipped", func() {
+				instances, err := store.RetrieveAllInstanceDetails()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(instances).To(HaveLen(2))
+				bindings, err := store.RetrieveAllBindingDetails()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(bindings).To(HaveLen(1))
+			})
+		})
+
+		It("does not list the markers", func() {
+			instances, err := store.RetrieveAllInstanceDetails()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(instances).NotTo(HaveKey("migrated-from-sql"))
+			Expect(instances).NotTo(HaveKey("migrated-to-another-store"))
+			bindings, err := store.RetrieveAllBindingDetails()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bindings).NotTo(HaveKey("migrated-from-sql"))
+			Expect(bindings).NotTo(HaveKey("migrated-to-another-store"))
+		})
+
+		Context("when CredHub finds credentials outside the store namespace", func() {
+			BeforeEach(func() {
+				fakeCredhub.FindByPathReturns(credentials.FindResults{Credentials: []credentials.Base{
+					{Name: "/some-store-id/instance-1"},
+					{Name: "/some-store-id-2/instance-2"},
+				}}, nil)
+			})
+
+			It("ignores them", func() {
+				instances, err := store.RetrieveAllInstanceDetails()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(instances).To(HaveLen(1))
+				Expect(instances).To(HaveKey("instance-1"))
+			})
+		})
+
+		Context("when finding the credentials fails", func() {
+			BeforeEach(func() {
+				fakeCredhub.FindByPathReturns(credentials.FindResults{}, errors.New("find-failed"))
+			})
+
+			It("returns the error", func() {
+				_, err := store.RetrieveAllInstanceDetails()
+				Expect(err).To(MatchError("find-failed"))
+			})
+		})
+
+		Context("when reading a credential fails", func() {
+			BeforeEach(func() {
+				fakeCredhub.GetLatestJSONReturns(credentials.JSON{}, errors.New("get-failed"))
+			})
+
+			It("returns the error", func() {
+				_, err := store.RetrieveAllBindingDetails()
+				Expect(err).To(MatchError("get-failed"))
+			})
+		})
+	})
+
+	Describe("Deactivate", func() {
+		BeforeEach(func() {
+			Expect(store.Activate()).To(Succeed())
+		})
+
+		It("removes the activation marker", func() {
+			Expect(store.Deactivate()).To(Succeed())
+			Expect(fakeCredhub.DeleteArgsForCall(0)).To(Equal("/some-store-id/migrated-from-sql"))
+
+			activated, err := store.IsActivated()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(activated).To(BeFalse())
+		})
+	})
+
+	Describe("retiring", func() {
+		It("records the retirement marker at the top of the namespace", func() {
+			Expect(store.IsRetired()).To(BeFalse())
+
+			Expect(store.Retire()).To(Succeed())
+			name, _ := fakeCredhub.SetValueArgsForCall(0)
+			Expect(name).To(Equal("/some-store-id/migrated-to-another-store"))
+			Expect(store.IsRetired()).To(BeTrue())
+			Expect(store.IsActivated()).To(BeFalse())
+		})
+
+		It("removes the retirement marker when unretired", func() {
+			Expect(store.Retire()).To(Succeed())
+
+			Expect(store.Unretire()).To(Succeed())
+			Expect(fakeCredhub.DeleteArgsForCall(0)).To(Equal("/some-store-id/migrated-to-another-store"))
+			Expect(store.IsRetired()).To(BeFalse())
+		})
+
+		Context("when finding the marker fails", func() {
+			BeforeEach(func() {
+				fakeCredhub.FindByPathReturns(credentials.FindResults{}, errors.New("find-failed"))
+			})
+
+			It("returns the error", func() {
+				_, err := store.IsRetired()
+				Expect(err).To(MatchError("find-failed"))
+			})
+		})
+	})
+
+	Context("with the split layout", func() {
+		BeforeEach(func() {
+			store = credhubstore.NewStoreWithLayout(lagertest.NewTestLogger("credhubstore-test"), fakeCredhub, "some-store-id", credhubstore.SplitLayout)
+
+			Expect(store.CreateInstanceDetails("123", brokerstore.ServiceInstance{ServiceID: "some-service"})).To(Succeed())
+			Expect(store.CreateBindingDetails("123", brokerapi.BindDetails{AppGUID: "some-app"})).To(Succeed())
+			Expect(store.Activate()).To(Succeed())
+		})
+
+		It("keeps instances and bindings in separate namespaces", func() {
+			name, _ := fakeCredhub.SetJSONArgsForCall(0)
+			Expect(name).To(Equal("/some-store-id/instances/123"))
+			name, _ = fakeCredhub.SetJSONArgsForCall(1)
+			Expect(name).To(Equal("/some-store-id/bindings/123"))
+		})
+
+		It("keeps the activation marker at the top of the namespace", func() {
+			name, _ := fakeCredhub.SetValueArgsForCall(0)
+			Expect(name).To(Equal("/some-store-id/migrated-from-sql"))
+		})
+
+		It("reads back an instance and a binding with the same ID", func() {
+			instance, err := store.RetrieveInstanceDetails("123")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(instance.ServiceID).To(Equal("some-service"))
+
+			binding, err := store.RetrieveBindingDetails("123")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(binding.AppGUID).To(Equal("some-app"))
+		})
+
+		It("lists instances and bindings from their own namespaces", func() {
+			instances, err := store.RetrieveAllInstanceDetails()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(instances).To(Equal(map[string]brokerstore.ServiceInstance{
+				"123": brokerstore.ServiceInstance{ServiceID: "some-service"},
+			}))
+
+			bindings, err := store.RetrieveAllBindingDetails()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bindings).To(HaveLen(1))
+			Expect(bindings["123"].AppGUID).To(Equal("some-app"))
+		})
+
+		It("deletes from the matching namespace", func() {
+			Expect(store.DeleteBindingDetails("123")).To(Succeed())
+			Expect(fakeCredhub.DeleteArgsForCall(0)).To(Equal("/some-store-id/bindings/123"))
+
+			_, err := store.RetrieveInstanceDetails("123")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("locates details in their own namespaces", func() {
+			Expect(store.InstanceLocation("123")).To(Equal("/some-store-id/instances/123"))
+			Expect(store.BindingLocation("123")).To(Equal("/some-store-id/bindings/123"))
+		})
+	})
+
+	Describe("conflict checks", func() {
+		BeforeEach(func() {
+			Expect(store.CreateInstanceDetails("123", brokerstore.ServiceInstance{ServiceID: "some-service"})).To(Succeed())
+			Expect(store.CreateBindingDetails("456", brokerapi.BindDetails{AppGUID: "some-app"})).To(Succeed())
+		})
+
+		It("reports an instance that differs from the stored one", func() {
+			Expect(store.IsInstanceConflict("123", brokerstore.ServiceInstance{ServiceID: "some-service"})).To(BeFalse())
+			Expect(store.IsInstanceConflict("123", brokerstore.ServiceInstance{ServiceID: "some-other-service"})).To(BeTrue())
+			Expect(store.IsInstanceConflict("999", brokerstore.ServiceInstance{ServiceID: "some-other-service"})).To(BeFalse())
+		})
+
+		It("reports a binding that differs from the stored one", func() {
+			Expect(store.IsBindingConflict("456", brokerapi.BindDetails{AppGUID: "some-app"})).To(BeFalse())
+			Expect(store.IsBindingConflict("456", brokerapi.BindDetails{AppGUID: "some-other-app"})).To(BeTrue())
+		})
+
+		It("does not report a binding whose parameters were already hashed", func() {
+			hashed := []byte(`{"paramsHash":"some-hash"}`)
+			Expect(store.CreateBindingDetails("789", brokerapi.BindDetails{AppGUID: "some-app", RawParameters: hashed})).To(Succeed())
+
+			Expect(store.IsBindingConflict("789", brokerapi.BindDetails{AppGUID: "some-app", RawParameters: hashed})).To(BeFalse())
+			Expect(store.IsBindingConflict("789", brokerapi.BindDetails{AppGUID: "some-app", RawParameters: []byte(`{ "paramsHash": "some-hash" }`)})).To(BeFalse())
+			Expect(store.IsBindingConflict("789", brokerapi.BindDetails{AppGUID: "some-app", RawParameters: []byte(`{"paramsHash":"other-hash"}`)})).To(BeTrue())
+		})
+
+		It("reports details that CredHub does not hold as absent", func() {
+			_, err := store.RetrieveInstanceDetails("999")
+			Expect(err).To(Equal(brokerapi.ErrInstanceDoesNotExist))
+			_, err = store.RetrieveBindingDetails("999")
+			Expect(err).To(Equal(brokerapi.ErrBindingDoesNotExist))
+
+			Expect(store.CompareInstanceDetails("999", brokerstore.ServiceInstance{ServiceID: "some-service"})).To(Equal(migrator.Absent))
+			Expect(store.CompareInstanceDetails("123", brokerstore.ServiceInstance{ServiceID: "some-service"})).To(Equal(migrator.Identical))
+		})
+
+		Context("when CredHub cannot be read", func() {
+			BeforeEach(func() {
+				fakeCredhub.GetLatestJSONReturns(credentials.JSON{}, errors.New("credhub-unavailable"))
+				fakeCredhub.GetLatestJSONStub = nil
+			})
+
+			It("returns the error rather than taking the details for absent", func() {
+				_, err := store.CompareBindingDetails("456", brokerapi.BindDetails{AppGUID: "some-app"})
+				Expect(err).To(MatchError("credhub-unavailable"))
+				Expect(store.IsBindingConflict("456", brokerapi.BindDetails{AppGUID: "some-app"})).To(BeTrue())
+			})
+		})
+	})
+
+	It("locates details under the store namespace", func() {
+		Expect(store.InstanceLocation("123")).To(Equal("/some-store-id/123"))
+		Expect(store.BindingLocation("456")).To(Equal("/some-store-id/456"))
+		Expect(store.MarkerLocation()).To(Equal("/some-store-id/migrated-from-sql"))
+	})
+
+	It("describes itself by its namespace", func() {
+		Expect(store.String()).To(Equal("credhub:/some-store-id"))
+	})
+})
+
+// newInMemoryCredhub returns a fake that keeps the latest version of each
+// credential it is given.
+func newInMemoryCredhub() *fakes.FakeCredhub {
+	fakeCredhub := &fakes.FakeCredhub{}
+	creds := map[string]interface{}{}
+
+	fakeCredhub.SetJSONStub = func(name string, value values.JSON) (credentials.JSON, error) {
+		creds[name] = value
+		return credentials.JSON{Value: value}, nil
+	}
+	fakeCredhub.SetValueStub = func(name string, value values.Value) (credentials.Value, error) {
+		creds[name] = value
+		return credentials.Value{Value: value}, nil
+	}
+	fakeCredhub.GetLatestJSONStub = func(name string) (credentials.JSON, error) {
+		value, ok := creds[name].(values.JSON)
+		if !ok {
+			return credentials.JSON{}, &credhub.NotFoundError{Description: "The request could not be completed because the credential does not exist or you do not have sufficient authorization."}
+		}
+		return credentials.JSON{Value: value}, nil
+	}
+	fakeCredhub.FindByPathStub = func(path string) (credentials.FindResults, error) {
+		var names []string
+		for name := range creds {
+			if name == path || strings.HasPrefix(name, path+"/") {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+
+		results := credentials.FindResults{}
+		for _, name := range names {
+			results.Credentials = append(results.Credentials, credentials.Base{Name: name})
+		}
+		return results, nil
+	}
+	fakeCredhub.DeleteStub = func(name string) error {
+		delete(creds, name)
+		return nil
+	}
+
+	return fakeCredhub
+}
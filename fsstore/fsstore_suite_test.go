@@ -0,0 +1,13 @@
+package fsstore_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestFsstore(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Fsstore Suite")
+}
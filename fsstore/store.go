@@ -0,0 +1,275 @@
+package fsstore
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/migrate_mysql_to_credhub/migrator"
+	"code.cloudfoundry.org/service-broker-store/brokerstore"
+	"github.com/pivotal-cf/brokerapi"
+)
+
+const (
+	activationMarker = "migrated-from-another-store"
+	retirementMarker = "migrated-to-another-store"
+
+	extension = ".json"
+)
+
+// Store keeps broker details in a directory, as one JSON file per detail at
+// <dir>/<storeID>/instances/<id>.json and <dir>/<storeID>/bindings/<id>.json,
+// with its activation and retirement markers as files beside them. IDs are
+// escaped to name their files. Every file is written to a temporary
+// file first and renamed into place, so that a detail is either written in
+// full or not at all.
+type Store struct {
+	migrator.StoreComparer
+	migrator.WriteThrough
+	logger lager.Logger
+	base   string
+}
+
+func NewStore(logger lager.Logger, dir, storeID string) *Store {
+	s := &Store{
+		logger: logger,
+		base:   filepath.Join(dir, storeID),
+	}
+	s.StoreComparer = migrator.NewStoreComparer(s.RetrieveInstanceDetails, s.RetrieveBindingDetails)
+	return s
+}
+
+func (s *Store) String() string {
+	return "filesystem:" + s.base
+}
+
+func (s *Store) Activate() error {
+	s.logger.Info("activating-filesystem")
+	return s.write(filepath.Join(s.base, activationMarker), []byte("true\n"))
+}
+
+func (s *Store) IsActivated() (bool, error) {
+	return s.isMarked(activationMarker)
+}
+
+func (s *Store) Deactivate() error {
+	s.logger.Info("deactivating-filesystem")
+	return s.remove(filepath.Join(s.base, activationMarker))
+}
+
+func (s *Store) Retire() error {
+	s.logger.Info("retiring-filesystem")
+	return s.write(filepath.Join(s.base, retirementMarker), []byte("true\n"))
+}
+
+func (s *Store) IsRetired() (bool, error) {
+	return s.isMarked(retirementMarker)
+}
+
+func (s *Store) Unretire() error {
+	s.logger.Info("unretiring-filesystem")
+	return s.remove(filepath.Join(s.base, retirementMarker))
+}
+
+func (s *Store) CreateInstanceDetails(id string, details brokerstore.ServiceInstance) error {
+	logger := s.logger.Session("create-instance-details")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	return s.put(s.InstanceLocation(id), details)
+}
+
+func (s *Store) CreateBindingDetails(id string, details brokerapi.BindDetails) error {
+	logger := s.logger.Session("create-binding-details")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	return s.put(s.BindingLocation(id), details)
+}
+
+func (s *Store) RetrieveInstanceDetails(id string) (brokerstore.ServiceInstance, error) {
+	var serviceInstance brokerstore.ServiceInstance
+	err := s.get(s.InstanceLocation(id), &serviceInstance)
+	if os.IsNotExist(err) {
+		return brokerstore.ServiceInstance{}, brokerapi.ErrInstanceDoesNotExist
+	}
+	if err != nil {
+		return brokerstore.ServiceInstance{}, err
+	}
+	return serviceInstance, nil
+}
+
+func (s *Store) RetrieveBindingDetails(id string) (brokerapi.BindDetails, error) {
+	var bindDetails brokerapi.BindDetails
+	err := s.get(s.BindingLocation(id), &bindDetails)
+	if os.IsNotExist(err) {
+		return brokerapi.BindDetails{}, brokerapi.ErrBindingDoesNotExist
+	}
+	if err != nil {
+		return brokerapi.BindDetails{}, err
+	}
+	return bindDetails, nil
+}
+
+func (s *Store) RetrieveAllInstanceDetails() (map[string]brokerstore.ServiceInstance, error) {
+	logger := s.logger.Session("retrieve-all-instance-details")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	serviceInstances := map[string]brokerstore.ServiceInstance{}
+	err := s.retrieveUnder(logger, "instances", func(id string) error {
+		serviceInstance, err := s.RetrieveInstanceDetails(id)
+		serviceInstances[id] = serviceInstance
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return serviceInstances, nil
+}
+
+func (s *Store) RetrieveAllBindingDetails() (map[string]brokerapi.BindDetails, error) {
+	logger := s.logger.Session("retrieve-all-binding-details")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	bindingDetails := map[string]brokerapi.BindDetails{}
+	err := s.retrieveUnder(logger, "bindings", func(id string) error {
+		bindDetails, err := s.RetrieveBindingDetails(id)
+		bindingDetails[id] = bindDetails
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return bindingDetails, nil
+}
+
+func (s *Store) DeleteInstanceDetails(id string) error {
+	return s.remove(s.InstanceLocation(id))
+}
+
+func (s *Store) DeleteBindingDetails(id string) error {
+	return s.remove(s.BindingLocation(id))
+}
+
+func (s *Store) InstanceLocation(id string) string {
+	return filepath.Join(s.base, "instances", fileName(id))
+}
+
+func (s *Store) BindingLocation(id string) string {
+	return filepath.Join(s.base, "bindings", fileName(id))
+}
+
+func (s *Store) MarkerLocation() string {
+	return filepath.Join(s.base, activationMarker)
+}
+
+func (s *Store) RetirementMarkerLocation() string {
+	return filepath.Join(s.base, retirementMarker)
+}
+
+// fileName path escapes an ID, and escapes a leading dot as well, so that
+// the file of a detail is never hidden or taken for a temporary file.
+func fileName(id string) string {
+	name := url.PathEscape(id)
+	if strings.HasPrefix(name, ".") {
+		name = "%2E" + name[1:]
+	}
+	return name + extension
+}
+
+func (s *Store) isMarked(name string) (bool, error) {
+	_, err := os.Stat(filepath.Join(s.base, name))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *Store) put(path string, details interface{}) error {
+	data, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+	return s.write(path, data)
+}
+
+func (s *Store) get(path string, details interface{}) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, details)
+}
+
+// write replaces the file at path by writing a temporary file beside it and
+// renaming that into place.
+func (s *Store) write(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return err
+	}
+
+	file, err := ioutil.TempFile(dir, "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+func (s *Store) remove(path string) error {
+	err := os.Remove(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// retrieveUnder calls found with the ID of every detail file in the given
+// folder of the store, leaving out temporary files and anything else in it.
+func (s *Store) retrieveUnder(logger lager.Logger, folder string, found func(id string) error) error {
+	dir := filepath.Join(s.base, folder)
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		logger.Error("failed-to-list-files", err, lager.Data{"path": dir})
+		return err
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Mode().IsRegular() || strings.HasPrefix(name, ".") || !strings.HasSuffix(name, extension) {
+			continue
+		}
+		id, err := url.PathUnescape(strings.TrimSuffix(name, extension))
+		if err != nil {
+			continue
+		}
+		err = found(id)
+		if err != nil {
+			logger.Error("failed-to-read-file", err, lager.Data{"path": filepath.Join(dir, name)})
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package fsstore_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf/brokerapi"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/migrate_mysql_to_credhub/fsstore"
+	"code.cloudfoundry.org/migrate_mysql_to_credhub/migrator"
+	"code.cloudfoundry.org/migrate_mysql_to_credhub/storetest"
+	"code.cloudfoundry.org/service-broker-store/brokerstore"
+)
+
+var _ = Describe("Store", func() {
+	var (
+		dir   string
+		store *fsstore.Store
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "fsstore-test")
+		Expect(err).NotTo(HaveOccurred())
+
+		store = fsstore.NewStore(lagertest.NewTestLogger("fsstore-test"), dir, "some-store-id")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	storetest.ItBehavesLikeAStore(func() storetest.Store { return store })
+
+	It("describes itself by its directory", func() {
+		Expect(store.String()).To(Equal("filesystem:" + filepath.Join(dir, "some-store-id")))
+	})
+
+	It("locates details and markers by path", func() {
+		Expect(store.InstanceLocation("123")).To(Equal(filepath.Join(dir, "some-store-id", "instances", "123.json")))
+		Expect(store.BindingLocation("456")).To(Equal(filepath.Join(dir, "some-store-id", "bindings", "456.json")))
+		Expect(store.MarkerLocation()).To(Equal(filepath.Join(dir, "some-store-id", "migrated-from-another-store")))
+		Expect(store.RetirementMarkerLocation()).To(Equal(filepath.Join(dir, "some-store-id", "migrated-to-another-store")))
+	})
+
+	It("escapes IDs that are not plain file names", func() {
+		Expect(store.InstanceLocation("../123")).To(Equal(filepath.Join(dir, "some-store-id", "instances", "%2E.%2F123.json")))
+	})
+
+	Context("when the store holds instances and bindings", func() {
+		BeforeEach(func() {
+			Expect(store.CreateInstanceDetails("instance-1", brokerstore.ServiceInstance{ServiceID: "some-service", OrganizationGUID: "some-org"})).To(Succeed())
+			Expect(store.CreateInstanceDetails("../instance-2", brokerstore.ServiceInstance{ServiceID: "some-service"})).To(Succeed())
+			Expect(store.CreateBindingDetails("binding-1", brokerapi.BindDetails{AppGUID: "some-app", RawParameters: []byte(`{"paramsHash":"some-hash"}`)})).To(Succeed())
+		})
+
+		It("writes each detail as a JSON file, leaving no temporary files", func() {
+			b, err := ioutil.ReadFile(filepath.Join(dir, "some-store-id", "instances", "instance-1.json"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(b).To(MatchJSON(`{"service_id":"some-service","plan_id":"","organization_guid":"some-org","space_guid":"","ServiceFingerPrint":null}`))
+
+			files, err := ioutil.ReadDir(filepath.Join(dir, "some-store-id", "instances"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(files).To(HaveLen(2))
+		})
+
+		It("keeps the files to their owner", func() {
+			info, err := os.Stat(store.InstanceLocation("instance-1"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+		})
+
+		It("lists details by their escaped IDs, but not other files", func() {
+			Expect(ioutil.WriteFile(filepath.Join(dir, "some-store-id", "instances", ".instance-3.json.123"), []byte("{"), 0600)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(dir, "some-store-id", "instances", "README"), []byte("notes"), 0600)).To(Succeed())
+
+			instances, err := store.RetrieveAllInstanceDetails()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(instances).To(HaveLen(2))
+			Expect(instances).To(HaveKey("instance-1"))
+			Expect(instances).To(HaveKey("../instance-2"))
+		})
+
+		It("fails to list a detail that is not valid JSON", func() {
+			Expect(ioutil.WriteFile(filepath.Join(dir, "some-store-id", "instances", "instance-3.json"), []byte("{"), 0600)).To(Succeed())
+
+			_, err := store.RetrieveAllInstanceDetails()
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("returns the error of a detail that cannot be read rather than taking it for absent", func() {
+			Expect(ioutil.WriteFile(store.InstanceLocation("instance-1"), []byte("{"), 0600)).To(Succeed())
+
+			_, err := store.CompareInstanceDetails("instance-1", brokerstore.ServiceInstance{ServiceID: "some-service"})
+			Expect(err).To(HaveOccurred())
+			Expect(store.IsInstanceConflict("instance-1", brokerstore.ServiceInstance{ServiceID: "some-service"})).To(BeTrue())
+		})
+	})
+
+	Context("when the directory does not exist", func() {
+		It("lists nothing", func() {
+			store = fsstore.NewStore(lagertest.NewTestLogger("fsstore-test"), filepath.Join(dir, "missing"), "some-store-id")
+
+			instances, err := store.RetrieveAllInstanceDetails()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(instances).To(BeEmpty())
+			Expect(store.IsActivated()).To(BeFalse())
+		})
+	})
+
+	It("keeps the markers as files", func() {
+		Expect(store.Activate()).To(Succeed())
+		Expect(store.Retire()).To(Succeed())
+		Expect(store.MarkerLocation()).To(BeARegularFile())
+		Expect(store.RetirementMarkerLocation()).To(BeARegularFile())
+	})
+
+	Context("when it is the source and target of migrations", func() {
+		var other *fsstore.Store
+
+		BeforeEach(func() {
+			Expect(store.CreateInstanceDetails("123", brokerstore.ServiceInstance{ServiceID: "some-service", OrganizationGUID: "some-org"})).To(Succeed())
+			Expect(store.CreateBindingDetails("456", brokerapi.BindDetails{AppGUID: "some-app", RawParameters: []byte(`{"paramsHash":"some-hash"}`)})).To(Succeed())
+
+			other = fsstore.NewStore(lagertest.NewTestLogger("fsstore-test"), dir, "other-store-id")
+		})
+
+		It("migrates to another directory and rolls back by unretiring the source and deactivating the target", func() {
+			m := migrator.NewMigrator(lagertest.NewTestLogger("migrator-test"))
+			source, target := migrator.Between(store, other, false)
+			_, err := m.Migrate(source, target)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(other.IsActivated()).To(BeTrue())
+			Expect(store.IsRetired()).To(BeTrue())
+
+			source, target = migrator.Between(store, other, true)
+			_, err = m.Migrate(source, target)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(store.IsRetired()).To(BeFalse())
+			Expect(other.IsActivated()).To(BeFalse())
+		})
+	})
+})
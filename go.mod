@@ -3,10 +3,11 @@ module code.cloudfoundry.org/migrate_mysql_to_credhub
 go 1.12
 
 require (
-	code.cloudfoundry.org/credhub-cli v0.0.0-20190923163340-a6d1ba3b23bd // indirect
-	code.cloudfoundry.org/goshims v0.0.0-20190529192408-bb24d2ef71ff // indirect
+	code.cloudfoundry.org/credhub-cli v0.0.0-20190923163340-a6d1ba3b23bd
+	code.cloudfoundry.org/goshims v0.0.0-20190529192408-bb24d2ef71ff
 	code.cloudfoundry.org/lager v2.0.0+incompatible
 	code.cloudfoundry.org/service-broker-store v0.0.0-20190610232902-34215b620ad1
+	github.com/DATA-DOG/go-sqlmock v1.4.1
 	github.com/cloudfoundry/go-socks5 v0.0.0-20180221174514-54f73bdb8a8e // indirect
 	github.com/cloudfoundry/socks5-proxy v0.2.0 // indirect
 	github.com/drewolson/testflight v1.0.0 // indirect
@@ -14,11 +15,17 @@ require (
 	github.com/gorilla/mux v1.7.3 // indirect
 	github.com/hashicorp/go-version v1.2.0 // indirect
 	github.com/jessevdk/go-flags v1.4.0
+	github.com/lib/pq v1.3.0
 	github.com/onsi/ginkgo v1.10.2
 	github.com/onsi/gomega v1.7.0
 	github.com/pborman/uuid v1.2.0 // indirect
 	github.com/pivotal-cf/brokerapi v6.4.2+incompatible
 	github.com/pkg/errors v0.8.1 // indirect
-	golang.org/x/crypto v0.0.0-20191010185427-af544f31c8ac // indirect
+	golang.org/x/crypto v0.0.0-20191010185427-af544f31c8ac
 	google.golang.org/appengine v1.6.5 // indirect
+	gopkg.in/DATA-DOG/go-sqlmock.v1 v1.3.0 // indirect
+	gopkg.in/yaml.v2 v2.2.4
+	k8s.io/api v0.17.0
+	k8s.io/apimachinery v0.17.0
+	k8s.io/client-go v0.17.0
 )
@@ -0,0 +1,13 @@
+package k8sstore_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestK8sstore(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "K8sstore Suite")
+}
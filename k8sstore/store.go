@@ -0,0 +1,343 @@
+package k8sstore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/migrate_mysql_to_credhub/migrator"
+	"code.cloudfoundry.org/service-broker-store/brokerstore"
+	"github.com/pivotal-cf/brokerapi"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	activationMarker = "migrated-from-another-store"
+	retirementMarker = "migrated-to-another-store"
+
+	// StoreIDLabel and KindLabel label every Secret of a store, and
+	// IDAnnotation holds the ID of the instance or binding it keeps.
+	StoreIDLabel = "broker-store.cloudfoundry.org/store-id"
+	KindLabel    = "broker-store.cloudfoundry.org/kind"
+	IDAnnotation = "broker-store.cloudfoundry.org/id"
+
+	// DetailsKey is the key of the Secret data holding the details as JSON.
+	DetailsKey = "details"
+
+	instanceKind = "instance"
+	bindingKind  = "binding"
+)
+
+// Store keeps broker details in Kubernetes Secrets, one per instance or
+// binding, labelled with the store ID and their kind. Its activation and
+// retirement markers are keys of the <storeID>-migration-state ConfigMap.
+type Store struct {
+	migrator.StoreComparer
+	migrator.WriteThrough
+	logger    lager.Logger
+	client    kubernetes.Interface
+	namespace string
+	storeID   string
+}
+
+// NewStore returns a store in the given namespace. The store ID names and
+// labels its Secrets and ConfigMap, so it must be a valid DNS-1123 label.
+func NewStore(logger lager.Logger, client kubernetes.Interface, namespace, storeID string) (*Store, error) {
+	if errs := validation.IsDNS1123Label(storeID); len(errs) > 0 {
+		return nil, fmt.Errorf("store ID %q cannot name Kubernetes objects: %s", storeID, strings.Join(errs, ", "))
+	}
+	s := &Store{
+		logger:    logger,
+		client:    client,
+		namespace: namespace,
+		storeID:   storeID,
+	}
+	s.StoreComparer = migrator.NewStoreComparer(s.RetrieveInstanceDetails, s.RetrieveBindingDetails)
+	return s, nil
+}
+
+func (s *Store) String() string {
+	return "kubernetes:" + s.namespace + "/" + s.storeID
+}
+
+func (s *Store) Activate() error {
+	s.logger.Info("activating-kubernetes")
+	return s.mark(activationMarker, true)
+}
+
+func (s *Store) IsActivated() (bool, error) {
+	return s.isMarked(activationMarker)
+}
+
+func (s *Store) Deactivate() error {
+	s.logger.Info("deactivating-kubernetes")
+	return s.mark(activationMarker, false)
+}
+
+func (s *Store) Retire() error {
+	s.logger.Info("retiring-kubernetes")
+	return s.mark(retirementMarker, true)
+}
+
+func (s *Store) IsRetired() (bool, error) {
+	return s.isMarked(retirementMarker)
+}
+
+func (s *Store) Unretire() error {
+	s.logger.Info("unretiring-kubernetes")
+	return s.mark(retirementMarker, false)
+}
+
+func (s *Store) CreateInstanceDetails(id string, details brokerstore.ServiceInstance) error {
+	logger := s.logger.Session("create-instance-details")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	return s.put(instanceKind, id, details)
+}
+
+func (s *Store) CreateBindingDetails(id string, details brokerapi.BindDetails) error {
+	logger := s.logger.Session("create-binding-details")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	return s.put(bindingKind, id, details)
+}
+
+func (s *Store) RetrieveInstanceDetails(id string) (brokerstore.ServiceInstance, error) {
+	var serviceInstance brokerstore.ServiceInstance
+	err := s.get(instanceKind, id, &serviceInstance)
+	if apierrors.IsNotFound(err) {
+		return brokerstore.ServiceInstance{}, brokerapi.ErrInstanceDoesNotExist
+	}
+	if err != nil {
+		return brokerstore.ServiceInstance{}, err
+	}
+	return serviceInstance, nil
+}
+
+func (s *Store) RetrieveBindingDetails(id string) (brokerapi.BindDetails, error) {
+	var bindDetails brokerapi.BindDetails
+	err := s.get(bindingKind, id, &bindDetails)
+	if apierrors.IsNotFound(err) {
+		return brokerapi.BindDetails{}, brokerapi.ErrBindingDoesNotExist
+	}
+	if err != nil {
+		return brokerapi.BindDetails{}, err
+	}
+	return bindDetails, nil
+}
+
+func (s *Store) RetrieveAllInstanceDetails() (map[string]brokerstore.ServiceInstance, error) {
+	logger := s.logger.Session("retrieve-all-instance-details")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	serviceInstances := map[string]brokerstore.ServiceInstance{}
+	err := s.retrieveAll(logger, instanceKind, func(id string, data []byte) error {
+		var serviceInstance brokerstore.ServiceInstance
+		err := json.Unmarshal(data, &serviceInstance)
+		serviceInstances[id] = serviceInstance
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return serviceInstances, nil
+}
+
+func (s *Store) RetrieveAllBindingDetails() (map[string]brokerapi.BindDetails, error) {
+	logger := s.logger.Session("retrieve-all-binding-details")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	bindingDetails := map[string]brokerapi.BindDetails{}
+	err := s.retrieveAll(logger, bindingKind, func(id string, data []byte) error {
+		var bindDetails brokerapi.BindDetails
+		err := json.Unmarshal(data, &bindDetails)
+		bindingDetails[id] = bindDetails
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return bindingDetails, nil
+}
+
+func (s *Store) DeleteInstanceDetails(id string) error {
+	return s.delete(instanceKind, id)
+}
+
+func (s *Store) DeleteBindingDetails(id string) error {
+	return s.delete(bindingKind, id)
+}
+
+func (s *Store) InstanceLocation(id string) string {
+	return "secret/" + s.namespace + "/" + s.secretName(instanceKind, id)
+}
+
+func (s *Store) BindingLocation(id string) string {
+	return "secret/" + s.namespace + "/" + s.secretName(bindingKind, id)
+}
+
+func (s *Store) MarkerLocation() string {
+	return "configmap/" + s.namespace + "/" + s.configMapName() + "#" + activationMarker
+}
+
+func (s *Store) RetirementMarkerLocation() string {
+	return "configmap/" + s.namespace + "/" + s.configMapName() + "#" + retirementMarker
+}
+
+// secretName names the Secret of an instance or binding by a hash of its ID,
+// as IDs need not be valid Kubernetes names.
+func (s *Store) secretName(kind, id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return s.storeID + "-" + kind + "-" + hex.EncodeToString(sum[:20])
+}
+
+func (s *Store) configMapName() string {
+	return s.storeID + "-migration-state"
+}
+
+func (s *Store) labels(kind string) map[string]string {
+	return map[string]string{
+		StoreIDLabel: s.storeID,
+		KindLabel:    kind,
+	}
+}
+
+// put creates the Secret of an instance or binding, or replaces the details
+// it holds.
+func (s *Store) put(kind, id string, details interface{}) error {
+	data, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        s.secretName(kind, id),
+			Namespace:   s.namespace,
+			Labels:      s.labels(kind),
+			Annotations: map[string]string{IDAnnotation: id},
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{DetailsKey: data},
+	}
+
+	secrets := s.client.CoreV1().Secrets(s.namespace)
+	_, err = secrets.Create(secret)
+	if !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+
+	existing, err := secrets.Get(secret.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	secret.ResourceVersion = existing.ResourceVersion
+	_, err = secrets.Update(secret)
+	return err
+}
+
+func (s *Store) get(kind, id string, details interface{}) error {
+	secret, err := s.client.CoreV1().Secrets(s.namespace).Get(s.secretName(kind, id), metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(secret.Data[DetailsKey], details)
+}
+
+func (s *Store) delete(kind, id string) error {
+	err := s.client.CoreV1().Secrets(s.namespace).Delete(s.secretName(kind, id), &metav1.DeleteOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// retrieveAll calls found with the ID and details of every Secret of the
+// given kind in the store, a page at a time.
+func (s *Store) retrieveAll(logger lager.Logger, kind string, found func(id string, data []byte) error) error {
+	listOptions := metav1.ListOptions{
+		LabelSelector: StoreIDLabel + "=" + s.storeID + "," + KindLabel + "=" + kind,
+		Limit:         500,
+	}
+	for {
+		list, err := s.client.CoreV1().Secrets(s.namespace).List(listOptions)
+		if err != nil {
+			logger.Error("failed-to-list-secrets", err, lager.Data{"namespace": s.namespace, "kind": kind})
+			return err
+		}
+
+		for _, secret := range list.Items {
+			err = found(secret.Annotations[IDAnnotation], secret.Data[DetailsKey])
+			if err != nil {
+				logger.Error("failed-to-read-secret", err, lager.Data{"namespace": s.namespace, "name": secret.Name})
+				return err
+			}
+		}
+
+		if list.Continue == "" {
+			return nil
+		}
+		listOptions.Continue = list.Continue
+	}
+}
+
+func (s *Store) isMarked(name string) (bool, error) {
+	configMap, err := s.client.CoreV1().ConfigMaps(s.namespace).Get(s.configMapName(), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	_, marked := configMap.Data[name]
+	return marked, nil
+}
+
+// mark sets or removes a marker in the ConfigMap of the store, creating the
+// ConfigMap when there is none.
+func (s *Store) mark(name string, set bool) error {
+	configMaps := s.client.CoreV1().ConfigMaps(s.namespace)
+	configMap, err := configMaps.Get(s.configMapName(), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		if !set {
+			return nil
+		}
+		_, err = configMaps.Create(&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      s.configMapName(),
+				Namespace: s.namespace,
+				Labels:    map[string]string{StoreIDLabel: s.storeID},
+			},
+			Data: map[string]string{name: "true"},
+		})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	if set {
+		if configMap.Data == nil {
+			configMap.Data = map[string]string{}
+		}
+		configMap.Data[name] = "true"
+	} else {
+		if _, marked := configMap.Data[name]; !marked {
+			return nil
+		}
+		delete(configMap.Data, name)
+	}
+	_, err = configMaps.Update(configMap)
+	return err
+}
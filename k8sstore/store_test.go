@@ -0,0 +1,163 @@
+package k8sstore_test
+
+import (
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf/brokerapi"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/migrate_mysql_to_credhub/k8sstore"
+	"code.cloudfoundry.org/migrate_mysql_to_credhub/storetest"
+	"code.cloudfoundry.org/service-broker-store/brokerstore"
+)
+
+var _ = Describe("Store", func() {
+	var (
+		clientset *fake.Clientset
+		store     *k8sstore.Store
+	)
+
+	BeforeEach(func() {
+		clientset = fake.NewSimpleClientset()
+
+		var err error
+		store, err = k8sstore.NewStore(lagertest.NewTestLogger("k8sstore-test"), clientset, "some-namespace", "some-store-id")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("refuses a store ID that cannot name Kubernetes objects", func() {
+		_, err := k8sstore.NewStore(lagertest.NewTestLogger("k8sstore-test"), clientset, "some-namespace", "Some_Store")
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring(`store ID "Some_Store" cannot name Kubernetes objects`))
+	})
+
+	It("describes itself by namespace and store ID", func() {
+		Expect(store.String()).To(Equal("kubernetes:some-namespace/some-store-id"))
+	})
+
+	It("locates markers in the ConfigMap of the store", func() {
+		Expect(store.MarkerLocation()).To(Equal("configmap/some-namespace/some-store-id-migration-state#migrated-from-another-store"))
+		Expect(store.RetirementMarkerLocation()).To(Equal("configmap/some-namespace/some-store-id-migration-state#migrated-to-another-store"))
+	})
+
+	storetest.ItBehavesLikeAStore(func() storetest.Store { return store })
+
+	Context("when the store holds instances and bindings", func() {
+		BeforeEach(func() {
+			Expect(store.CreateInstanceDetails("instance-1", brokerstore.ServiceInstance{ServiceID: "some-service", OrganizationGUID: "some-org"})).To(Succeed())
+			Expect(store.CreateInstanceDetails("Instance_2", brokerstore.ServiceInstance{ServiceID: "some-service", ServiceFingerPrint: map[string]interface{}{"share": "some-share"}})).To(Succeed())
+			Expect(store.CreateBindingDetails("binding-1", brokerapi.BindDetails{AppGUID: "some-app", RawParameters: []byte(`{"paramsHash":"some-hash"}`)})).To(Succeed())
+		})
+
+		It("keeps each detail in a Secret labelled with the store ID and its kind", func() {
+			secrets, err := clientset.CoreV1().Secrets("some-namespace").List(metav1.ListOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(secrets.Items).To(HaveLen(3))
+
+			for _, secret := range secrets.Items {
+				Expect(secret.Labels).To(HaveKeyWithValue(k8sstore.StoreIDLabel, "some-store-id"))
+				Expect("secret/some-namespace/" + secret.Name).To(SatisfyAny(
+					Equal(store.InstanceLocation(secret.Annotations[k8sstore.IDAnnotation])),
+					Equal(store.BindingLocation(secret.Annotations[k8sstore.IDAnnotation])),
+				))
+			}
+
+			secret, err := clientset.CoreV1().Secrets("some-namespace").Get(secrets.Items[0].Name, metav1.GetOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(secret.Labels[k8sstore.KindLabel]).To(BeElementOf("instance", "binding"))
+			Expect(secret.Data).To(HaveKey(k8sstore.DetailsKey))
+		})
+
+		It("lists details by IDs that cannot name Kubernetes objects", func() {
+			instances, err := store.RetrieveAllInstanceDetails()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(instances).To(HaveKey("Instance_2"))
+		})
+
+		It("leaves out the Secrets of other stores", func() {
+			other, err := k8sstore.NewStore(lagertest.NewTestLogger("k8sstore-test"), clientset, "some-namespace", "other-store-id")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(other.CreateInstanceDetails("instance-3", brokerstore.ServiceInstance{ServiceID: "some-service"})).To(Succeed())
+
+			instances, err := store.RetrieveAllInstanceDetails()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(instances).NotTo(HaveKey("instance-3"))
+		})
+
+		Context("when the Secrets cannot be read", func() {
+			BeforeEach(func() {
+				clientset.PrependReactor("get", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+					return true, nil, errors.New("forbidden")
+				})
+			})
+
+			It("returns the error rather than taking the details for absent", func() {
+				_, err := store.CompareBindingDetails("binding-1", brokerapi.BindDetails{AppGUID: "some-app"})
+				Expect(err).To(MatchError("forbidden"))
+				Expect(store.IsInstanceConflict("instance-1", brokerstore.ServiceInstance{ServiceID: "some-service", OrganizationGUID: "some-org"})).To(BeTrue())
+			})
+		})
+	})
+
+	Context("when the Secrets cannot be listed", func() {
+		BeforeEach(func() {
+			clientset.PrependReactor("list", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				return true, nil, errors.New("forbidden")
+			})
+		})
+
+		It("returns the error", func() {
+			_, err := store.RetrieveAllInstanceDetails()
+			Expect(err).To(MatchError("forbidden"))
+		})
+	})
+
+	Describe("markers", func() {
+		It("keeps the activation and retirement markers in one ConfigMap", func() {
+			Expect(store.IsActivated()).To(BeFalse())
+			Expect(store.IsRetired()).To(BeFalse())
+
+			Expect(store.Activate()).To(Succeed())
+			Expect(store.Retire()).To(Succeed())
+			Expect(store.IsActivated()).To(BeTrue())
+			Expect(store.IsRetired()).To(BeTrue())
+
+			configMap, err := clientset.CoreV1().ConfigMaps("some-namespace").Get("some-store-id-migration-state", metav1.GetOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(configMap.Labels).To(HaveKeyWithValue(k8sstore.StoreIDLabel, "some-store-id"))
+			Expect(configMap.Data).To(Equal(map[string]string{
+				"migrated-from-another-store": "true",
+				"migrated-to-another-store":   "true",
+			}))
+		})
+
+		It("does not create the ConfigMap to remove a marker", func() {
+			Expect(store.Deactivate()).To(Succeed())
+
+			_, err := clientset.CoreV1().ConfigMaps("some-namespace").Get("some-store-id-migration-state", metav1.GetOptions{})
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("keeps data already in the ConfigMap", func() {
+			_, err := clientset.CoreV1().ConfigMaps("some-namespace").Create(&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "some-store-id-migration-state"},
+				Data:       map[string]string{"other-key": "other-value"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(store.Activate()).To(Succeed())
+
+			configMap, err := clientset.CoreV1().ConfigMaps("some-namespace").Get("some-store-id-migration-state", metav1.GetOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(configMap.Data).To(HaveKeyWithValue("other-key", "other-value"))
+			Expect(configMap.Data).To(HaveKeyWithValue("migrated-from-another-store", "true"))
+		})
+	})
+})
@@ -1,144 +1,790 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
 
 	"code.cloudfoundry.org/lager"
-	"code.cloudfoundry.org/lager/lagerflags"
+	"code.cloudfoundry.org/migrate_mysql_to_credhub/credhubstore"
+	"code.cloudfoundry.org/migrate_mysql_to_credhub/fsstore"
+	"code.cloudfoundry.org/migrate_mysql_to_credhub/k8sstore"
 	"code.cloudfoundry.org/migrate_mysql_to_credhub/migrator"
-	"code.cloudfoundry.org/service-broker-store/brokerstore"
+	"code.cloudfoundry.org/migrate_mysql_to_credhub/sqlstore"
+	"code.cloudfoundry.org/migrate_mysql_to_credhub/vaultstore"
 	"code.cloudfoundry.org/service-broker-store/brokerstore/credhub_shims"
 	"github.com/go-sql-driver/mysql"
 	flags "github.com/jessevdk/go-flags"
+	"github.com/lib/pq"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
 )
 
 var opts struct {
-	DBDriver string `long:"dbDriver" description:"Database driver name when using SQL to store broker state" required:"true"`
+	DBDriver string `long:"dbDriver" env:"MIGRATE_DB_DRIVER" choice:"mysql" choice:"postgres" description:"Database driver name when using SQL to store broker state"`
 
-	DBHostname string `long:"dbHostname" description:"Database hostname when using SQL to store broker state" required:"true"`
+	DBHostname string `long:"dbHostname" env:"MIGRATE_DB_HOSTNAME" description:"Database hostname when using SQL to store broker state"`
 
-	DBPort string `long:"dbPort" description:"Database port when using SQL to store broker state" required:"true"`
+	DBPort string `long:"dbPort" env:"MIGRATE_DB_PORT" description:"Database port when using SQL to store broker state"`
 
-	DBName string `long:"dbName" description:"Database name when using SQL to store broker state" required:"true"`
+	DBName string `long:"dbName" env:"MIGRATE_DB_NAME" description:"Database name when using SQL to store broker state"`
 
-	DBUsername string `long:"dbUsername" description:"Database username when using SQL to store broker state" required:"true"`
+	DBUsername string `long:"dbUsername" env:"MIGRATE_DB_USERNAME" description:"Database username when using SQL to store broker state"`
 
-	DBPassword string `long:"dbPassword" description:"Database password when using SQL to store broker state" required:"true"`
+	DBPassword string `long:"dbPassword" env:"MIGRATE_DB_PASSWORD" description:"Database password when using SQL to store broker state"`
 
-	DBCACertPath string `long:"dbCACertPath" description:"Path to CA Cert for database SSL connection"`
+	DBPasswordFile string `long:"dbPasswordFile" env:"MIGRATE_DB_PASSWORD_FILE" description:"Path to a file holding the database password, instead of --dbPassword"`
 
-	DBSkipHostnameValidation bool `long:"dbSkipHostnameValidation" description:"Skip DB server hostname validation when connecting over TLS"`
+	DBCACertPath string `long:"dbCACertPath" env:"MIGRATE_DB_CA_CERT_PATH" description:"Path to CA Cert for database SSL connection"`
 
-	CredhubURL string `long:"credhubURL" description:"CredHub server URL when using CredHub to store broker state" required:"true"`
+	DBSkipHostnameValidation bool `long:"dbSkipHostnameValidation" env:"MIGRATE_DB_SKIP_HOSTNAME_VALIDATION" description:"Skip DB server hostname validation when connecting over TLS"`
 
-	CredhubCACertPath string `long:"credhubCACertPath" description:"Path to CA Cert for CredHub"`
+	CredhubURL string `long:"credhubURL" env:"MIGRATE_CREDHUB_URL" description:"CredHub server URL when using CredHub to store broker state"`
 
-	UAAClientID string `long:"uaaClientID" description:"UAA client ID when using CredHub to store broker state" required:"true"`
+	CredhubCACertPath string `long:"credhubCACertPath" env:"MIGRATE_CREDHUB_CA_CERT_PATH" description:"Path to CA Cert for CredHub"`
 
-	UAAClientSecret string `long:"uaaClientSecret" description:"UAA client secret when using CredHub to store broker state" required:"true"`
+	UAAClientID string `long:"uaaClientID" env:"MIGRATE_UAA_CLIENT_ID" description:"UAA client ID when using CredHub to store broker state"`
 
-	UAACACertPath string `long:"uaaCACertPath" description:"Path to CA Cert for UAA used for CredHub authorization"`
+	UAAClientSecret string `long:"uaaClientSecret" env:"MIGRATE_UAA_CLIENT_SECRET" description:"UAA client secret when using CredHub to store broker state"`
 
-	StoreID string `long:"storeID" description:"Store ID used to namespace instance details and bindings (credhub only)" required:"true"`
+	UAAClientSecretFile string `long:"uaaClientSecretFile" env:"MIGRATE_UAA_CLIENT_SECRET_FILE" description:"Path to a file holding the UAA client secret, instead of --uaaClientSecret"`
 
-	MinLogLevel string `long:"logLevel" default:"info" description:"Log level: debug, info, error or fatal"`
+	UAACACertPath string `long:"uaaCACertPath" env:"MIGRATE_UAA_CA_CERT_PATH" description:"Path to CA Cert for UAA used for CredHub authorization"`
+
+	StoreID string `long:"storeID" env:"MIGRATE_STORE_ID" description:"Store ID used to namespace instance details and bindings (credhub only)" required:"true"`
+
+	CredhubLayout string `long:"credhubLayout" env:"MIGRATE_CREDHUB_LAYOUT" default:"flat" choice:"flat" choice:"split" description:"Keep instances and bindings together at /<storeID>/<id> (flat), or apart at /<storeID>/instances/<id> and /<storeID>/bindings/<id> (split)"`
+
+	CredhubMaxAttempts int `long:"credhubMaxAttempts" env:"MIGRATE_CREDHUB_MAX_ATTEMPTS" default:"5" description:"Number of times a CredHub call is made before giving up"`
+
+	CredhubRetryBackoff time.Duration `long:"credhubRetryBackoff" env:"MIGRATE_CREDHUB_RETRY_BACKOFF" default:"500ms" description:"Delay before retrying a failed CredHub call, doubled with every further retry"`
+
+	CredhubRetryMaxBackoff time.Duration `long:"credhubRetryMaxBackoff" env:"MIGRATE_CREDHUB_RETRY_MAX_BACKOFF" default:"10s" description:"Longest delay between retries of a failed CredHub call"`
+
+	CredhubRetryJitter float64 `long:"credhubRetryJitter" env:"MIGRATE_CREDHUB_RETRY_JITTER" default:"0.2" description:"Fraction by which each retry delay is randomly varied"`
+
+	CredhubRetryStatuses []int `long:"credhubRetryStatus" env:"MIGRATE_CREDHUB_RETRY_STATUSES" env-delim:"," default:"502" default:"503" default:"504" description:"HTTP status of CredHub or UAA responses to retry (can be repeated)"`
+
+	CredhubRetryErrors []string `long:"credhubRetryError" env:"MIGRATE_CREDHUB_RETRY_ERRORS" env-delim:"," default:"server_error" default:"temporarily_unavailable" description:"CredHub error name to retry (can be repeated)"`
+
+	Vault vaultOptions `group:"Vault Options"`
+
+	Kubernetes kubernetesOptions `group:"Kubernetes Options"`
+
+	FSDir string `long:"fsDir" env:"MIGRATE_FS_DIR" description:"Directory to keep broker state in when using the filesystem to store broker state"`
+
+	Target targetOptions `group:"Target Store Options"`
+
+	Config string `long:"config" env:"MIGRATE_CONFIG" description:"Path to a YAML or JSON file of option values keyed by their long names, which options given on the command line or in environment variables override"`
+
+	MinLogLevel string `long:"logLevel" env:"MIGRATE_LOG_LEVEL" default:"info" choice:"debug" choice:"info" choice:"error" choice:"fatal" description:"Level of the JSON lines logged to stderr"`
+}
+
+// targetOptions override the connection options for the store given by
+// --to, so that broker state can be migrated between two databases or two
+// CredHub stores.
+type targetOptions struct {
+	DBDriver string `long:"toDbDriver" env:"MIGRATE_TO_DB_DRIVER" choice:"mysql" choice:"postgres" description:"Database driver name of the target store, instead of --dbDriver"`
+
+	DBHostname string `long:"toDbHostname" env:"MIGRATE_TO_DB_HOSTNAME" description:"Database hostname of the target store, instead of --dbHostname"`
+
+	DBPort string `long:"toDbPort" env:"MIGRATE_TO_DB_PORT" description:"Database port of the target store, instead of --dbPort"`
+
+	DBName string `long:"toDbName" env:"MIGRATE_TO_DB_NAME" description:"Database name of the target store, instead of --dbName"`
+
+	DBUsername string `long:"toDbUsername" env:"MIGRATE_TO_DB_USERNAME" description:"Database username of the target store, instead of --dbUsername"`
+
+	DBPassword string `long:"toDbPassword" env:"MIGRATE_TO_DB_PASSWORD" description:"Database password of the target store, instead of --dbPassword"`
+
+	DBPasswordFile string `long:"toDbPasswordFile" env:"MIGRATE_TO_DB_PASSWORD_FILE" description:"Path to a file holding the database password of the target store, instead of --toDbPassword"`
+
+	DBCACertPath string `long:"toDbCACertPath" env:"MIGRATE_TO_DB_CA_CERT_PATH" description:"Path to CA Cert for the database SSL connection of the target store, instead of --dbCACertPath"`
+
+	CredhubURL string `long:"toCredhubURL" env:"MIGRATE_TO_CREDHUB_URL" description:"CredHub server URL of the target store, instead of --credhubURL"`
+
+	CredhubCACertPath string `long:"toCredhubCACertPath" env:"MIGRATE_TO_CREDHUB_CA_CERT_PATH" description:"Path to CA Cert for the CredHub of the target store, instead of --credhubCACertPath"`
+
+	UAAClientID string `long:"toUaaClientID" env:"MIGRATE_TO_UAA_CLIENT_ID" description:"UAA client ID for the CredHub of the target store, instead of --uaaClientID"`
+
+	UAAClientSecret string `long:"toUaaClientSecret" env:"MIGRATE_TO_UAA_CLIENT_SECRET" description:"UAA client secret for the CredHub of the target store, instead of --uaaClientSecret"`
+
+	UAAClientSecretFile string `long:"toUaaClientSecretFile" env:"MIGRATE_TO_UAA_CLIENT_SECRET_FILE" description:"Path to a file holding the UAA client secret for the CredHub of the target store, instead of --toUaaClientSecret"`
+
+	UAACACertPath string `long:"toUaaCACertPath" env:"MIGRATE_TO_UAA_CA_CERT_PATH" description:"Path to CA Cert for the UAA of the target store, instead of --uaaCACertPath"`
+
+	StoreID string `long:"toStoreID" env:"MIGRATE_TO_STORE_ID" description:"Store ID of the target store, instead of --storeID"`
+
+	CredhubLayout string `long:"toCredhubLayout" env:"MIGRATE_TO_CREDHUB_LAYOUT" choice:"flat" choice:"split" description:"Layout of the target store, instead of --credhubLayout"`
+
+	VaultPathPrefix string `long:"toVaultPathPrefix" env:"MIGRATE_TO_VAULT_PATH_PREFIX" description:"Path prefix of the target store, instead of --vaultPathPrefix"`
+
+	KubeContext string `long:"toKubeContext" env:"MIGRATE_TO_KUBE_CONTEXT" description:"Kubeconfig context of the target store, instead of --kubeContext"`
+
+	KubernetesNamespace string `long:"toKubernetesNamespace" env:"MIGRATE_TO_KUBERNETES_NAMESPACE" description:"Namespace of the target store, instead of --kubernetesNamespace"`
+
+	FSDir string `long:"toFsDir" env:"MIGRATE_TO_FS_DIR" description:"Directory of the target store, instead of --fsDir"`
+}
+
+// vaultOptions are the connection options for a Vault store, which keeps
+// broker state in a KV version 2 secrets engine under
+// <pathPrefix>/<storeID>.
+type vaultOptions struct {
+	Address string `long:"vaultAddr" env:"MIGRATE_VAULT_ADDR" description:"Vault server URL when using Vault to store broker state"`
+
+	CACertPath string `long:"vaultCACertPath" env:"MIGRATE_VAULT_CA_CERT_PATH" description:"Path to CA Cert for Vault"`
+
+	Token string `long:"vaultToken" env:"MIGRATE_VAULT_TOKEN" description:"Vault token, instead of logging in with an AppRole"`
+
+	TokenFile string `long:"vaultTokenFile" env:"MIGRATE_VAULT_TOKEN_FILE" description:"Path to a file holding the Vault token, instead of --vaultToken"`
+
+	RoleID string `long:"vaultRoleID" env:"MIGRATE_VAULT_ROLE_ID" description:"Role ID of the AppRole to log in to Vault with"`
+
+	SecretID string `long:"vaultSecretID" env:"MIGRATE_VAULT_SECRET_ID" description:"Secret ID of the AppRole to log in to Vault with"`
+
+	SecretIDFile string `long:"vaultSecretIDFile" env:"MIGRATE_VAULT_SECRET_ID_FILE" description:"Path to a file holding the secret ID of the AppRole, instead of --vaultSecretID"`
+
+	AppRoleMount string `long:"vaultAppRoleMount" env:"MIGRATE_VAULT_APPROLE_MOUNT" default:"approle" description:"Path the AppRole auth method is mounted at"`
+
+	Mount string `long:"vaultMount" env:"MIGRATE_VAULT_MOUNT" default:"secret" description:"Path the KV version 2 secrets engine is mounted at"`
+
+	PathPrefix string `long:"vaultPathPrefix" env:"MIGRATE_VAULT_PATH_PREFIX" description:"Path under the mount to keep the store namespace in"`
+}
+
+// kubernetesOptions are the connection options for a Kubernetes store, which
+// keeps broker state in Secrets of a namespace labelled with the store ID.
+type kubernetesOptions struct {
+	Kubeconfig string `long:"kubeconfig" env:"MIGRATE_KUBECONFIG" description:"Path to the kubeconfig file when using Kubernetes to store broker state, instead of $KUBECONFIG, ~/.kube/config or the in-cluster service account"`
+
+	Context string `long:"kubeContext" env:"MIGRATE_KUBE_CONTEXT" description:"Kubeconfig context to use, instead of its current context"`
+
+	Namespace string `long:"kubernetesNamespace" env:"MIGRATE_KUBERNETES_NAMESPACE" default:"default" description:"Namespace to keep the Secrets and ConfigMap of the store in"`
 }
 
 func main() {
-	_, err := flags.ParseArgs(&opts, os.Args[1:])
+	parser := flags.NewParser(&opts, flags.Default)
+	for _, command := range commands {
+		_, err := parser.AddCommand(command.name, command.shortDescription, command.longDescription, command.data)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	parser.CommandHandler = func(command flags.Commander, args []string) error {
+		if c, ok := command.(connector); ok {
+			err := checkConnections(c.storeKinds())
+			if err != nil {
+				return err
+			}
+		}
+		return command.Execute(args)
+	}
+
+	err := LoadConfig(parser, os.Args[1:])
 	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	_, err = parser.ParseArgs(os.Args[1:])
+	if err != nil {
+		if flagsErr, ok := err.(*flags.Error); ok && flagsErr.Type == flags.ErrHelp {
+			return
+		}
 		panic(err)
 	}
+}
 
-	logger, _ := lagerflags.NewFromConfig("migrate_mysql_to_credhub", lagerflags.LagerConfig{LogLevel: opts.MinLogLevel})
-	logger.Info("migrating")
-	defer logger.Info("ends")
+// checkConnections reads the secrets given as files of the stores of the
+// given kinds, the source connected to with the shared options and the target
+// with the target store options, and checks that the options those stores
+// require were given. The options of other stores are not needed.
+func checkConnections(source, target string) error {
+	err := readSecrets(source, target)
+	if err != nil {
+		return err
+	}
 
-	var dbCACert string
-	if opts.DBCACertPath != "" {
-		b, err := ioutil.ReadFile(opts.DBCACertPath)
+	err = checkConnection(source, sourceConnections())
+	if err != nil {
+		return err
+	}
+	return checkConnection(target, targetConnections())
+}
+
+// readSecrets reads the secrets given as files into the options that hold
+// them.
+func readSecrets(source, target string) error {
+	var err error
+	// the secrets of the target store fall back to the shared ones
+	t := &opts.Target
+	targetDBPassword := t.DBPassword != "" || t.DBPasswordFile != ""
+	targetUAAClientSecret := t.UAAClientSecret != "" || t.UAAClientSecretFile != ""
+
+	if source == "sql" || (target == "sql" && !targetDBPassword) {
+		opts.DBPassword, err = ReadSecret("dbPassword", opts.DBPassword, opts.DBPasswordFile)
 		if err != nil {
-			logger.Fatal("cannot-read-db-ca-cert", err, lager.Data{"path": opts.DBCACertPath})
+			return err
+		}
+	}
+	if source == "credhub" || (target == "credhub" && !targetUAAClientSecret) {
+		opts.UAAClientSecret, err = ReadSecret("uaaClientSecret", opts.UAAClientSecret, opts.UAAClientSecretFile)
+		if err != nil {
+			return err
 		}
-		dbCACert = string(b)
 	}
 
-	var credhubCACert string
-	if opts.CredhubCACertPath != "" {
-		b, err := ioutil.ReadFile(opts.CredhubCACertPath)
+	if source == "vault" || target == "vault" {
+		if opts.Vault.Token != "" || opts.Vault.TokenFile != "" {
+			opts.Vault.Token, err = ReadSecret("vaultToken", opts.Vault.Token, opts.Vault.TokenFile)
+			if err != nil {
+				return err
+			}
+		}
+		if opts.Vault.SecretID != "" || opts.Vault.SecretIDFile != "" {
+			opts.Vault.SecretID, err = ReadSecret("vaultSecretID", opts.Vault.SecretID, opts.Vault.SecretIDFile)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if target == "sql" && targetDBPassword {
+		t.DBPassword, err = ReadSecret("toDbPassword", t.DBPassword, t.DBPasswordFile)
 		if err != nil {
-			logger.Fatal("cannot-read-credhub-ca-cert", err, lager.Data{"path": opts.CredhubCACertPath})
+			return err
 		}
-		credhubCACert = string(b)
 	}
+	if target == "credhub" && targetUAAClientSecret {
+		t.UAAClientSecret, err = ReadSecret("toUaaClientSecret", t.UAAClientSecret, t.UAAClientSecretFile)
+	}
+	return err
+}
 
-	var uaaCACert string
-	if opts.UAACACertPath != "" {
-		b, err := ioutil.ReadFile(opts.UAACACertPath)
+// checkConnection returns an error naming the first option that a store of
+// the given kind cannot be connected to without, and that was not given. The
+// Vault and filesystem stores check their options as they are opened.
+func checkConnection(kind string, c connections) error {
+	var required []struct{ name, value string }
+	switch kind {
+	case "sql":
+		required = []struct{ name, value string }{
+			{"dbDriver", c.db.driver},
+			{"dbHostname", c.db.hostname},
+			{"dbPort", c.db.port},
+			{"dbName", c.db.name},
+			{"dbUsername", c.db.username},
+		}
+	case "credhub":
+		required = []struct{ name, value string }{
+			{"credhubURL", c.credhub.url},
+			{"uaaClientID", c.credhub.uaaClientID},
+		}
+	}
+
+	for _, option := range required {
+		if option.value == "" {
+			return &flags.Error{
+				Type:    flags.ErrRequired,
+				Message: fmt.Sprintf("the required flag `--%s' was not specified", option.name),
+			}
+		}
+	}
+	return nil
+}
+
+// newLogger logs JSON lines to stderr, leaving stdout to the tables that the
+// commands write.
+func newLogger() lager.Logger {
+	level, _ := lager.LogLevelFromString(opts.MinLogLevel)
+	logger := lager.NewLogger("migrate_mysql_to_credhub")
+	logger.RegisterSink(lager.NewWriterSink(os.Stderr, level))
+	return logger
+}
+
+// sqlConnection is how to connect to a SQL store.
+type sqlConnection struct {
+	driver                 string
+	hostname               string
+	port                   string
+	name                   string
+	username               string
+	password               string
+	caCertPath             string
+	skipHostnameValidation bool
+}
+
+// String names the database, as the store connected to it does.
+func (c sqlConnection) String() string {
+	return fmt.Sprintf("%s://%s:%s/%s", c.driver, c.hostname, c.port, c.name)
+}
+
+// credhubConnection is how to connect to a CredHub store.
+type credhubConnection struct {
+	url             string
+	caCertPath      string
+	uaaClientID     string
+	uaaClientSecret string
+	uaaCACertPath   string
+	storeID         string
+	layout          string
+}
+
+// String names the CredHub server and the namespace of the store.
+func (c credhubConnection) String() string {
+	return strings.TrimSuffix(c.url, "/") + "/" + c.storeID
+}
+
+// vaultConnection is how to connect to a Vault store.
+type vaultConnection struct {
+	address      string
+	caCertPath   string
+	token        string
+	roleID       string
+	secretID     string
+	appRoleMount string
+	mount        string
+	pathPrefix   string
+	storeID      string
+}
+
+// String names the Vault server and the path of the store.
+func (c vaultConnection) String() string {
+	return strings.TrimSuffix(c.address, "/") + "/" + path.Join(c.mount, c.pathPrefix, c.storeID)
+}
+
+// kubernetesConnection is how to connect to a Kubernetes store.
+type kubernetesConnection struct {
+	kubeconfig string
+	context    string
+	namespace  string
+	storeID    string
+}
+
+// String names the kubeconfig context and the namespace of the store.
+func (c kubernetesConnection) String() string {
+	return fmt.Sprintf("kubernetes:%s@%s/%s/%s", c.context, c.kubeconfig, c.namespace, c.storeID)
+}
+
+// fsConnection is where to find a filesystem store.
+type fsConnection struct {
+	dir     string
+	storeID string
+}
+
+// String names the directory of the store.
+func (c fsConnection) String() string {
+	dir, err := filepath.Abs(c.dir)
+	if err != nil {
+		dir = c.dir
+	}
+	return "filesystem:" + filepath.Join(dir, c.storeID)
+}
+
+// connections are how to connect to a store of each kind.
+type connections struct {
+	db         sqlConnection
+	credhub    credhubConnection
+	vault      vaultConnection
+	kubernetes kubernetesConnection
+	fs         fsConnection
+}
+
+// describe names the store of the given kind, so that two stores can be
+// told apart.
+func (c connections) describe(kind string) string {
+	switch kind {
+	case "credhub":
+		return c.credhub.String()
+	case "vault":
+		return c.vault.String()
+	case "kubernetes":
+		return c.kubernetes.String()
+	case "filesystem":
+		return c.fs.String()
+	default:
+		return c.db.String()
+	}
+}
+
+// sourceConnections are the shared connection options.
+func sourceConnections() connections {
+	return connections{
+		db: sqlConnection{
+			driver:                 opts.DBDriver,
+			hostname:               opts.DBHostname,
+			port:                   opts.DBPort,
+			name:                   opts.DBName,
+			username:               opts.DBUsername,
+			password:               opts.DBPassword,
+			caCertPath:             opts.DBCACertPath,
+			skipHostnameValidation: opts.DBSkipHostnameValidation,
+		},
+		credhub: credhubConnection{
+			url:             opts.CredhubURL,
+			caCertPath:      opts.CredhubCACertPath,
+			uaaClientID:     opts.UAAClientID,
+			uaaClientSecret: opts.UAAClientSecret,
+			uaaCACertPath:   opts.UAACACertPath,
+			storeID:         opts.StoreID,
+			layout:          opts.CredhubLayout,
+		},
+		vault: vaultConnection{
+			address:      opts.Vault.Address,
+			caCertPath:   opts.Vault.CACertPath,
+			token:        opts.Vault.Token,
+			roleID:       opts.Vault.RoleID,
+			secretID:     opts.Vault.SecretID,
+			appRoleMount: opts.Vault.AppRoleMount,
+			mount:        opts.Vault.Mount,
+			pathPrefix:   opts.Vault.PathPrefix,
+			storeID:      opts.StoreID,
+		},
+		kubernetes: kubernetesConnection{
+			kubeconfig: opts.Kubernetes.Kubeconfig,
+			context:    opts.Kubernetes.Context,
+			namespace:  opts.Kubernetes.Namespace,
+			storeID:    opts.StoreID,
+		},
+		fs: fsConnection{
+			dir:     opts.FSDir,
+			storeID: opts.StoreID,
+		},
+	}
+}
+
+// targetConnections are the shared connection options, overridden by the
+// target store options that were given.
+func targetConnections() connections {
+	c := sourceConnections()
+	target := opts.Target
+	override(&c.db.driver, target.DBDriver)
+	override(&c.db.hostname, target.DBHostname)
+	override(&c.db.port, target.DBPort)
+	override(&c.db.name, target.DBName)
+	override(&c.db.username, target.DBUsername)
+	override(&c.db.password, target.DBPassword)
+	override(&c.db.caCertPath, target.DBCACertPath)
+	override(&c.credhub.url, target.CredhubURL)
+	override(&c.credhub.caCertPath, target.CredhubCACertPath)
+	override(&c.credhub.uaaClientID, target.UAAClientID)
+	override(&c.credhub.uaaClientSecret, target.UAAClientSecret)
+	override(&c.credhub.uaaCACertPath, target.UAACACertPath)
+	override(&c.credhub.storeID, target.StoreID)
+	override(&c.credhub.layout, target.CredhubLayout)
+	override(&c.vault.storeID, target.StoreID)
+	override(&c.vault.pathPrefix, target.VaultPathPrefix)
+	override(&c.kubernetes.storeID, target.StoreID)
+	override(&c.kubernetes.context, target.KubeContext)
+	override(&c.kubernetes.namespace, target.KubernetesNamespace)
+	override(&c.fs.storeID, target.StoreID)
+	override(&c.fs.dir, target.FSDir)
+	return c
+}
+
+func override(value *string, with string) {
+	if with != "" {
+		*value = with
+	}
+}
+
+// openSQLStore connects to a SQL store. Unless required is set, it returns
+// nil when the database does not exist.
+func openSQLStore(logger lager.Logger, conn sqlConnection, required bool) *sqlstore.Store {
+	var dbCACert string
+	if conn.caCertPath != "" {
+		b, err := ioutil.ReadFile(conn.caCertPath)
 		if err != nil {
-			logger.Fatal("cannot-read-credhub-ca-cert", err, lager.Data{"path": opts.UAACACertPath})
+			logger.Fatal("cannot-read-db-ca-cert", err, lager.Data{"path": conn.caCertPath})
 		}
-		uaaCACert = string(b)
+		dbCACert = string(b)
 	}
 
-	dbStore, err := brokerstore.NewSqlStore(
+	dbStore, err := sqlstore.NewStore(
 		logger,
-		opts.DBDriver,
-		opts.DBUsername,
-		opts.DBPassword,
-		opts.DBHostname,
-		opts.DBPort,
-		opts.DBName,
+		conn.driver,
+		conn.username,
+		conn.password,
+		conn.hostname,
+		conn.port,
+		conn.name,
 		dbCACert,
-		opts.DBSkipHostnameValidation,
+		conn.skipHostnameValidation,
 	)
 	if err != nil {
-		if HandleSQLStoreError(err) != nil {
-			logger.Fatal("failed-to-initialize-sql-store", err)
+		if HandleSQLStoreError(err) != nil || required {
+			logger.Fatal("failed-to-initialize-sql-store", err, lager.Data{"database": conn.String()})
 		}
 
-		logger.Info("missing-sql-database")
-		return
+		logger.Info("missing-sql-database", lager.Data{"database": conn.String()})
+		return nil
+	}
+
+	return dbStore
+}
+
+func openCredhubStore(logger lager.Logger, conn credhubConnection) *credhubstore.Store {
+	var credhubCACert string
+	if conn.caCertPath != "" {
+		b, err := ioutil.ReadFile(conn.caCertPath)
+		if err != nil {
+			logger.Fatal("cannot-read-credhub-ca-cert", err, lager.Data{"path": conn.caCertPath})
+		}
+		credhubCACert = string(b)
 	}
 
+	var uaaCACert string
+	if conn.uaaCACertPath != "" {
+		b, err := ioutil.ReadFile(conn.uaaCACertPath)
+		if err != nil {
+			logger.Fatal("cannot-read-credhub-ca-cert", err, lager.Data{"path": conn.uaaCACertPath})
+		}
+		uaaCACert = string(b)
+	}
+
+	retryPolicy := credhubstore.RetryPolicy{
+		MaxAttempts:       opts.CredhubMaxAttempts,
+		InitialBackoff:    opts.CredhubRetryBackoff,
+		MaxBackoff:        opts.CredhubRetryMaxBackoff,
+		Jitter:            opts.CredhubRetryJitter,
+		RetryableStatuses: opts.CredhubRetryStatuses,
+		RetryableErrors:   opts.CredhubRetryErrors,
+	}
 	credhubShim, err := credhub_shims.NewCredhubShim(
-		opts.CredhubURL,
+		conn.url,
 		credhubCACert,
-		opts.UAAClientID,
-		opts.UAAClientSecret,
+		conn.uaaClientID,
+		conn.uaaClientSecret,
 		uaaCACert,
-		&credhub_shims.CredhubAuthShim{},
+		&credhubstore.RetryingAuth{CredhubAuth: &credhub_shims.CredhubAuthShim{}, Statuses: retryPolicy.RetryableStatuses},
 	)
 	if err != nil {
 		logger.Fatal("failed-to-create-credhub-shim", err)
 	}
-	credhubStore := brokerstore.NewCredhubStore(
+	credhubShim = credhubstore.NewRetryingCredhub(logger, credhubShim, retryPolicy)
+	credhubStore := credhubstore.NewStoreWithLayout(
 		logger,
 		credhubShim,
-		opts.StoreID,
+		conn.storeID,
+		credhubstore.Layout(conn.layout),
 	)
+
+	return credhubStore
+}
+
+func openVaultStore(logger lager.Logger, conn vaultConnection) *vaultstore.Store {
+	if conn.address == "" {
+		logger.Fatal("missing-vault-address", errors.New("the required flag `--vaultAddr' was not specified"))
+	}
+
+	var vaultCACert string
+	if conn.caCertPath != "" {
+		b, err := ioutil.ReadFile(conn.caCertPath)
+		if err != nil {
+			logger.Fatal("cannot-read-vault-ca-cert", err, lager.Data{"path": conn.caCertPath})
+		}
+		vaultCACert = string(b)
+	}
+
+	client, err := vaultstore.NewClient(conn.address, vaultCACert, conn.mount, vaultstore.Auth{
+		Token:        conn.token,
+		RoleID:       conn.roleID,
+		SecretID:     conn.secretID,
+		AppRoleMount: conn.appRoleMount,
+	})
+	if err != nil {
+		logger.Fatal("failed-to-create-vault-client", err)
+	}
+
+	return vaultstore.NewStore(logger, client, conn.pathPrefix, conn.storeID)
+}
+
+// openKubernetesStore connects to the cluster named by the kubeconfig, or to
+// the cluster it runs in when there is no kubeconfig.
+func openKubernetesStore(logger lager.Logger, conn kubernetesConnection) *k8sstore.Store {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = conn.kubeconfig
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		loadingRules,
+		&clientcmd.ConfigOverrides{CurrentContext: conn.context},
+	).ClientConfig()
+	if err != nil {
+		logger.Fatal("cannot-load-kubeconfig", err, lager.Data{"path": conn.kubeconfig, "context": conn.context})
+	}
+
+	client, err := kubernetes.NewForConfig(config)
 	if err != nil {
-		logger.Fatal("failed-to-initialize-credhub-store", err)
+		logger.Fatal("failed-to-create-kubernetes-client", err)
 	}
 
-	migrator := migrator.NewMigrator(logger)
-	err = migrator.Migrate(dbStore, credhubStore)
+	store, err := k8sstore.NewStore(logger, client, conn.namespace, conn.storeID)
 	if err != nil {
-		logger.Fatal("failed-to-migrate", err)
+		logger.Fatal("failed-to-initialize-kubernetes-store", err)
+	}
+	return store
+}
+
+func openFSStore(logger lager.Logger, conn fsConnection) *fsstore.Store {
+	if conn.dir == "" {
+		logger.Fatal("missing-fs-dir", errors.New("the required flag `--fsDir' was not specified"))
 	}
+	return fsstore.NewStore(logger, conn.dir, conn.storeID)
 }
 
+// HandleSQLStoreError returns nil when err reports that the database does
+// not exist, as there is then no broker state to migrate.
 func HandleSQLStoreError(err error) error {
 	if err == nil {
 		return nil
 	}
 
-	if merr, ok := err.(*mysql.MySQLError); ok {
-		if merr.Number == 1049 {
+	switch serr := err.(type) {
+	case *mysql.MySQLError:
+		// ER_BAD_DB_ERROR
+		if serr.Number == 1049 {
+			return nil
+		}
+	case *pq.Error:
+		// invalid_catalog_name
+		if serr.Code == "3D000" {
 			return nil
 		}
 	}
 
 	return err
 }
+
+// ErrTargetActivated is returned by CheckImportTarget for a target store
+// that a migration or an earlier import has already activated.
+var ErrTargetActivated = errors.New("the target store is already activated, so import into another store ID or roll the target store back first")
+
+// CheckImportTarget refuses to import into a store that is already
+// activated, as an import would then be taken for an interrupted migration
+// and never copy the details of the archive.
+func CheckImportTarget(toStore migrator.ActivatableStore) error {
+	activated, err := toStore.IsActivated()
+	if err != nil {
+		return err
+	}
+	if activated {
+		return ErrTargetActivated
+	}
+	return nil
+}
+
+func WritePlan(w io.Writer, plan migrator.Plan, target migrator.Locator) {
+	switch plan.State {
+	case migrator.StateRetired:
+		fmt.Fprintln(w, "source store is already retired, nothing to migrate")
+		return
+	case migrator.StateInconsistent:
+		fmt.Fprintln(w, "source store is retired but target store is not activated, nothing can be migrated")
+		return
+	case migrator.StateActivated:
+		fmt.Fprintln(w, "target store is already activated, source store would be retired once the copied details are verified")
+		return
+	}
+
+	for _, id := range plan.InstanceIDs {
+		fmt.Fprintf(w, "instance %s\n", target.InstanceLocation(id))
+	}
+	for _, id := range plan.BindingIDs {
+		fmt.Fprintf(w, "binding  %s\n", target.BindingLocation(id))
+	}
+	fmt.Fprintf(w, "marker   %s\n", target.MarkerLocation())
+	for _, id := range plan.InstanceConflicts {
+		fmt.Fprintf(w, "conflict %s (%s)\n", target.InstanceLocation(id), plan.ConflictPolicy)
+	}
+	for _, id := range plan.BindingConflicts {
+		fmt.Fprintf(w, "conflict %s (%s)\n", target.BindingLocation(id), plan.ConflictPolicy)
+	}
+	fmt.Fprintf(w, "%d instances and %d bindings would be written\n", len(plan.InstanceIDs), len(plan.BindingIDs))
+}
+
+func WriteReport(w io.Writer, report migrator.Report) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "source\t%s\n", report.Source)
+	fmt.Fprintf(tw, "target\t%s\n", report.Target)
+	fmt.Fprintf(tw, "state\t%s\n", report.State)
+	fmt.Fprintf(tw, "duration\t%.3fs\n", report.Durations["total"])
+	if report.Error != "" {
+		fmt.Fprintf(tw, "error\t%s\n", report.Error)
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+
+	fmt.Fprint(tw, "\t")
+	for _, outcome := range migrator.Outcomes {
+		fmt.Fprintf(tw, "%s\t", outcome)
+	}
+	fmt.Fprintln(tw)
+	for _, kind := range []string{"instances", "bindings"} {
+		fmt.Fprintf(tw, "%s\t", kind)
+		for _, outcome := range migrator.Outcomes {
+			fmt.Fprintf(tw, "%d\t", report.Counts[kind][outcome])
+		}
+		fmt.Fprintln(tw)
+	}
+	tw.Flush()
+}
+
+func WriteStatus(w io.Writer, status migrator.Status) {
+	sourceMarker, targetMarker := "not retired", "not activated"
+	if status.Source.Marked {
+		sourceMarker = "retired"
+	}
+	if status.Target.Marked {
+		targetMarker = "activated"
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "\tstore\tmarker\tinstances\tbindings\t")
+	fmt.Fprintf(tw, "source\t%s\t%s\t%d\t%d\t\n", status.Source.Store, sourceMarker, status.Source.Instances, status.Source.Bindings)
+	fmt.Fprintf(tw, "target\t%s\t%s\t%d\t%d\t\n", status.Target.Store, targetMarker, status.Target.Instances, status.Target.Bindings)
+	tw.Flush()
+
+	switch status.State {
+	case migrator.StateActivated:
+		fmt.Fprintln(w, "inconsistent: target store is activated but source store is not retired, migrate again to verify the copied details and retire the source store")
+	case migrator.StateInconsistent:
+		fmt.Fprintln(w, "inconsistent: source store is retired but target store is not activated, so neither store holds the broker state")
+	}
+}
+
+// WriteFileAtomically writes a file through a temporary file beside it,
+// which replaces the file at path only once write and closing the file
+// succeed, so that a failed write never destroys an earlier file.
+func WriteFileAtomically(path string, write func(w io.Writer) error) error {
+	file, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	err = write(file)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+func SaveReport(path string, report migrator.Report) error {
+	b, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(b, '\n'), 0600)
+}
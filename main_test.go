@@ -1,12 +1,23 @@
 package main_test
 
 import (
+	"encoding/json"
 	"errors"
+	"io"
+	"io/ioutil"
+	"os"
 	"os/exec"
+	"path/filepath"
 
+	"code.cloudfoundry.org/lager/lagertest"
 	. "code.cloudfoundry.org/migrate_mysql_to_credhub"
+	"code.cloudfoundry.org/migrate_mysql_to_credhub/credhubstore"
+	"code.cloudfoundry.org/migrate_mysql_to_credhub/credhubstore/fakes"
+	"code.cloudfoundry.org/migrate_mysql_to_credhub/migrator"
+	migratorfakes "code.cloudfoundry.org/migrate_mysql_to_credhub/migrator/fakes"
 
 	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	. "github.com/onsi/gomega/gbytes"
@@ -18,6 +29,7 @@ var _ = Describe("Main", func() {
 	Describe("#Main", func() {
 		It("fails if required argument is not provided", func() {
 			args := []string{
+				"migrate",
 				"--dbUsername", "some-db-username",
 				"--dbPassword", "some-db-password",
 				"--dbHostname", "some-db-hostname",
@@ -34,6 +46,268 @@ var _ = Describe("Main", func() {
 			Expect(session.ExitCode()).NotTo(Equal(0))
 			Expect(session.Err).Should(Say("dbDriver"))
 		})
+
+		It("fails if no command is given", func() {
+			args := []string{
+				"--dbDriver", "mysql",
+				"--dbUsername", "some-db-username",
+				"--dbPassword", "some-db-password",
+				"--dbHostname", "some-db-hostname",
+				"--dbPort", "1234",
+				"--dbName", "some-db-name",
+				"--credhubURL", "some-credhub-url",
+				"--storeID", "some-store-id",
+				"--uaaClientID", "some-uaa-client-id",
+				"--uaaClientSecret", "some-uaa-client-secret",
+			}
+			session, err := gexec.Start(exec.Command(binaryPath, args...), GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			<-session.Exited
+			Expect(session.ExitCode()).NotTo(Equal(0))
+			Expect(session.Err).Should(Say("Please specify one command of: export, import, migrate, plan, rollback, status or verify"))
+		})
+
+		It("fails if the database driver is not supported", func() {
+			args := []string{
+				"status",
+				"--dbDriver", "sqlite",
+				"--dbUsername", "some-db-username",
+				"--dbPassword", "some-db-password",
+				"--dbHostname", "some-db-hostname",
+				"--dbPort", "1234",
+				"--dbName", "some-db-name",
+				"--credhubURL", "some-credhub-url",
+				"--storeID", "some-store-id",
+				"--uaaClientID", "some-uaa-client-id",
+				"--uaaClientSecret", "some-uaa-client-secret",
+			}
+			session, err := gexec.Start(exec.Command(binaryPath, args...), GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			<-session.Exited
+			Expect(session.ExitCode()).NotTo(Equal(0))
+			Expect(session.Err).Should(Say("Invalid value `sqlite' for option `--dbDriver'. Allowed values are: mysql or postgres"))
+		})
+
+		It("fails if no database password is given", func() {
+			args := []string{
+				"status",
+				"--dbDriver", "mysql",
+				"--dbUsername", "some-db-username",
+				"--dbHostname", "some-db-hostname",
+				"--dbPort", "1234",
+				"--dbName", "some-db-name",
+				"--credhubURL", "some-credhub-url",
+				"--storeID", "some-store-id",
+				"--uaaClientID", "some-uaa-client-id",
+				"--uaaClientSecret", "some-uaa-client-secret",
+			}
+			session, err := gexec.Start(exec.Command(binaryPath, args...), GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			<-session.Exited
+			Expect(session.ExitCode()).NotTo(Equal(0))
+			Expect(session.Err).Should(Say("`--dbPassword' or `--dbPasswordFile' was not specified"))
+		})
+
+		It("refuses to migrate a store to itself", func() {
+			args := []string{
+				"migrate",
+				"--from", "credhub",
+				"--to", "credhub",
+				"--credhubURL", "some-credhub-url",
+				"--storeID", "some-store-id",
+				"--uaaClientID", "some-uaa-client-id",
+				"--uaaClientSecret", "some-uaa-client-secret",
+			}
+			session, err := gexec.Start(exec.Command(binaryPath, args...), GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			<-session.Exited
+			Expect(session.ExitCode()).NotTo(Equal(0))
+			Expect(session.Err).Should(Say("cannot-migrate-store-to-itself"))
+		})
+
+		It("fails if the target store password is given twice", func() {
+			args := []string{
+				"migrate",
+				"--from", "sql",
+				"--to", "sql",
+				"--dbDriver", "mysql",
+				"--dbUsername", "some-db-username",
+				"--dbPassword", "some-db-password",
+				"--dbHostname", "some-db-hostname",
+				"--dbPort", "1234",
+				"--dbName", "some-db-name",
+				"--toDbDriver", "postgres",
+				"--toDbPassword", "some-other-password",
+				"--toDbPasswordFile", "/some/password/file",
+				"--credhubURL", "some-credhub-url",
+				"--storeID", "some-store-id",
+				"--uaaClientID", "some-uaa-client-id",
+				"--uaaClientSecret", "some-uaa-client-secret",
+			}
+			session, err := gexec.Start(exec.Command(binaryPath, args...), GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			<-session.Exited
+			Expect(session.ExitCode()).NotTo(Equal(0))
+			Expect(session.Err).Should(Say("only one of `--toDbPassword' and `--toDbPasswordFile' can be specified"))
+		})
+
+		It("fails if the kubeconfig cannot be loaded", func() {
+			args := []string{
+				"migrate",
+				"--from", "kubernetes",
+				"--to", "kubernetes",
+				"--kubeconfig", "/some/missing/kubeconfig",
+				"--toKubernetesNamespace", "some-other-namespace",
+				"--storeID", "some-store-id",
+			}
+			session, err := gexec.Start(exec.Command(binaryPath, args...), GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			<-session.Exited
+			Expect(session.ExitCode()).NotTo(Equal(0))
+			Expect(session.Err).Should(Say("cannot-load-kubeconfig"))
+		})
+
+		It("fails if an option of the selected target store is not provided", func() {
+			args := []string{
+				"migrate",
+				"--from", "filesystem",
+				"--to", "credhub",
+				"--fsDir", "/some/dir",
+				"--storeID", "some-store-id",
+				"--uaaClientID", "some-uaa-client-id",
+				"--uaaClientSecret", "some-uaa-client-secret",
+			}
+			session, err := gexec.Start(exec.Command(binaryPath, args...), GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			<-session.Exited
+			Expect(session.ExitCode()).NotTo(Equal(0))
+			Expect(session.Err).Should(Say("the required flag `--credhubURL' was not specified"))
+		})
+
+		It("requires the shared options of a target store only where the target store options do not give them", func() {
+			args := []string{
+				"migrate",
+				"--from", "filesystem",
+				"--to", "sql",
+				"--fsDir", "/some/dir",
+				"--storeID", "some-store-id",
+				"--toDbDriver", "mysql",
+				"--toDbHostname", "some-db-hostname",
+				"--toDbPort", "1234",
+				"--toDbName", "some-db-name",
+				"--toDbPassword", "some-db-password",
+			}
+			session, err := gexec.Start(exec.Command(binaryPath, args...), GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			<-session.Exited
+			Expect(session.ExitCode()).NotTo(Equal(0))
+			Expect(session.Err).Should(Say("the required flag `--dbUsername' was not specified"))
+		})
+
+		Context("when migrating between filesystem stores", func() {
+			var dir string
+
+			BeforeEach(func() {
+				var err error
+				dir, err = ioutil.TempDir("", "main-test")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(os.MkdirAll(filepath.Join(dir, "from", "some-store-id", "instances"), 0700)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(dir, "from", "some-store-id", "instances", "123.json"), []byte(`{"service_id":"some-service"}`), 0600)).To(Succeed())
+			})
+
+			AfterEach(func() {
+				os.RemoveAll(dir)
+			})
+
+			It("migrates without a database or CredHub", func() {
+				args := []string{
+					"migrate",
+					"--from", "filesystem",
+					"--to", "filesystem",
+					"--fsDir", filepath.Join(dir, "from"),
+					"--toFsDir", filepath.Join(dir, "to"),
+					"--storeID", "some-store-id",
+				}
+				session, err := gexec.Start(exec.Command(binaryPath, args...), GinkgoWriter, GinkgoWriter)
+				Expect(err).NotTo(HaveOccurred())
+				<-session.Exited
+				Expect(session.ExitCode()).To(Equal(0))
+
+				Expect(session.Out).To(Say(`state\s+retired`))
+				Expect(session.Err).NotTo(Say(`state\s+retired`))
+
+				Expect(filepath.Join(dir, "to", "some-store-id", "instances", "123.json")).To(BeARegularFile())
+				Expect(filepath.Join(dir, "to", "some-store-id", "migrated-from-another-store")).To(BeARegularFile())
+				Expect(filepath.Join(dir, "from", "some-store-id", "migrated-to-another-store")).To(BeARegularFile())
+			})
+
+			It("takes the options of the command from a config file and the environment", func() {
+				configPath := filepath.Join(dir, "config.yml")
+				Expect(ioutil.WriteFile(configPath, []byte("from: filesystem\nstoreID: some-store-id\n"), 0600)).To(Succeed())
+
+				command := exec.Command(binaryPath, "migrate", "--config", configPath, "--fsDir", filepath.Join(dir, "from"), "--toFsDir", filepath.Join(dir, "to"))
+				command.Env = append(os.Environ(), "MIGRATE_TO=filesystem", "MIGRATE_ON_CONFLICT=skip")
+				session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+				Expect(err).NotTo(HaveOccurred())
+				<-session.Exited
+				Expect(session.ExitCode()).To(Equal(0))
+
+				Expect(filepath.Join(dir, "to", "some-store-id", "instances", "123.json")).To(BeARegularFile())
+			})
+
+			Describe("status", func() {
+				args := func() []string {
+					return []string{
+						"status",
+						"--from", "filesystem",
+						"--to", "filesystem",
+						"--fsDir", filepath.Join(dir, "from"),
+						"--toFsDir", filepath.Join(dir, "to"),
+						"--storeID", "some-store-id",
+					}
+				}
+
+				It("exits cleanly when neither store holds its marker", func() {
+					session, err := gexec.Start(exec.Command(binaryPath, args()...), GinkgoWriter, GinkgoWriter)
+					Expect(err).NotTo(HaveOccurred())
+					<-session.Exited
+					Expect(session.ExitCode()).To(Equal(0))
+				})
+
+				It("exits non-zero when only the source store holds its marker", func() {
+					Expect(ioutil.WriteFile(filepath.Join(dir, "from", "some-store-id", "migrated-to-another-store"), nil, 0600)).To(Succeed())
+
+					session, err := gexec.Start(exec.Command(binaryPath, args()...), GinkgoWriter, GinkgoWriter)
+					Expect(err).NotTo(HaveOccurred())
+					<-session.Exited
+					Expect(session.ExitCode()).To(Equal(1))
+					Expect(session.Out).To(Say("inconsistent: source store is retired but target store is not activated"))
+				})
+			})
+
+			It("fails without panicking when the config file gives an unknown option", func() {
+				configPath := filepath.Join(dir, "config.yml")
+				Expect(ioutil.WriteFile(configPath, []byte("someOption: some-value\n"), 0600)).To(Succeed())
+
+				session, err := gexec.Start(exec.Command(binaryPath, "migrate", "--config", configPath), GinkgoWriter, GinkgoWriter)
+				Expect(err).NotTo(HaveOccurred())
+				<-session.Exited
+				Expect(session.ExitCode()).To(Equal(1))
+				Expect(session.Err).To(Say("unknown option `someOption' in config file"))
+				Expect(session.Err).NotTo(Say("panic"))
+			})
+		})
+
+		It("lists the commands in its help", func() {
+			session, err := gexec.Start(exec.Command(binaryPath, "--help"), GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			<-session.Exited
+			Expect(session.ExitCode()).To(Equal(0))
+			Expect(session.Out).Should(Say(`migrate\s+Migrate broker state from SQL to CredHub`))
+			Expect(session.Out).Should(Say(`plan\s+Report what a migration would write`))
+			Expect(session.Out).Should(Say(`rollback\s+Migrate broker state from CredHub back to SQL`))
+		})
 	})
 
 	Describe("#HandleSQLStoreError", func() {
@@ -58,5 +332,283 @@ var _ = Describe("Main", func() {
 				Expect(HandleSQLStoreError(err)).To(BeNil())
 			})
 		})
+
+		Context("when given another MySQL error", func() {
+			It("should return the error", func() {
+				err := &mysql.MySQLError{
+					Number: 1045,
+				}
+				Expect(HandleSQLStoreError(err)).To(MatchError(err))
+			})
+		})
+
+		Context("when given a Postgres error 3D000", func() {
+			It("should return nil", func() {
+				err := &pq.Error{
+					Code: "3D000",
+				}
+				Expect(HandleSQLStoreError(err)).To(BeNil())
+			})
+		})
+
+		Context("when given another Postgres error", func() {
+			It("should return the error", func() {
+				err := &pq.Error{
+					Code: "28P01",
+				}
+				Expect(HandleSQLStoreError(err)).To(MatchError(err))
+			})
+		})
+	})
+
+	Describe("#CheckImportTarget", func() {
+		var toStore *migratorfakes.FakeActivatableStore
+
+		BeforeEach(func() {
+			toStore = &migratorfakes.FakeActivatableStore{}
+		})
+
+		It("accepts a store that is not activated", func() {
+			Expect(CheckImportTarget(toStore)).To(Succeed())
+		})
+
+		Context("when the store is already activated", func() {
+			BeforeEach(func() {
+				toStore.IsActivatedReturns(true, nil)
+			})
+
+			It("refuses it", func() {
+				Expect(CheckImportTarget(toStore)).To(Equal(ErrTargetActivated))
+			})
+
+			It("accepts it as an import target for SQL, which never counts as activated", func() {
+				Expect(CheckImportTarget(migrator.ImportTarget(toStore))).To(Succeed())
+			})
+		})
+
+		Context("when the activation marker cannot be read", func() {
+			BeforeEach(func() {
+				toStore.IsActivatedReturns(false, errors.New("is-activated-failed"))
+			})
+
+			It("returns the error", func() {
+				Expect(CheckImportTarget(toStore)).To(MatchError("is-activated-failed"))
+			})
+		})
+	})
+
+	Describe("#WritePlan", func() {
+		var (
+			buffer *Buffer
+			target migrator.Locator
+		)
+
+		BeforeEach(func() {
+			buffer = NewBuffer()
+			target = credhubstore.NewStore(lagertest.NewTestLogger("main-test"), &fakes.FakeCredhub{}, "some-store-id")
+		})
+
+		It("lists the CredHub paths that would be written", func() {
+			WritePlan(buffer, migrator.Plan{
+				State:       migrator.StateCopying,
+				InstanceIDs: []string{"123", "456"},
+				BindingIDs:  []string{"789"},
+			}, target)
+
+			Expect(buffer).To(Say(`instance /some-store-id/123\n`))
+			Expect(buffer).To(Say(`instance /some-store-id/456\n`))
+			Expect(buffer).To(Say(`binding  /some-store-id/789\n`))
+			Expect(buffer).To(Say(`marker   /some-store-id/migrated-from-sql\n`))
+			Expect(buffer).To(Say(`2 instances and 1 bindings would be written`))
+		})
+
+		It("lists the paths that already hold different details", func() {
+			WritePlan(buffer, migrator.Plan{
+				State:             migrator.StateCopying,
+				InstanceIDs:       []string{"456"},
+				ConflictPolicy:    migrator.ConflictSkip,
+				InstanceConflicts: []string{"123"},
+				BindingConflicts:  []string{"789"},
+			}, target)
+
+			Expect(buffer).To(Say(`marker   /some-store-id/migrated-from-sql\n`))
+			Expect(buffer).To(Say(`conflict /some-store-id/123 \(skip\)\n`))
+			Expect(buffer).To(Say(`conflict /some-store-id/789 \(skip\)\n`))
+			Expect(buffer).To(Say(`1 instances and 0 bindings would be written`))
+		})
+
+		Context("when the source store is already retired", func() {
+			It("reports that there is nothing to migrate", func() {
+				WritePlan(buffer, migrator.Plan{State: migrator.StateRetired}, target)
+				Expect(string(buffer.Contents())).To(Equal("source store is already retired, nothing to migrate\n"))
+			})
+		})
+
+		Context("when the target store is activated but the source store is not retired", func() {
+			It("reports that the source store would be retired", func() {
+				WritePlan(buffer, migrator.Plan{State: migrator.StateActivated}, target)
+				Expect(buffer).To(Say("source store would be retired"))
+			})
+		})
+	})
+
+	Describe("#WriteReport", func() {
+		var report migrator.Report
+
+		BeforeEach(func() {
+			report = migrator.Report{
+				Source:    "mysql://some-db-hostname:1234/some-db-name",
+				Target:    "credhub:/some-store-id",
+				State:     migrator.StateRetired,
+				Durations: map[string]float64{"total": 1.5},
+				Counts: map[string]map[migrator.Outcome]int{
+					"instances": {migrator.OutcomeCopied: 2, migrator.OutcomeConflicted: 1},
+					"bindings":  {migrator.OutcomeFailed: 3},
+				},
+			}
+		})
+
+		It("summarises the migration in a table", func() {
+			buffer := NewBuffer()
+			WriteReport(buffer, report)
+
+			Expect(buffer).To(Say(`source\s+mysql://some-db-hostname:1234/some-db-name\n`))
+			Expect(buffer).To(Say(`target\s+credhub:/some-store-id\n`))
+			Expect(buffer).To(Say(`state\s+retired\n`))
+			Expect(buffer).To(Say(`duration\s+1.500s\n`))
+			Expect(buffer).To(Say(`\s+copied\s+skipped\s+conflicted\s+failed\s*\n`))
+			Expect(buffer).To(Say(`instances\s+2\s+0\s+1\s+0\s*\n`))
+			Expect(buffer).To(Say(`bindings\s+0\s+0\s+0\s+3\s*\n`))
+		})
+
+		It("includes the error of a failed migration", func() {
+			report.Error = "create-failed"
+			buffer := NewBuffer()
+			WriteReport(buffer, report)
+
+			Expect(buffer).To(Say(`error\s+create-failed\n`))
+		})
+	})
+
+	Describe("#WriteStatus", func() {
+		var status migrator.Status
+
+		BeforeEach(func() {
+			status = migrator.Status{
+				State:  migrator.StateCopying,
+				Source: migrator.StoreStatus{Store: "mysql://some-db-hostname:1234/some-db-name", Instances: 3, Bindings: 2},
+				Target: migrator.StoreStatus{Store: "credhub:/some-store-id", Instances: 1},
+			}
+		})
+
+		It("lists the marker and counts of both stores", func() {
+			buffer := NewBuffer()
+			WriteStatus(buffer, status)
+
+			Expect(buffer).To(Say(`\s+store\s+marker\s+instances\s+bindings\s*\n`))
+			Expect(buffer).To(Say(`source\s+mysql://some-db-hostname:1234/some-db-name\s+not retired\s+3\s+2\s*\n`))
+			Expect(buffer).To(Say(`target\s+credhub:/some-store-id\s+not activated\s+1\s+0\s*\n`))
+			Expect(buffer).NotTo(Say("inconsistent"))
+		})
+
+		Context("when the target store is activated but the source store is not retired", func() {
+			BeforeEach(func() {
+				status.State = migrator.StateActivated
+				status.Target.Marked = true
+			})
+
+			It("flags the status as inconsistent", func() {
+				buffer := NewBuffer()
+				WriteStatus(buffer, status)
+
+				Expect(buffer).To(Say(`target\s+credhub:/some-store-id\s+activated`))
+				Expect(buffer).To(Say("inconsistent: target store is activated but source store is not retired"))
+			})
+		})
+
+		Context("when the source store is retired but the target store is not activated", func() {
+			BeforeEach(func() {
+				status.State = migrator.StateInconsistent
+				status.Source.Marked = true
+			})
+
+			It("flags the status as inconsistent", func() {
+				buffer := NewBuffer()
+				WriteStatus(buffer, status)
+
+				Expect(buffer).To(Say(`source\s+mysql://some-db-hostname:1234/some-db-name\s+retired`))
+				Expect(buffer).To(Say("inconsistent: source store is retired but target store is not activated"))
+			})
+		})
+	})
+
+	Describe("#WriteFileAtomically", func() {
+		var (
+			dir  string
+			path string
+		)
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "atomic")
+			Expect(err).NotTo(HaveOccurred())
+			path = filepath.Join(dir, "broker.archive")
+			Expect(ioutil.WriteFile(path, []byte("earlier archive"), 0600)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("replaces the file once it is written", func() {
+			Expect(WriteFileAtomically(path, func(w io.Writer) error {
+				_, err := w.Write([]byte("later archive"))
+				return err
+			})).To(Succeed())
+
+			Expect(ioutil.ReadFile(path)).To(Equal([]byte("later archive")))
+			files, err := ioutil.ReadDir(dir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(files).To(HaveLen(1))
+		})
+
+		Context("when writing fails", func() {
+			It("leaves the earlier file in place and removes the temporary file", func() {
+				err := WriteFileAtomically(path, func(w io.Writer) error {
+					w.Write([]byte("partial"))
+					return errors.New("export-failed")
+				})
+				Expect(err).To(MatchError("export-failed"))
+
+				Expect(ioutil.ReadFile(path)).To(Equal([]byte("earlier archive")))
+				files, err := ioutil.ReadDir(dir)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(files).To(HaveLen(1))
+			})
+		})
+	})
+
+	Describe("#SaveReport", func() {
+		It("writes the report as JSON", func() {
+			dir, err := ioutil.TempDir("", "report")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(dir)
+
+			path := filepath.Join(dir, "report.json")
+			Expect(SaveReport(path, migrator.Report{
+				Source:    "some-source",
+				Target:    "some-target",
+				State:     migrator.StateRetired,
+				Instances: []migrator.Result{{ID: "123", Outcome: migrator.OutcomeCopied}},
+			})).To(Succeed())
+
+			b, err := ioutil.ReadFile(path)
+			Expect(err).NotTo(HaveOccurred())
+			var saved map[string]interface{}
+			Expect(json.Unmarshal(b, &saved)).To(Succeed())
+			Expect(saved["source"]).To(Equal("some-source"))
+			Expect(saved["state"]).To(Equal("retired"))
+			Expect(saved["instances"]).To(Equal([]interface{}{map[string]interface{}{"id": "123", "outcome": "copied"}}))
+		})
 	})
 })
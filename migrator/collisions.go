@@ -0,0 +1,93 @@
+package migrator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"code.cloudfoundry.org/service-broker-store/brokerstore"
+	"github.com/pivotal-cf/brokerapi"
+)
+
+// CollisionError lists the locations in the target store that more than one
+// detail, or a detail and the migration marker, would be written to.
+type CollisionError struct {
+	Locations []string
+}
+
+func (e *CollisionError) Error() string {
+	return fmt.Sprintf("details would collide in the target store at %s", strings.Join(e.Locations, ", "))
+}
+
+// checkCollisions returns a CollisionError if the target store would keep
+// any two of the given details, or a detail and its marker, in the same
+// location. Stores that do not implement Locator cannot be checked.
+func checkCollisions(toStore ActivatableStore, instanceIDs, bindingIDs []string) error {
+	locator, ok := locatorFor(toStore)
+	if !ok {
+		return nil
+	}
+
+	seen := map[string]bool{locator.MarkerLocation(): true}
+	collided := map[string]bool{}
+	add := func(location string) {
+		if seen[location] {
+			collided[location] = true
+		}
+		seen[location] = true
+	}
+
+	for _, id := range instanceIDs {
+		add(locator.InstanceLocation(id))
+	}
+	for _, id := range bindingIDs {
+		add(locator.BindingLocation(id))
+	}
+
+	if len(collided) == 0 {
+		return nil
+	}
+
+	collisionErr := &CollisionError{}
+	for location := range collided {
+		collisionErr.Locations = append(collisionErr.Locations, location)
+	}
+	sort.Strings(collisionErr.Locations)
+	return collisionErr
+}
+
+// wrapper is implemented by the stores this package wraps around others.
+type wrapper interface {
+	unwrap() interface{}
+}
+
+func locatorFor(store interface{}) (Locator, bool) {
+	for {
+		if locator, ok := store.(Locator); ok {
+			return locator, true
+		}
+		w, ok := store.(wrapper)
+		if !ok {
+			return nil, false
+		}
+		store = w.unwrap()
+	}
+}
+
+func instanceIDs(instanceDetails map[string]brokerstore.ServiceInstance) []string {
+	ids := make([]string, 0, len(instanceDetails))
+	for id := range instanceDetails {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func bindingIDs(bindingDetails map[string]brokerapi.BindDetails) []string {
+	ids := make([]string, 0, len(bindingDetails))
+	for id := range bindingDetails {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
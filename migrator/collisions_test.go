@@ -0,0 +1,100 @@
+package migrator_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf/brokerapi"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/migrate_mysql_to_credhub/migrator"
+	"code.cloudfoundry.org/migrate_mysql_to_credhub/migrator/fakes"
+	"code.cloudfoundry.org/service-broker-store/brokerstore"
+)
+
+var _ = Describe("Collision detection", func() {
+	var (
+		migrationObj migrator.Migrator
+		fromStore    *fakes.FakeRetirableStore
+		toStore      *fakes.FakeActivatableStore
+	)
+
+	BeforeEach(func() {
+		migrationObj = migrator.NewMigrator(lagertest.NewTestLogger("migrator-test"))
+		fromStore = &fakes.FakeRetirableStore{}
+		toStore = &fakes.FakeActivatableStore{}
+		storeDetails(toStore)
+
+		fromStore.RetrieveAllInstanceDetailsReturns(map[string]brokerstore.ServiceInstance{
+			"123": brokerstore.ServiceInstance{ServiceID: "some-service-1"},
+			"456": brokerstore.ServiceInstance{ServiceID: "some-service-2"},
+		}, nil)
+		fromStore.RetrieveAllBindingDetailsReturns(map[string]brokerapi.BindDetails{
+			"456": brokerapi.BindDetails{AppGUID: "some-app-1"},
+		}, nil)
+	})
+
+	Context("when the target store keeps instances and bindings in one namespace", func() {
+		var target *flatStore
+
+		BeforeEach(func() {
+			target = &flatStore{toStore}
+		})
+
+		It("refuses to migrate details whose locations collide", func() {
+			_, err := migrationObj.Migrate(fromStore, target)
+			Expect(err).To(BeAssignableToTypeOf(&migrator.CollisionError{}))
+			Expect(err.(*migrator.CollisionError).Locations).To(Equal([]string{"/some-store-id/456"}))
+			Expect(err).To(MatchError("details would collide in the target store at /some-store-id/456"))
+		})
+
+		It("writes nothing", func() {
+			migrationObj.Migrate(fromStore, target)
+			Expect(toStore.CreateInstanceDetailsCallCount()).To(Equal(0))
+			Expect(toStore.CreateBindingDetailsCallCount()).To(Equal(0))
+			Expect(toStore.ActivateCallCount()).To(Equal(0))
+		})
+
+		It("reports the collision when planning", func() {
+			_, err := migrationObj.Plan(fromStore, target)
+			Expect(err).To(BeAssignableToTypeOf(&migrator.CollisionError{}))
+		})
+
+		Context("when an ID collides with the migration marker", func() {
+			BeforeEach(func() {
+				fromStore.RetrieveAllBindingDetailsReturns(map[string]brokerapi.BindDetails{
+					"migrated-from-sql": brokerapi.BindDetails{AppGUID: "some-app-1"},
+				}, nil)
+			})
+
+			It("refuses to migrate", func() {
+				_, err := migrationObj.Migrate(fromStore, target)
+				Expect(err).To(MatchError("details would collide in the target store at /some-store-id/migrated-from-sql"))
+			})
+		})
+	})
+
+	Context("when the target store cannot locate its details", func() {
+		It("migrates as before", func() {
+			_, err := migrationObj.Migrate(fromStore, toStore)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(toStore.CreateInstanceDetailsCallCount()).To(Equal(2))
+			Expect(toStore.CreateBindingDetailsCallCount()).To(Equal(1))
+		})
+	})
+})
+
+type flatStore struct {
+	*fakes.FakeActivatableStore
+}
+
+func (s *flatStore) InstanceLocation(id string) string {
+	return "/some-store-id/" + id
+}
+
+func (s *flatStore) BindingLocation(id string) string {
+	return "/some-store-id/" + id
+}
+
+func (s *flatStore) MarkerLocation() string {
+	return "/some-store-id/migrated-from-sql"
+}
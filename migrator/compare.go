@@ -0,0 +1,123 @@
+package migrator
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"code.cloudfoundry.org/service-broker-store/brokerstore"
+	"github.com/pivotal-cf/brokerapi"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// VerificationError lists the details that did not read back from the
+// target store as they were read from the source store, and those the target
+// store holds that the source store does not.
+type VerificationError struct {
+	InstanceIDs           []string
+	BindingIDs            []string
+	UnexpectedInstanceIDs []string
+	UnexpectedBindingIDs  []string
+}
+
+// errVerification is reported for details that did not read back as they
+// were written.
+var errVerification = errors.New("details differ in the target store")
+
+func (e *VerificationError) Error() string {
+	message := fmt.Sprintf("verification failed for %d instance(s) and %d binding(s)", len(e.InstanceIDs), len(e.BindingIDs))
+	if len(e.UnexpectedInstanceIDs) > 0 || len(e.UnexpectedBindingIDs) > 0 {
+		message += fmt.Sprintf(", with %d unexpected instance(s) and %d unexpected binding(s)", len(e.UnexpectedInstanceIDs), len(e.UnexpectedBindingIDs))
+	}
+	return message
+}
+
+func (e *VerificationError) empty() bool {
+	return len(e.InstanceIDs) == 0 && len(e.BindingIDs) == 0 && len(e.UnexpectedInstanceIDs) == 0 && len(e.UnexpectedBindingIDs) == 0
+}
+
+func (e *VerificationError) add(other *VerificationError) {
+	e.InstanceIDs = append(e.InstanceIDs, other.InstanceIDs...)
+	e.BindingIDs = append(e.BindingIDs, other.BindingIDs...)
+	e.UnexpectedInstanceIDs = append(e.UnexpectedInstanceIDs, other.UnexpectedInstanceIDs...)
+	e.UnexpectedBindingIDs = append(e.UnexpectedBindingIDs, other.UnexpectedBindingIDs...)
+}
+
+func (e *VerificationError) sort() {
+	sort.Strings(e.InstanceIDs)
+	sort.Strings(e.BindingIDs)
+	sort.Strings(e.UnexpectedInstanceIDs)
+	sort.Strings(e.UnexpectedBindingIDs)
+}
+
+func instancesEqual(expected, actual brokerstore.ServiceInstance) bool {
+	return jsonEqual(expected, actual)
+}
+
+// bindingsEqual compares bindings as JSON values, except that their
+// parameters also match parameters that brokerstore replaced by their hash,
+// as brokerstore.SqlStore does when it writes a binding.
+func bindingsEqual(expected, actual brokerapi.BindDetails) bool {
+	expectedParams, actualParams := expected.RawParameters, actual.RawParameters
+	expected.RawParameters, actual.RawParameters = nil, nil
+	if !jsonEqual(expected, actual) {
+		return false
+	}
+
+	if len(expectedParams) == 0 || len(actualParams) == 0 {
+		return len(expectedParams) == len(actualParams)
+	}
+	return jsonEqual(expectedParams, actualParams) ||
+		hashes(actualParams, expectedParams) ||
+		hashes(expectedParams, actualParams)
+}
+
+// hashes reports whether hashed holds the hash that brokerstore would keep
+// in place of params.
+func hashes(hashed, params json.RawMessage) bool {
+	var opts map[string]interface{}
+	if err := json.Unmarshal(hashed, &opts); err != nil {
+		return false
+	}
+	h, ok := opts[brokerstore.HashKey].(string)
+	if !ok {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(h), params) == nil
+}
+
+// jsonEqual compares two values by their JSON representation. Details pass
+// through JSON on their way in and out of every store, so numbers inside
+// interface{} fields (e.g. ServiceFingerPrint) and raw messages are compared
+// as JSON documents rather than by their Go types or byte layout.
+func jsonEqual(expected, actual interface{}) bool {
+	e, err := normalize(expected)
+	if err != nil {
+		return false
+	}
+	a, err := normalize(actual)
+	if err != nil {
+		return false
+	}
+	return reflect.DeepEqual(e, a)
+}
+
+func normalize(subject interface{}) (interface{}, error) {
+	b, err := json.Marshal(subject)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+
+	var normalized interface{}
+	err = decoder.Decode(&normalized)
+	if err != nil {
+		return nil, err
+	}
+	return normalized, nil
+}
@@ -0,0 +1,255 @@
+package migrator
+
+import (
+	"fmt"
+	"sort"
+
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/service-broker-store/brokerstore"
+	"github.com/pivotal-cf/brokerapi"
+)
+
+// ConflictPolicy decides what Migrate does with details that the target
+// store already holds with different content.
+type ConflictPolicy string
+
+const (
+	// ConflictFail stops the migration before anything is written.
+	ConflictFail ConflictPolicy = "fail"
+
+	// ConflictSkip leaves the details held by the target store in place.
+	ConflictSkip ConflictPolicy = "skip"
+
+	// ConflictOverwrite replaces the details held by the target store.
+	ConflictOverwrite ConflictPolicy = "overwrite"
+)
+
+// ConflictError lists the details that the target store already holds with
+// different content.
+type ConflictError struct {
+	InstanceIDs []string
+	BindingIDs  []string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("the target store already holds %d instance(s) and %d binding(s) with different details", len(e.InstanceIDs), len(e.BindingIDs))
+}
+
+func (e *ConflictError) empty() bool {
+	return len(e.InstanceIDs) == 0 && len(e.BindingIDs) == 0
+}
+
+func (e *ConflictError) add(other *ConflictError) {
+	e.InstanceIDs = append(e.InstanceIDs, other.InstanceIDs...)
+	e.BindingIDs = append(e.BindingIDs, other.BindingIDs...)
+}
+
+func (e *ConflictError) sort() {
+	sort.Strings(e.InstanceIDs)
+	sort.Strings(e.BindingIDs)
+}
+
+// Comparison is how the details a store holds under an ID compare with the
+// details that would be written there.
+type Comparison int
+
+const (
+	// Absent means that the store holds no details under the ID.
+	Absent Comparison = iota
+
+	// Identical means that the store already holds the same details.
+	Identical
+
+	// Conflicting means that the store holds different details.
+	Conflicting
+)
+
+// Comparer is implemented by stores that can compare the details they hold
+// with the details that would be written to them, and report why they could
+// not, rather than only whether the details conflict. Stores without it are
+// checked with IsInstanceConflict and IsBindingConflict.
+type Comparer interface {
+	CompareInstanceDetails(id string, details brokerstore.ServiceInstance) (Comparison, error)
+	CompareBindingDetails(id string, details brokerapi.BindDetails) (Comparison, error)
+}
+
+// CompareInstance compares the instance that retrieve reads under id with
+// details. Only brokerapi.ErrInstanceDoesNotExist counts as absent, so that
+// a store that cannot be read is never taken to be empty.
+func CompareInstance(retrieve func(id string) (brokerstore.ServiceInstance, error), id string, details brokerstore.ServiceInstance) (Comparison, error) {
+	existing, err := retrieve(id)
+	if err == brokerapi.ErrInstanceDoesNotExist {
+		return Absent, nil
+	}
+	if err != nil {
+		return Absent, err
+	}
+	if !instancesEqual(details, existing) {
+		return Conflicting, nil
+	}
+	return Identical, nil
+}
+
+// CompareBinding compares the binding that retrieve reads under id with
+// details. Only brokerapi.ErrBindingDoesNotExist counts as absent, along with
+// the brokerapi.ErrInstanceDoesNotExist that brokerstore.SqlStore returns for
+// a missing binding. Parameters are compared as JSON values, and match
+// parameters that brokerstore replaced by their hash.
+func CompareBinding(retrieve func(id string) (brokerapi.BindDetails, error), id string, details brokerapi.BindDetails) (Comparison, error) {
+	existing, err := retrieve(id)
+	if err == brokerapi.ErrBindingDoesNotExist || err == brokerapi.ErrInstanceDoesNotExist {
+		return Absent, nil
+	}
+	if err != nil {
+		return Absent, err
+	}
+	if !bindingsEqual(details, existing) {
+		return Conflicting, nil
+	}
+	return Identical, nil
+}
+
+// heldDetails lists the details that the target store already holds with
+// the same content. They are not written again, so that a rollback only
+// removes the details that the migration created.
+type heldDetails struct {
+	instanceIDs map[string]bool
+	bindingIDs  map[string]bool
+}
+
+func newHeldDetails() *heldDetails {
+	return &heldDetails{
+		instanceIDs: map[string]bool{},
+		bindingIDs:  map[string]bool{},
+	}
+}
+
+func (h *heldDetails) add(other *heldDetails) {
+	for id := range other.instanceIDs {
+		h.instanceIDs[id] = true
+	}
+	for id := range other.bindingIDs {
+		h.bindingIDs[id] = true
+	}
+}
+
+// findConflicts checks every detail against the target store, other than
+// those the journal records as written by an earlier run of this migration.
+// It also returns the details the target store already holds, where the
+// store can tell them apart from absent ones.
+func findConflicts(logger lager.Logger, toStore ActivatableStore, instanceDetails map[string]brokerstore.ServiceInstance, bindingDetails map[string]brokerapi.BindDetails, written *writeLog) (*ConflictError, *heldDetails, error) {
+	comparer := comparerFor(toStore)
+	conflictErr := &ConflictError{}
+	held := newHeldDetails()
+
+	for id, details := range instanceDetails {
+		if written.instanceIDs[id] {
+			continue
+		}
+		comparison, err := comparer.CompareInstanceDetails(id, details)
+		if err != nil {
+			logger.Error("failed-to-compare-instance-details", err, lager.Data{"id": id})
+			return nil, nil, err
+		}
+		switch comparison {
+		case Conflicting:
+			logger.Info("instance-details-conflict", lager.Data{"id": id})
+			conflictErr.InstanceIDs = append(conflictErr.InstanceIDs, id)
+		case Identical:
+			held.instanceIDs[id] = true
+		}
+	}
+
+	for id, details := range bindingDetails {
+		if written.bindingIDs[id] {
+			continue
+		}
+		comparison, err := comparer.CompareBindingDetails(id, details)
+		if err != nil {
+			logger.Error("failed-to-compare-binding-details", err, lager.Data{"id": id})
+			return nil, nil, err
+		}
+		switch comparison {
+		case Conflicting:
+			logger.Info("binding-details-conflict", lager.Data{"id": id})
+			conflictErr.BindingIDs = append(conflictErr.BindingIDs, id)
+		case Identical:
+			held.bindingIDs[id] = true
+		}
+	}
+
+	conflictErr.sort()
+	return conflictErr, held, nil
+}
+
+// comparerFor returns the Comparer of a store, or of the store it wraps, or
+// else one that only tells conflicting details apart from the rest.
+func comparerFor(store ActivatableStore) Comparer {
+	var s interface{} = store
+	for {
+		if comparer, ok := s.(Comparer); ok {
+			return comparer
+		}
+		w, ok := s.(wrapper)
+		if !ok {
+			return conflictComparer{store}
+		}
+		s = w.unwrap()
+	}
+}
+
+type conflictComparer struct {
+	store ActivatableStore
+}
+
+func (c conflictComparer) CompareInstanceDetails(id string, details brokerstore.ServiceInstance) (Comparison, error) {
+	if c.store.IsInstanceConflict(id, details) {
+		return Conflicting, nil
+	}
+	return Absent, nil
+}
+
+func (c conflictComparer) CompareBindingDetails(id string, details brokerapi.BindDetails) (Comparison, error) {
+	if c.store.IsBindingConflict(id, details) {
+		return Conflicting, nil
+	}
+	return Absent, nil
+}
+
+// withoutConflicts returns copies of the details without the conflicting ones.
+func withoutConflicts(instanceDetails map[string]brokerstore.ServiceInstance, bindingDetails map[string]brokerapi.BindDetails, conflictErr *ConflictError) (map[string]brokerstore.ServiceInstance, map[string]brokerapi.BindDetails) {
+	instances := make(map[string]brokerstore.ServiceInstance, len(instanceDetails))
+	for id, details := range instanceDetails {
+		instances[id] = details
+	}
+	for _, id := range conflictErr.InstanceIDs {
+		delete(instances, id)
+	}
+
+	bindings := make(map[string]brokerapi.BindDetails, len(bindingDetails))
+	for id, details := range bindingDetails {
+		bindings[id] = details
+	}
+	for _, id := range conflictErr.BindingIDs {
+		delete(bindings, id)
+	}
+
+	return instances, bindings
+}
+
+// withoutIDs returns the IDs that are neither among the excluded ones nor
+// held already, in order.
+func withoutIDs(ids, excluded []string, held map[string]bool) []string {
+	skip := make(map[string]bool, len(excluded))
+	for _, id := range excluded {
+		skip[id] = true
+	}
+
+	var kept []string
+	for _, id := range ids {
+		if !skip[id] && !held[id] {
+			kept = append(kept, id)
+		}
+	}
+	return kept
+}
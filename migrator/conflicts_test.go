@@ -0,0 +1,224 @@
+package migrator_test
+
+import (
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf/brokerapi"
+	"golang.org/x/crypto/bcrypt"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/migrate_mysql_to_credhub/migrator"
+	"code.cloudfoundry.org/migrate_mysql_to_credhub/migrator/fakes"
+	"code.cloudfoundry.org/service-broker-store/brokerstore"
+)
+
+var _ = Describe("CompareInstance", func() {
+	var (
+		existing    brokerstore.ServiceInstance
+		retrieveErr error
+		retrieve    func(string) (brokerstore.ServiceInstance, error)
+	)
+
+	BeforeEach(func() {
+		existing = brokerstore.ServiceInstance{ServiceID: "some-service", ServiceFingerPrint: map[string]interface{}{"size": 1}}
+		retrieveErr = nil
+		retrieve = func(string) (brokerstore.ServiceInstance, error) {
+			return existing, retrieveErr
+		}
+	})
+
+	It("reports the same details as identical, however their numbers are typed", func() {
+		Expect(migrator.CompareInstance(retrieve, "123", brokerstore.ServiceInstance{ServiceID: "some-service", ServiceFingerPrint: map[string]interface{}{"size": 1.0}})).To(Equal(migrator.Identical))
+	})
+
+	It("reports different details as conflicting", func() {
+		Expect(migrator.CompareInstance(retrieve, "123", brokerstore.ServiceInstance{ServiceID: "other-service"})).To(Equal(migrator.Conflicting))
+	})
+
+	It("reports details that do not exist as absent", func() {
+		retrieveErr = brokerapi.ErrInstanceDoesNotExist
+		Expect(migrator.CompareInstance(retrieve, "123", brokerstore.ServiceInstance{ServiceID: "other-service"})).To(Equal(migrator.Absent))
+	})
+
+	It("returns any other error", func() {
+		retrieveErr = errors.New("retrieve-failed")
+		_, err := migrator.CompareInstance(retrieve, "123", brokerstore.ServiceInstance{})
+		Expect(err).To(MatchError("retrieve-failed"))
+	})
+})
+
+var _ = Describe("CompareBinding", func() {
+	var (
+		existing    brokerapi.BindDetails
+		retrieveErr error
+		retrieve    func(string) (brokerapi.BindDetails, error)
+	)
+
+	BeforeEach(func() {
+		hash, err := bcrypt.GenerateFromPassword([]byte(`{"mount":"/data"}`), bcrypt.MinCost)
+		Expect(err).NotTo(HaveOccurred())
+
+		existing = brokerapi.BindDetails{AppGUID: "some-app", RawParameters: []byte(`{"paramsHash":"` + string(hash) + `"}`)}
+		retrieveErr = nil
+		retrieve = func(string) (brokerapi.BindDetails, error) {
+			return existing, retrieveErr
+		}
+	})
+
+	It("reports parameters that match the hash held as identical", func() {
+		Expect(migrator.CompareBinding(retrieve, "456", brokerapi.BindDetails{AppGUID: "some-app", RawParameters: []byte(`{"mount":"/data"}`)})).To(Equal(migrator.Identical))
+		Expect(migrator.CompareBinding(retrieve, "456", brokerapi.BindDetails{AppGUID: "some-app", RawParameters: []byte(`{"mount":"/other"}`)})).To(Equal(migrator.Conflicting))
+	})
+
+	It("reports the same hash laid out differently as identical", func() {
+		details := brokerapi.BindDetails{AppGUID: "some-app", RawParameters: append([]byte(" "), existing.RawParameters...)}
+		Expect(migrator.CompareBinding(retrieve, "456", details)).To(Equal(migrator.Identical))
+	})
+
+	It("reports details that differ otherwise as conflicting", func() {
+		Expect(migrator.CompareBinding(retrieve, "456", brokerapi.BindDetails{AppGUID: "other-app", RawParameters: existing.RawParameters})).To(Equal(migrator.Conflicting))
+		Expect(migrator.CompareBinding(retrieve, "456", brokerapi.BindDetails{AppGUID: "some-app"})).To(Equal(migrator.Conflicting))
+	})
+
+	It("reports details that do not exist as absent", func() {
+		retrieveErr = brokerapi.ErrBindingDoesNotExist
+		Expect(migrator.CompareBinding(retrieve, "456", brokerapi.BindDetails{})).To(Equal(migrator.Absent))
+
+		retrieveErr = brokerapi.ErrInstanceDoesNotExist
+		Expect(migrator.CompareBinding(retrieve, "456", brokerapi.BindDetails{})).To(Equal(migrator.Absent))
+	})
+
+	It("returns any other error", func() {
+		retrieveErr = errors.New("retrieve-failed")
+		_, err := migrator.CompareBinding(retrieve, "456", brokerapi.BindDetails{})
+		Expect(err).To(MatchError("retrieve-failed"))
+	})
+})
+
+var _ = Describe("Conflict detection", func() {
+	var (
+		migrationObj migrator.Migrator
+		fromStore    *fakes.FakeRetirableStore
+		toStore      *fakes.FakeActivatableStore
+		target       *comparingStore
+	)
+
+	BeforeEach(func() {
+		migrationObj = migrator.NewMigrator(lagertest.NewTestLogger("migrator-test"))
+		fromStore = &fakes.FakeRetirableStore{}
+		toStore = &fakes.FakeActivatableStore{}
+		storeDetails(toStore)
+		target = &comparingStore{toStore}
+
+		fromStore.RetrieveAllInstanceDetailsReturns(map[string]brokerstore.ServiceInstance{
+			"123": brokerstore.ServiceInstance{ServiceID: "some-service-1"},
+		}, nil)
+		fromStore.RetrieveAllBindingDetailsReturns(map[string]brokerapi.BindDetails{
+			"456": brokerapi.BindDetails{AppGUID: "some-app-1"},
+		}, nil)
+	})
+
+	Context("when the target store compares details itself", func() {
+		It("copies the details it does not hold", func() {
+			_, err := migrationObj.Migrate(fromStore, target)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(toStore.CreateInstanceDetailsCallCount()).To(Equal(1))
+			Expect(toStore.CreateBindingDetailsCallCount()).To(Equal(1))
+			Expect(toStore.IsInstanceConflictCallCount()).To(Equal(0))
+		})
+
+		It("reports the details it holds differently as conflicts", func() {
+			Expect(toStore.CreateInstanceDetails("123", brokerstore.ServiceInstance{ServiceID: "other-service"})).To(Succeed())
+
+			_, err := migrationObj.Migrate(fromStore, target)
+			Expect(err).To(Equal(&migrator.ConflictError{InstanceIDs: []string{"123"}}))
+		})
+
+		Context("when conflicting details are overwritten and the migration fails", func() {
+			BeforeEach(func() {
+				Expect(toStore.CreateInstanceDetails("123", brokerstore.ServiceInstance{ServiceID: "other-service"})).To(Succeed())
+
+				migrationObj = migrator.NewMigrator(lagertest.NewTestLogger("migrator-test"), migrator.WithConflictPolicy(migrator.ConflictOverwrite), migrator.WithRollbackOnFailure())
+				toStore.CreateBindingDetailsStub = nil
+				toStore.CreateBindingDetailsReturns(errors.New("create-failed"))
+			})
+
+			It("writes back the details they replaced rather than deleting them", func() {
+				_, err := migrationObj.Migrate(fromStore, target)
+				Expect(err).To(HaveOccurred())
+				Expect(toStore.CreateInstanceDetailsCallCount()).To(Equal(3))
+				Expect(toStore.DeleteInstanceDetailsCallCount()).To(Equal(0))
+				Expect(toStore.RetrieveInstanceDetails("123")).To(Equal(brokerstore.ServiceInstance{ServiceID: "other-service"}))
+			})
+		})
+
+		Context("when the target store already holds some of the details", func() {
+			BeforeEach(func() {
+				Expect(toStore.CreateInstanceDetails("123", brokerstore.ServiceInstance{ServiceID: "some-service-1"})).To(Succeed())
+			})
+
+			It("verifies them without writing them again", func() {
+				report, err := migrationObj.Migrate(fromStore, target)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(toStore.CreateInstanceDetailsCallCount()).To(Equal(1))
+				Expect(toStore.CreateBindingDetailsCallCount()).To(Equal(1))
+				Expect(report.Instances).To(Equal([]migrator.Result{{ID: "123", Outcome: migrator.OutcomeSkipped}}))
+			})
+
+			It("leaves them out of the plan", func() {
+				plan, err := migrationObj.Plan(fromStore, target)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(plan.InstanceIDs).To(BeEmpty())
+				Expect(plan.BindingIDs).To(Equal([]string{"456"}))
+			})
+
+			Context("when the migration fails and is rolled back", func() {
+				BeforeEach(func() {
+					migrationObj = migrator.NewMigrator(lagertest.NewTestLogger("migrator-test"), migrator.WithRollbackOnFailure())
+					toStore.CreateBindingDetailsStub = nil
+					toStore.CreateBindingDetailsReturns(errors.New("create-failed"))
+				})
+
+				It("removes only the details it wrote", func() {
+					_, err := migrationObj.Migrate(fromStore, target)
+					Expect(err).To(HaveOccurred())
+					Expect(toStore.DeleteInstanceDetailsCallCount()).To(Equal(0))
+					Expect(toStore.DeleteBindingDetailsCallCount()).To(Equal(0))
+				})
+			})
+		})
+
+		Context("when the target store cannot be read", func() {
+			BeforeEach(func() {
+				toStore.RetrieveBindingDetailsStub = nil
+				toStore.RetrieveBindingDetailsReturns(brokerapi.BindDetails{}, errors.New("retrieve-failed"))
+			})
+
+			It("stops the migration before writing anything", func() {
+				_, err := migrationObj.Migrate(fromStore, target)
+				Expect(err).To(MatchError("retrieve-failed"))
+				Expect(toStore.CreateInstanceDetailsCallCount()).To(Equal(0))
+				Expect(toStore.ActivateCallCount()).To(Equal(0))
+			})
+
+			It("fails to plan", func() {
+				_, err := migrationObj.Plan(fromStore, target)
+				Expect(err).To(MatchError("retrieve-failed"))
+			})
+		})
+	})
+})
+
+type comparingStore struct {
+	*fakes.FakeActivatableStore
+}
+
+func (s *comparingStore) CompareInstanceDetails(id string, details brokerstore.ServiceInstance) (migrator.Comparison, error) {
+	return migrator.CompareInstance(s.RetrieveInstanceDetails, id, details)
+}
+
+func (s *comparingStore) CompareBindingDetails(id string, details brokerapi.BindDetails) (migrator.Comparison, error) {
+	return migrator.CompareBinding(s.RetrieveBindingDetails, id, details)
+}
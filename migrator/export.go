@@ -0,0 +1,58 @@
+package migrator
+
+import (
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/service-broker-store/brokerstore"
+	"github.com/pivotal-cf/brokerapi"
+)
+
+// ExportTarget receives the details of a store, such as to write them to an
+// archive.
+type ExportTarget interface {
+	WriteInstance(id string, details brokerstore.ServiceInstance) error
+	WriteBinding(id string, details brokerapi.BindDetails) error
+}
+
+// Export hands every detail of fromStore to target without changing either
+// store. Instances come before bindings, and each page of details is handed
+// over in ID order.
+func (m *migrator) Export(fromStore RetirableStore, target ExportTarget) error {
+	logger := m.logger.Session("export")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	src, err := m.source(logger, fromStore)
+	if err != nil {
+		return err
+	}
+
+	instances, bindings := 0, 0
+	err = src.each(func(instanceDetails map[string]brokerstore.ServiceInstance, bindingDetails map[string]brokerapi.BindDetails) error {
+		page := &idSet{}
+		page.add(instanceDetails, bindingDetails)
+		page.sort()
+
+		for _, id := range page.instanceIDs {
+			if err := target.WriteInstance(id, instanceDetails[id]); err != nil {
+				logger.Error("failed-to-export-instance-details", err, lager.Data{"id": id})
+				return err
+			}
+		}
+		for _, id := range page.bindingIDs {
+			if err := target.WriteBinding(id, bindingDetails[id]); err != nil {
+				logger.Error("failed-to-export-binding-details", err, lager.Data{"id": id})
+				return err
+			}
+		}
+
+		instances += len(instanceDetails)
+		bindings += len(bindingDetails)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	logger.Info("exported", lager.Data{"instances": instances, "bindings": bindings})
+	return nil
+}
@@ -0,0 +1,127 @@
+package migrator_test
+
+import (
+	"errors"
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf/brokerapi"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/migrate_mysql_to_credhub/migrator"
+	"code.cloudfoundry.org/migrate_mysql_to_credhub/migrator/fakes"
+	"code.cloudfoundry.org/service-broker-store/brokerstore"
+)
+
+var _ = Describe("Export", func() {
+	var (
+		migrationObj migrator.Migrator
+		fromStore    *fakes.FakeRetirableStore
+		source       migrator.RetirableStore
+		target       *recordingTarget
+		err          error
+	)
+
+	BeforeEach(func() {
+		migrationObj = migrator.NewMigrator(lagertest.NewTestLogger("migrator-test"))
+		fromStore = &fakes.FakeRetirableStore{}
+		source = fromStore
+		target = &recordingTarget{}
+
+		fromStore.RetrieveAllInstanceDetailsReturns(map[string]brokerstore.ServiceInstance{
+			"456": brokerstore.ServiceInstance{ServiceID: "some-service-2"},
+			"123": brokerstore.ServiceInstance{ServiceID: "some-service-1"},
+		}, nil)
+		fromStore.RetrieveAllBindingDetailsReturns(map[string]brokerapi.BindDetails{
+			"789": brokerapi.BindDetails{AppGUID: "some-app"},
+		}, nil)
+	})
+
+	JustBeforeEach(func() {
+		err = migrationObj.Export(source, target)
+	})
+
+	It("hands over every detail in ID order, instances first", func() {
+		Expect(err).NotTo(HaveOccurred())
+		Expect(target.written).To(Equal([]string{"instance 123", "instance 456", "binding 789"}))
+	})
+
+	It("does not change the store", func() {
+		Expect(fromStore.RetireCallCount()).To(Equal(0))
+		Expect(fromStore.CreateInstanceDetailsCallCount()).To(Equal(0))
+		Expect(fromStore.DeleteInstanceDetailsCallCount()).To(Equal(0))
+	})
+
+	Context("when reading the store fails", func() {
+		BeforeEach(func() {
+			fromStore.RetrieveAllBindingDetailsReturns(nil, errors.New("retrieve-failed"))
+		})
+
+		It("returns the error without handing over anything", func() {
+			Expect(err).To(MatchError("retrieve-failed"))
+			Expect(target.written).To(BeEmpty())
+		})
+	})
+
+	Context("when the target fails", func() {
+		BeforeEach(func() {
+			target.err = errors.New("write-failed")
+		})
+
+		It("returns the error", func() {
+			Expect(err).To(MatchError("write-failed"))
+			Expect(target.written).To(HaveLen(1))
+		})
+	})
+
+	Context("when the store can be read a page at a time", func() {
+		var pages *pagedStore
+
+		BeforeEach(func() {
+			migrationObj = migrator.NewMigrator(lagertest.NewTestLogger("migrator-test"), migrator.WithPageSize(2))
+			pages = &pagedStore{
+				FakeRetirableStore: fromStore,
+				instances:          map[string]brokerstore.ServiceInstance{},
+				bindings:           map[string]brokerapi.BindDetails{},
+				writtenBeforePage:  map[string]int{},
+				toStore:            &fakes.FakeActivatableStore{},
+			}
+			for i := 0; i < 3; i++ {
+				pages.instances[fmt.Sprintf("instance-%d", i)] = brokerstore.ServiceInstance{ServiceID: "some-service"}
+			}
+			pages.bindings["binding-0"] = brokerapi.BindDetails{AppGUID: "some-app"}
+			source = pages
+		})
+
+		It("hands over each page as it is read", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pages.instancePages).To(Equal([]string{"", "instance-1", "instance-2"}))
+			Expect(target.written).To(Equal([]string{"instance instance-0", "instance instance-1", "instance instance-2", "binding binding-0"}))
+			Expect(fromStore.RetrieveAllInstanceDetailsCallCount()).To(Equal(0))
+		})
+	})
+})
+
+// recordingTarget records the details handed to it, and fails every write
+// after the first when given an error.
+type recordingTarget struct {
+	written []string
+	err     error
+}
+
+func (t *recordingTarget) WriteInstance(id string, details brokerstore.ServiceInstance) error {
+	return t.write("instance " + id)
+}
+
+func (t *recordingTarget) WriteBinding(id string, details brokerapi.BindDetails) error {
+	return t.write("binding " + id)
+}
+
+func (t *recordingTarget) write(entry string) error {
+	if t.err != nil && len(t.written) > 0 {
+		return t.err
+	}
+	t.written = append(t.written, entry)
+	return nil
+}
@@ -0,0 +1,240 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package fakes
+
+import (
+	"sync"
+
+	"code.cloudfoundry.org/migrate_mysql_to_credhub/migrator"
+)
+
+type FakeJournal struct {
+	ClearStub        func() error
+	clearMutex       sync.RWMutex
+	clearArgsForCall []struct {
+	}
+	clearReturns struct {
+		result1 error
+	}
+	clearReturnsOnCall map[int]struct {
+		result1 error
+	}
+	EntriesStub        func() ([]migrator.JournalEntry, error)
+	entriesMutex       sync.RWMutex
+	entriesArgsForCall []struct {
+	}
+	entriesReturns struct {
+		result1 []migrator.JournalEntry
+		result2 error
+	}
+	entriesReturnsOnCall map[int]struct {
+		result1 []migrator.JournalEntry
+		result2 error
+	}
+	RecordStub        func(migrator.JournalEntry) error
+	recordMutex       sync.RWMutex
+	recordArgsForCall []struct {
+		arg1 migrator.JournalEntry
+	}
+	recordReturns struct {
+		result1 error
+	}
+	recordReturnsOnCall map[int]struct {
+		result1 error
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeJournal) Clear() error {
+	fake.clearMutex.Lock()
+	ret, specificReturn := fake.clearReturnsOnCall[len(fake.clearArgsForCall)]
+	fake.clearArgsForCall = append(fake.clearArgsForCall, struct {
+	}{})
+	stub := fake.ClearStub
+	fakeReturns := fake.clearReturns
+	fake.recordInvocation("Clear", []interface{}{})
+	fake.clearMutex.Unlock()
+	if stub != nil {
+		return stub()
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeJournal) ClearCallCount() int {
+	fake.clearMutex.RLock()
+	defer fake.clearMutex.RUnlock()
+	return len(fake.clearArgsForCall)
+}
+
+func (fake *FakeJournal) ClearCalls(stub func() error) {
+	fake.clearMutex.Lock()
+	defer fake.clearMutex.Unlock()
+	fake.ClearStub = stub
+}
+
+func (fake *FakeJournal) ClearReturns(result1 error) {
+	fake.clearMutex.Lock()
+	defer fake.clearMutex.Unlock()
+	fake.ClearStub = nil
+	fake.clearReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeJournal) ClearReturnsOnCall(i int, result1 error) {
+	fake.clearMutex.Lock()
+	defer fake.clearMutex.Unlock()
+	fake.ClearStub = nil
+	if fake.clearReturnsOnCall == nil {
+		fake.clearReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.clearReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeJournal) Entries() ([]migrator.JournalEntry, error) {
+	fake.entriesMutex.Lock()
+	ret, specificReturn := fake.entriesReturnsOnCall[len(fake.entriesArgsForCall)]
+	fake.entriesArgsForCall = append(fake.entriesArgsForCall, struct {
+	}{})
+	stub := fake.EntriesStub
+	fakeReturns := fake.entriesReturns
+	fake.recordInvocation("Entries", []interface{}{})
+	fake.entriesMutex.Unlock()
+	if stub != nil {
+		return stub()
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeJournal) EntriesCallCount() int {
+	fake.entriesMutex.RLock()
+	defer fake.entriesMutex.RUnlock()
+	return len(fake.entriesArgsForCall)
+}
+
+func (fake *FakeJournal) EntriesCalls(stub func() ([]migrator.JournalEntry, error)) {
+	fake.entriesMutex.Lock()
+	defer fake.entriesMutex.Unlock()
+	fake.EntriesStub = stub
+}
+
+func (fake *FakeJournal) EntriesReturns(result1 []migrator.JournalEntry, result2 error) {
+	fake.entriesMutex.Lock()
+	defer fake.entriesMutex.Unlock()
+	fake.EntriesStub = nil
+	fake.entriesReturns = struct {
+		result1 []migrator.JournalEntry
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeJournal) EntriesReturnsOnCall(i int, result1 []migrator.JournalEntry, result2 error) {
+	fake.entriesMutex.Lock()
+	defer fake.entriesMutex.Unlock()
+	fake.EntriesStub = nil
+	if fake.entriesReturnsOnCall == nil {
+		fake.entriesReturnsOnCall = make(map[int]struct {
+			result1 []migrator.JournalEntry
+			result2 error
+		})
+	}
+	fake.entriesReturnsOnCall[i] = struct {
+		result1 []migrator.JournalEntry
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeJournal) Record(arg1 migrator.JournalEntry) error {
+	fake.recordMutex.Lock()
+	ret, specificReturn := fake.recordReturnsOnCall[len(fake.recordArgsForCall)]
+	fake.recordArgsForCall = append(fake.recordArgsForCall, struct {
+		arg1 migrator.JournalEntry
+	}{arg1})
+	stub := fake.RecordStub
+	fakeReturns := fake.recordReturns
+	fake.recordInvocation("Record", []interface{}{arg1})
+	fake.recordMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeJournal) RecordCallCount() int {
+	fake.recordMutex.RLock()
+	defer fake.recordMutex.RUnlock()
+	return len(fake.recordArgsForCall)
+}
+
+func (fake *FakeJournal) RecordCalls(stub func(migrator.JournalEntry) error) {
+	fake.recordMutex.Lock()
+	defer fake.recordMutex.Unlock()
+	fake.RecordStub = stub
+}
+
+func (fake *FakeJournal) RecordArgsForCall(i int) migrator.JournalEntry {
+	fake.recordMutex.RLock()
+	defer fake.recordMutex.RUnlock()
+	argsForCall := fake.recordArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeJournal) RecordReturns(result1 error) {
+	fake.recordMutex.Lock()
+	defer fake.recordMutex.Unlock()
+	fake.RecordStub = nil
+	fake.recordReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeJournal) RecordReturnsOnCall(i int, result1 error) {
+	fake.recordMutex.Lock()
+	defer fake.recordMutex.Unlock()
+	fake.RecordStub = nil
+	if fake.recordReturnsOnCall == nil {
+		fake.recordReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.recordReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeJournal) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeJournal) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ migrator.Journal = new(FakeJournal)
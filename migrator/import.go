@@ -0,0 +1,26 @@
+package migrator
+
+import "code.cloudfoundry.org/service-broker-store/brokerstore"
+
+// ImportTarget lets a store without an activation marker of its own, such as
+// SQL, receive the details of an archive. It never counts as activated, so
+// that an import always copies every detail, and activating it does nothing.
+func ImportTarget(store brokerstore.Store) ActivatableStore {
+	return &importTarget{store}
+}
+
+type importTarget struct {
+	brokerstore.Store
+}
+
+func (s *importTarget) Activate() error {
+	return nil
+}
+
+func (s *importTarget) IsActivated() (bool, error) {
+	return false, nil
+}
+
+func (s *importTarget) unwrap() interface{} {
+	return s.Store
+}
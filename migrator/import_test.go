@@ -0,0 +1,59 @@
+package migrator_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/migrate_mysql_to_credhub/migrator"
+	"code.cloudfoundry.org/migrate_mysql_to_credhub/migrator/fakes"
+	"code.cloudfoundry.org/service-broker-store/brokerstore"
+)
+
+var _ = Describe("Import", func() {
+	var (
+		migrationObj migrator.Migrator
+		fromStore    *fakes.FakeRetirableStore
+		sqlStore     *fakes.FakeUnretirableStore
+		err          error
+	)
+
+	BeforeEach(func() {
+		migrationObj = migrator.NewMigrator(lagertest.NewTestLogger("migrator-test"))
+		fromStore = &fakes.FakeRetirableStore{}
+		fromStore.RetrieveAllInstanceDetailsReturns(map[string]brokerstore.ServiceInstance{
+			"123": brokerstore.ServiceInstance{ServiceID: "some-service-1"},
+		}, nil)
+
+		sqlStore = &fakes.FakeUnretirableStore{}
+		sqlStore.RetrieveInstanceDetailsReturns(brokerstore.ServiceInstance{ServiceID: "some-service-1"}, nil)
+	})
+
+	JustBeforeEach(func() {
+		_, err = migrationObj.Migrate(fromStore, migrator.ImportTarget(sqlStore))
+	})
+
+	It("copies every detail into a store that is not retired", func() {
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sqlStore.CreateInstanceDetailsCallCount()).To(Equal(1))
+	})
+
+	It("leaves the retirement marker of the store alone", func() {
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sqlStore.IsRetiredCallCount()).To(Equal(0))
+		Expect(sqlStore.RetireCallCount()).To(Equal(0))
+		Expect(sqlStore.UnretireCallCount()).To(Equal(0))
+	})
+
+	Context("when the details were imported before", func() {
+		BeforeEach(func() {
+			_, err := migrationObj.Migrate(fromStore, migrator.ImportTarget(sqlStore))
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("copies them again", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sqlStore.CreateInstanceDetailsCallCount()).To(Equal(2))
+		})
+	})
+})
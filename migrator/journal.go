@@ -0,0 +1,170 @@
+package migrator
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+const (
+	InstanceKind = "instance"
+	BindingKind  = "binding"
+)
+
+// JournalEntry records that a detail has been copied to the target store.
+// The checksum identifies the copied content, so that a detail which changed
+// in the source store since it was recorded is copied again.
+type JournalEntry struct {
+	Kind     string `json:"kind"`
+	ID       string `json:"id"`
+	Checksum string `json:"checksum"`
+}
+
+//go:generate counterfeiter -o fakes/fake_journal.go . Journal
+type Journal interface {
+	Entries() ([]JournalEntry, error)
+	Record(entry JournalEntry) error
+	Clear() error
+}
+
+type fileJournal struct {
+	path  string
+	mutex sync.Mutex
+	file  *os.File
+}
+
+// NewFileJournal returns a Journal that appends one JSON entry per line to
+// the file at path.
+func NewFileJournal(path string) Journal {
+	return &fileJournal{
+		path: path,
+	}
+}
+
+func (j *fileJournal) Entries() ([]JournalEntry, error) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	file, err := os.Open(j.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []JournalEntry
+	reader := bufio.NewReader(file)
+	for line := 1; ; line++ {
+		b, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// anything after the last newline is a torn final line from an
+			// interrupted write
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var entry JournalEntry
+		if err := json.Unmarshal(b, &entry); err != nil {
+			return nil, fmt.Errorf("journal %s is corrupt at line %d: %s", j.path, line, err)
+		}
+		entries = append(entries, entry)
+	}
+}
+
+func (j *fileJournal) Record(entry JournalEntry) error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if j.file == nil {
+		file, err := os.OpenFile(j.path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return err
+		}
+		if err := trimTornLine(file); err != nil {
+			file.Close()
+			return err
+		}
+		j.file = file
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if _, err := j.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return j.file.Sync()
+}
+
+func (j *fileJournal) Clear() error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if j.file != nil {
+		j.file.Close()
+		j.file = nil
+	}
+
+	err := os.Remove(j.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// trimTornLine truncates a final line that an interrupted write left without
+// its newline, so that new entries are not appended to it.
+func trimTornLine(file *os.File) error {
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+
+	buf := make([]byte, 4096)
+	for offset := size; offset > 0; {
+		n := int64(len(buf))
+		if offset < n {
+			n = offset
+		}
+		offset -= n
+		if _, err := file.ReadAt(buf[:n], offset); err != nil {
+			return err
+		}
+		if i := bytes.LastIndexByte(buf[:n], '\n'); i >= 0 {
+			end := offset + int64(i) + 1
+			if end == size {
+				return nil
+			}
+			return file.Truncate(end)
+		}
+	}
+	if size == 0 {
+		return nil
+	}
+	return file.Truncate(0)
+}
+
+func checksum(details interface{}) (string, error) {
+	normalized, err := normalize(details)
+	if err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(normalized)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
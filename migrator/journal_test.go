@@ -0,0 +1,112 @@
+package migrator_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/migrate_mysql_to_credhub/migrator"
+)
+
+var _ = Describe("FileJournal", func() {
+	var (
+		dir     string
+		path    string
+		journal migrator.Journal
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "journal")
+		Expect(err).NotTo(HaveOccurred())
+		path = filepath.Join(dir, "journal.jsonl")
+		journal = migrator.NewFileJournal(path)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	Context("when the journal file does not exist", func() {
+		It("has no entries", func() {
+			entries, err := journal.Entries()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(BeEmpty())
+		})
+	})
+
+	It("reads back the recorded entries", func() {
+		Expect(journal.Record(migrator.JournalEntry{Kind: migrator.InstanceKind, ID: "123", Checksum: "abc"})).To(Succeed())
+		Expect(journal.Record(migrator.JournalEntry{Kind: migrator.BindingKind, ID: "456", Checksum: "def"})).To(Succeed())
+
+		entries, err := migrator.NewFileJournal(path).Entries()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(Equal([]migrator.JournalEntry{
+			{Kind: migrator.InstanceKind, ID: "123", Checksum: "abc"},
+			{Kind: migrator.BindingKind, ID: "456", Checksum: "def"},
+		}))
+	})
+
+	Context("when the last entry was only partially written", func() {
+		BeforeEach(func() {
+			err := ioutil.WriteFile(path, []byte(`{"kind":"instance","id":"123","checksum":"abc"}`+"\n"+`{"kind":"bind`), 0600)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("ignores the partial entry", func() {
+			entries, err := journal.Entries()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(Equal([]migrator.JournalEntry{
+				{Kind: migrator.InstanceKind, ID: "123", Checksum: "abc"},
+			}))
+		})
+
+		It("records later entries in place of the partial entry", func() {
+			Expect(journal.Record(migrator.JournalEntry{Kind: migrator.BindingKind, ID: "456", Checksum: "def"})).To(Succeed())
+
+			entries, err := journal.Entries()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(Equal([]migrator.JournalEntry{
+				{Kind: migrator.InstanceKind, ID: "123", Checksum: "abc"},
+				{Kind: migrator.BindingKind, ID: "456", Checksum: "def"},
+			}))
+		})
+	})
+
+	Context("when an entry other than a partially written last one is corrupt", func() {
+		It("returns an error naming the line", func() {
+			err := ioutil.WriteFile(path, []byte(`{"kind":"instance","id":"123","checksum":"abc"}`+"\n"+`{"kind":"bind`+"\n"+`{"kind":"instance","id":"456","checksum":"def"}`+"\n"), 0600)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = journal.Entries()
+			Expect(err).To(MatchError(ContainSubstring("is corrupt at line 2")))
+		})
+
+		It("returns an error for a complete last line", func() {
+			err := ioutil.WriteFile(path, []byte(`{"kind":"instance","id":"123","checksum":"abc"}`+"\n"+`not-json`+"\n"), 0600)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = journal.Entries()
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("when the journal is cleared", func() {
+		BeforeEach(func() {
+			Expect(journal.Record(migrator.JournalEntry{Kind: migrator.InstanceKind, ID: "123"})).To(Succeed())
+			Expect(journal.Clear()).To(Succeed())
+		})
+
+		It("removes the journal file", func() {
+			_, err := os.Stat(path)
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+
+		It("can be cleared again", func() {
+			Expect(journal.Clear()).To(Succeed())
+		})
+	})
+})
@@ -1,8 +1,11 @@
 package migrator
 
 import (
+	"sync"
+
 	"code.cloudfoundry.org/lager"
 	"code.cloudfoundry.org/service-broker-store/brokerstore"
+	"github.com/pivotal-cf/brokerapi"
 )
 
 //go:generate counterfeiter -o fakes/fake_retirable_store.go . RetirableStore
@@ -18,80 +21,693 @@ type ActivatableStore interface {
 	IsActivated() (bool, error)
 	brokerstore.Store
 }
+
+// Locator is implemented by stores that can name where they keep details and
+// their migration marker.
+type Locator interface {
+	InstanceLocation(id string) string
+	BindingLocation(id string) string
+	MarkerLocation() string
+}
+
 type Migrator interface {
-	Migrate(RetirableStore, ActivatableStore) error
+	Migrate(RetirableStore, ActivatableStore) (Report, error)
+	Plan(RetirableStore, ActivatableStore) (Plan, error)
+	Verify(RetirableStore, ActivatableStore) error
+	Status(RetirableStore, ActivatableStore) (Status, error)
+	Export(RetirableStore, ExportTarget) error
+}
+
+// Plan describes what Migrate would do, without writing to either store.
+// The conflicts list the details the target store already holds with
+// different content, which are handled according to ConflictPolicy. Under
+// ConflictSkip they are left out of the IDs that would be written, as are
+// details the target store already holds with the same content.
+type Plan struct {
+	State             State
+	InstanceIDs       []string
+	BindingIDs        []string
+	ConflictPolicy    ConflictPolicy
+	InstanceConflicts []string
+	BindingConflicts  []string
+}
+
+// Skipped reports whether Migrate would return without copying anything.
+func (p Plan) Skipped() bool {
+	return p.State != StateCopying
 }
 
 type migrator struct {
-	logger lager.Logger
+	logger            lager.Logger
+	rollbackOnFailure bool
+	journal           Journal
+	conflictPolicy    ConflictPolicy
+	concurrency       int
+	pageSize          int
 }
 
-func NewMigrator(logger lager.Logger) Migrator {
-	return &migrator{
-		logger: logger,
+type Option func(*migrator)
+
+// WithRollbackOnFailure makes Migrate delete every detail it wrote to the
+// target store when the migration fails before the target is activated, and
+// write back the details that it overwrote.
+func WithRollbackOnFailure() Option {
+	return func(m *migrator) {
+		m.rollbackOnFailure = true
 	}
 }
 
-func (m *migrator) Migrate(fromStore RetirableStore, toStore ActivatableStore) error {
-	logger := m.logger.Session("migrate")
+// WithJournal makes Migrate record every detail it copies in journal, and
+// skip details the journal records as copied when a failed migration is
+// rerun.
+func WithJournal(journal Journal) Option {
+	return func(m *migrator) {
+		m.journal = journal
+	}
+}
+
+// WithConflictPolicy decides what Migrate does with details that the target
+// store already holds with different content. The default is ConflictFail.
+func WithConflictPolicy(policy ConflictPolicy) Option {
+	return func(m *migrator) {
+		m.conflictPolicy = policy
+	}
+}
+
+// WithConcurrency makes Migrate write up to n details to the target store at
+// once. The target store is still only activated once every write succeeds.
+func WithConcurrency(n int) Option {
+	return func(m *migrator) {
+		if n > 0 {
+			m.concurrency = n
+		}
+	}
+}
+
+// WithPageSize makes Migrate read up to n details at a time from source
+// stores that implement PagedStore, and write and verify each page before
+// reading the next, instead of reading every detail at once.
+func WithPageSize(n int) Option {
+	return func(m *migrator) {
+		m.pageSize = n
+	}
+}
+
+func NewMigrator(logger lager.Logger, options ...Option) Migrator {
+	m := &migrator{
+		logger:         logger,
+		conflictPolicy: ConflictFail,
+		concurrency:    1,
+	}
+	for _, option := range options {
+		option(m)
+	}
+	return m
+}
+
+func (m *migrator) Plan(fromStore RetirableStore, toStore ActivatableStore) (Plan, error) {
+	logger := m.logger.Session("plan")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	state, err := m.state(logger, fromStore, toStore)
+	if err != nil {
+		return Plan{}, err
+	}
+	plan := Plan{State: state}
+	if plan.Skipped() {
+		return plan, nil
+	}
+
+	written := newWriteLog()
+	_, err = m.readJournal(logger, written)
+	if err != nil {
+		return Plan{}, err
+	}
+
+	src, err := m.source(logger, fromStore)
+	if err != nil {
+		return Plan{}, err
+	}
+
+	ids, conflictErr, held, err := m.preflight(logger, src, toStore, written)
+	if err != nil {
+		return Plan{}, err
+	}
+	skipped := &ConflictError{}
+	if m.conflictPolicy == ConflictSkip {
+		skipped = conflictErr
+	}
+	plan.InstanceIDs = withoutIDs(ids.instanceIDs, skipped.InstanceIDs, held.instanceIDs)
+	plan.BindingIDs = withoutIDs(ids.bindingIDs, skipped.BindingIDs, held.bindingIDs)
+	plan.ConflictPolicy = m.conflictPolicy
+	plan.InstanceConflicts = conflictErr.InstanceIDs
+	plan.BindingConflicts = conflictErr.BindingIDs
+
+	logger.Info("planned", lager.Data{"instances": len(plan.InstanceIDs), "bindings": len(plan.BindingIDs)})
+	return plan, nil
+}
+
+func (m *migrator) Verify(fromStore RetirableStore, toStore ActivatableStore) error {
+	logger := m.logger.Session("verify-stores")
 	logger.Info("start")
 	defer logger.Info("end")
 
-	retired, err := fromStore.IsRetired()
+	src, err := m.source(logger, fromStore)
 	if err != nil {
-		logger.Error("failed-to-check-if-sql-is-retired", err)
 		return err
 	}
 
-	if retired {
-		logger.Info("sql-already-retired")
+	ids := &idSet{}
+	verificationErr := &VerificationError{}
+	err = src.each(func(instanceDetails map[string]brokerstore.ServiceInstance, bindingDetails map[string]brokerapi.BindDetails) error {
+		ids.add(instanceDetails, bindingDetails)
+		verificationErr.add(m.compare(logger, toStore, instanceDetails, bindingDetails))
 		return nil
+	})
+	if err != nil {
+		return err
 	}
 
-	activated, err := toStore.IsActivated()
+	err = m.findUnexpected(logger, toStore, ids, verificationErr)
 	if err != nil {
-		logger.Error("failed-to-check-if-credhub-is-activated", err)
 		return err
 	}
 
-	if activated {
-		logger.Info("credhub-already-activated")
-		return nil
+	err = m.verificationResult(logger, verificationErr)
+	if err != nil {
+		return err
 	}
 
-	instanceDetails, err := fromStore.RetrieveAllInstanceDetails()
+	logger.Info("verified", lager.Data{"instances": len(ids.instanceIDs), "bindings": len(ids.bindingIDs)})
+	return nil
+}
+
+func (m *migrator) Migrate(fromStore RetirableStore, toStore ActivatableStore) (Report, error) {
+	logger := m.logger.Session("migrate")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	rep := newReporter(fromStore, toStore)
+	err := m.migrate(logger, fromStore, toStore, rep)
+	return rep.finish(err), err
+}
+
+func (m *migrator) migrate(logger lager.Logger, fromStore RetirableStore, toStore ActivatableStore, rep *reporter) error {
+	state, err := m.state(logger, fromStore, toStore)
 	if err != nil {
-		logger.Error("failed-to-retrieve-all-instance-details", err)
 		return err
 	}
+	rep.state(state)
 
-	logger.Info("instance-details", lager.Data{"count": len(instanceDetails)})
-	for id, details := range instanceDetails {
-		err = toStore.CreateInstanceDetails(id, details)
+	switch state {
+	case StateRetired:
+		return nil
+	case StateInconsistent:
+		logger.Error("inconsistent-state", ErrInconsistentState)
+		return ErrInconsistentState
+	case StateActivated:
+		err = rep.timed("verify", func() error {
+			return m.reverify(logger, fromStore, toStore, rep)
+		})
+		if err != nil {
+			return err
+		}
+	default:
+		err = m.copyAndActivate(logger, fromStore, toStore, rep)
 		if err != nil {
-			logger.Error("failed-to-create-instance-details", err, lager.Data{"id": id, "service-details": details})
 			return err
 		}
 	}
+
+	err = rep.timed("retire", fromStore.Retire)
+	if err != nil {
+		logger.Error("failed-to-retire", err)
+		return err
+	}
+	rep.state(StateRetired)
+
+	m.clearJournal(logger)
+	return nil
+}
+
+func (m *migrator) copyAndActivate(logger lager.Logger, fromStore RetirableStore, toStore ActivatableStore, rep *reporter) error {
+	written := newWriteLog()
+	err := m.copy(logger, fromStore, toStore, written, rep)
+	if err == nil {
+		err = rep.timed("activate", toStore.Activate)
+		if err != nil {
+			logger.Error("failed-to-activate", err)
+		} else {
+			rep.state(StateActivated)
+		}
+	}
+	if err != nil && m.rollbackOnFailure {
+		m.rollback(logger, toStore, written)
+	}
+	return err
+}
+
+// reverify checks the details copied by a run that activated the target
+// store but was interrupted before retiring the source store.
+func (m *migrator) reverify(logger lager.Logger, fromStore RetirableStore, toStore ActivatableStore, rep *reporter) error {
+	logger.Info("completing-interrupted-migration")
+
+	src, err := m.source(logger, fromStore)
+	if err != nil {
+		return err
+	}
+
+	return src.each(func(instanceDetails map[string]brokerstore.ServiceInstance, bindingDetails map[string]brokerapi.BindDetails) error {
+		if m.conflictPolicy == ConflictSkip {
+			conflictErr, _, err := findConflicts(logger, toStore, instanceDetails, bindingDetails, newWriteLog())
+			if err != nil {
+				return err
+			}
+			rep.outcomes(InstanceKind, conflictErr.InstanceIDs, OutcomeConflicted, nil)
+			rep.outcomes(BindingKind, conflictErr.BindingIDs, OutcomeConflicted, nil)
+			instanceDetails, bindingDetails = withoutConflicts(instanceDetails, bindingDetails, conflictErr)
+		}
+
+		rep.outcomes(InstanceKind, instanceIDs(instanceDetails), OutcomeSkipped, nil)
+		rep.outcomes(BindingKind, bindingIDs(bindingDetails), OutcomeSkipped, nil)
+		return m.verify(logger, toStore, instanceDetails, bindingDetails, rep)
+	})
+}
+
+func (m *migrator) retrieve(logger lager.Logger, fromStore RetirableStore) (map[string]brokerstore.ServiceInstance, map[string]brokerapi.BindDetails, error) {
+	instanceDetails, err := fromStore.RetrieveAllInstanceDetails()
+	if err != nil {
+		logger.Error("failed-to-retrieve-all-instance-details", err)
+		return nil, nil, err
+	}
+
 	bindingDetails, err := fromStore.RetrieveAllBindingDetails()
 	if err != nil {
 		logger.Error("failed-to-retrieve-all-binding-details", err)
+		return nil, nil, err
+	}
+
+	return instanceDetails, bindingDetails, nil
+}
+
+// preflight reads every detail of the source store without writing any, to
+// check that none would collide in the target store and to find those that
+// conflict with details the target store already holds.
+func (m *migrator) preflight(logger lager.Logger, src source, toStore ActivatableStore, written *writeLog) (*idSet, *ConflictError, *heldDetails, error) {
+	ids := &idSet{}
+	conflictErr := &ConflictError{}
+	held := newHeldDetails()
+	err := src.each(func(instanceDetails map[string]brokerstore.ServiceInstance, bindingDetails map[string]brokerapi.BindDetails) error {
+		ids.add(instanceDetails, bindingDetails)
+		conflicts, identical, err := findConflicts(logger, toStore, instanceDetails, bindingDetails, written)
+		if err != nil {
+			return err
+		}
+		conflictErr.add(conflicts)
+		held.add(identical)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	ids.sort()
+	conflictErr.sort()
+
+	err = checkCollisions(toStore, ids.instanceIDs, ids.bindingIDs)
+	if err != nil {
+		logger.Error("details-would-collide", err)
+		return nil, nil, nil, err
+	}
+
+	return ids, conflictErr, held, nil
+}
+
+func (m *migrator) copy(logger lager.Logger, fromStore RetirableStore, toStore ActivatableStore, written *writeLog, rep *reporter) error {
+	copied, err := m.readJournal(logger, written)
+	if err != nil {
+		return err
+	}
+
+	src, err := m.source(logger, fromStore)
+	if err != nil {
 		return err
 	}
 
-	logger.Info("binding-details", lager.Data{"count": len(bindingDetails)})
-	for id, details := range bindingDetails {
-		err = toStore.CreateBindingDetails(id, details)
+	var ids *idSet
+	var conflictErr *ConflictError
+	var held *heldDetails
+	err = rep.timed("preflight", func() error {
+		var err error
+		ids, conflictErr, held, err = m.preflight(logger, src, toStore, written)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	skipped := &ConflictError{}
+	if !conflictErr.empty() {
+		if m.conflictPolicy != ConflictOverwrite {
+			rep.outcomes(InstanceKind, conflictErr.InstanceIDs, OutcomeConflicted, nil)
+			rep.outcomes(BindingKind, conflictErr.BindingIDs, OutcomeConflicted, nil)
+		}
+
+		data := lager.Data{"policy": m.conflictPolicy, "instances": conflictErr.InstanceIDs, "bindings": conflictErr.BindingIDs}
+		switch m.conflictPolicy {
+		case ConflictSkip:
+			logger.Info("skipping-conflicts", data)
+			skipped = conflictErr
+		case ConflictOverwrite:
+			logger.Info("overwriting-conflicts", data)
+			if m.rollbackOnFailure {
+				err = m.readReplaced(logger, toStore, conflictErr, written)
+				if err != nil {
+					return err
+				}
+			}
+		default:
+			logger.Error("found-conflicts", conflictErr, data)
+			return conflictErr
+		}
+	}
+
+	logger.Info("instance-details", lager.Data{"count": len(ids.instanceIDs) - len(skipped.InstanceIDs) - len(held.instanceIDs)})
+	logger.Info("binding-details", lager.Data{"count": len(ids.bindingIDs) - len(skipped.BindingIDs) - len(held.bindingIDs)})
+
+	return rep.timed("copy", func() error {
+		return src.each(func(instanceDetails map[string]brokerstore.ServiceInstance, bindingDetails map[string]brokerapi.BindDetails) error {
+			instanceDetails, bindingDetails = withoutConflicts(instanceDetails, bindingDetails, skipped)
+			return m.copyPage(logger, toStore, instanceDetails, bindingDetails, copied, held, written, rep)
+		})
+	})
+}
+
+// copyPage writes and then verifies the given details. Details that the
+// target store already holds are verified without being written again.
+func (m *migrator) copyPage(logger lager.Logger, toStore ActivatableStore, instanceDetails map[string]brokerstore.ServiceInstance, bindingDetails map[string]brokerapi.BindDetails, copied map[JournalEntry]bool, held *heldDetails, written *writeLog, rep *reporter) error {
+	var tasks []copyTask
+
+	for _, id := range instanceIDs(instanceDetails) {
+		id, details := id, instanceDetails[id]
+		entry, err := m.journalEntry(InstanceKind, id, details)
+		if err != nil {
+			logger.Error("failed-to-checksum-instance-details", err, lager.Data{"id": id})
+			return err
+		}
+		if copied[entry] {
+			logger.Debug("instance-details-already-copied", lager.Data{"id": id})
+			rep.outcome(InstanceKind, id, OutcomeSkipped, nil)
+			continue
+		}
+		if held.instanceIDs[id] {
+			logger.Debug("instance-details-already-held", lager.Data{"id": id})
+			rep.outcome(InstanceKind, id, OutcomeSkipped, nil)
+			continue
+		}
+
+		tasks = append(tasks, copyTask{entry: entry, write: func() error {
+			err := toStore.CreateInstanceDetails(id, details)
+			if err != nil {
+				logger.Error("failed-to-create-instance-details", err, lager.Data{"id": id, "service-details": details})
+			}
+			return err
+		}})
+	}
+
+	for _, id := range bindingIDs(bindingDetails) {
+		id, details := id, bindingDetails[id]
+		entry, err := m.journalEntry(BindingKind, id, details)
 		if err != nil {
-			logger.Error("failed-to-create-binding-details", err, lager.Data{"id": id, "binding-details": details})
+			logger.Error("failed-to-checksum-binding-details", err, lager.Data{"id": id})
 			return err
 		}
+		if copied[entry] {
+			logger.Debug("binding-details-already-copied", lager.Data{"id": id})
+			rep.outcome(BindingKind, id, OutcomeSkipped, nil)
+			continue
+		}
+		if held.bindingIDs[id] {
+			logger.Debug("binding-details-already-held", lager.Data{"id": id})
+			rep.outcome(BindingKind, id, OutcomeSkipped, nil)
+			continue
+		}
+
+		tasks = append(tasks, copyTask{entry: entry, write: func() error {
+			err := toStore.CreateBindingDetails(id, details)
+			if err != nil {
+				logger.Error("failed-to-create-binding-details", err, lager.Data{"id": id, "binding-details": details})
+			}
+			return err
+		}})
 	}
 
-	err = toStore.Activate()
+	err := m.run(logger, tasks, written, rep)
 	if err != nil {
 		return err
 	}
 
-	return fromStore.Retire()
+	return m.verify(logger, toStore, instanceDetails, bindingDetails, rep)
+}
+
+func (m *migrator) verify(logger lager.Logger, toStore ActivatableStore, instanceDetails map[string]brokerstore.ServiceInstance, bindingDetails map[string]brokerapi.BindDetails, rep *reporter) error {
+	logger = logger.Session("verify")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	verificationErr := m.compare(logger, toStore, instanceDetails, bindingDetails)
+	rep.outcomes(InstanceKind, verificationErr.InstanceIDs, OutcomeFailed, errVerification)
+	rep.outcomes(BindingKind, verificationErr.BindingIDs, OutcomeFailed, errVerification)
+	return m.verificationResult(logger, verificationErr)
+}
+
+func (m *migrator) compare(logger lager.Logger, toStore ActivatableStore, instanceDetails map[string]brokerstore.ServiceInstance, bindingDetails map[string]brokerapi.BindDetails) *VerificationError {
+	verificationErr := &VerificationError{}
+
+	for id, expected := range instanceDetails {
+		actual, err := toStore.RetrieveInstanceDetails(id)
+		if err != nil {
+			logger.Error("failed-to-retrieve-instance-details", err, lager.Data{"id": id})
+			verificationErr.InstanceIDs = append(verificationErr.InstanceIDs, id)
+			continue
+		}
+		if !instancesEqual(expected, actual) {
+			logger.Info("instance-details-differ", lager.Data{"id": id})
+			verificationErr.InstanceIDs = append(verificationErr.InstanceIDs, id)
+		}
+	}
+
+	for id, expected := range bindingDetails {
+		actual, err := toStore.RetrieveBindingDetails(id)
+		if err != nil {
+			logger.Error("failed-to-retrieve-binding-details", err, lager.Data{"id": id})
+			verificationErr.BindingIDs = append(verificationErr.BindingIDs, id)
+			continue
+		}
+		if !bindingsEqual(expected, actual) {
+			logger.Info("binding-details-differ", lager.Data{"id": id})
+			verificationErr.BindingIDs = append(verificationErr.BindingIDs, id)
+		}
+	}
+
+	return verificationErr
+}
+
+// findUnexpected lists the details held by the target store that the source
+// store does not have.
+func (m *migrator) findUnexpected(logger lager.Logger, toStore ActivatableStore, ids *idSet, verificationErr *VerificationError) error {
+	expected := map[string]bool{}
+	for _, id := range ids.instanceIDs {
+		expected[id] = true
+	}
+
+	targetInstances, err := toStore.RetrieveAllInstanceDetails()
+	if err != nil {
+		logger.Error("failed-to-retrieve-all-target-instance-details", err)
+		return err
+	}
+	for id := range targetInstances {
+		if !expected[id] {
+			logger.Info("unexpected-instance-details", lager.Data{"id": id})
+			verificationErr.UnexpectedInstanceIDs = append(verificationErr.UnexpectedInstanceIDs, id)
+		}
+	}
+
+	expected = map[string]bool{}
+	for _, id := range ids.bindingIDs {
+		expected[id] = true
+	}
+
+	targetBindings, err := toStore.RetrieveAllBindingDetails()
+	if err != nil {
+		logger.Error("failed-to-retrieve-all-target-binding-details", err)
+		return err
+	}
+	for id := range targetBindings {
+		if !expected[id] {
+			logger.Info("unexpected-binding-details", lager.Data{"id": id})
+			verificationErr.UnexpectedBindingIDs = append(verificationErr.UnexpectedBindingIDs, id)
+		}
+	}
+
+	return nil
+}
+
+func (m *migrator) verificationResult(logger lager.Logger, verificationErr *VerificationError) error {
+	if verificationErr.empty() {
+		return nil
+	}
+
+	verificationErr.sort()
+	logger.Error("failed-to-verify", verificationErr, lager.Data{
+		"instances":            verificationErr.InstanceIDs,
+		"bindings":             verificationErr.BindingIDs,
+		"unexpected-instances": verificationErr.UnexpectedInstanceIDs,
+		"unexpected-bindings":  verificationErr.UnexpectedBindingIDs,
+	})
+	return verificationErr
+}
+
+// writeLog records the details written to the target store during a
+// migration, including those written by earlier runs that the journal
+// recorded, so that they can be rolled back. It also holds the details that
+// conflicting ones replaced, so that a rollback writes them back rather than
+// deleting them.
+type writeLog struct {
+	lock              sync.Mutex
+	instanceIDs       map[string]bool
+	bindingIDs        map[string]bool
+	replacedInstances map[string]brokerstore.ServiceInstance
+	replacedBindings  map[string]brokerapi.BindDetails
+}
+
+func newWriteLog() *writeLog {
+	return &writeLog{
+		instanceIDs:       map[string]bool{},
+		bindingIDs:        map[string]bool{},
+		replacedInstances: map[string]brokerstore.ServiceInstance{},
+		replacedBindings:  map[string]brokerapi.BindDetails{},
+	}
+}
+
+func (w *writeLog) add(kind, id string) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if kind == InstanceKind {
+		w.instanceIDs[id] = true
+	} else {
+		w.bindingIDs[id] = true
+	}
+}
+
+// readReplaced reads the details that the target store holds under the
+// conflicting IDs before they are overwritten.
+func (m *migrator) readReplaced(logger lager.Logger, toStore ActivatableStore, conflictErr *ConflictError, written *writeLog) error {
+	for _, id := range conflictErr.InstanceIDs {
+		details, err := toStore.RetrieveInstanceDetails(id)
+		if err != nil {
+			logger.Error("failed-to-retrieve-replaced-instance-details", err, lager.Data{"id": id})
+			return err
+		}
+		written.replacedInstances[id] = details
+	}
+	for _, id := range conflictErr.BindingIDs {
+		details, err := toStore.RetrieveBindingDetails(id)
+		if err != nil {
+			logger.Error("failed-to-retrieve-replaced-binding-details", err, lager.Data{"id": id})
+			return err
+		}
+		written.replacedBindings[id] = details
+	}
+	return nil
+}
+
+// rollback deletes the details written to the target store, and writes back
+// those that overwritten ones replaced.
+func (m *migrator) rollback(logger lager.Logger, toStore ActivatableStore, written *writeLog) {
+	logger = logger.Session("rollback")
+	logger.Info("start", lager.Data{"instances": len(written.instanceIDs), "bindings": len(written.bindingIDs)})
+	defer logger.Info("end")
+
+	for id := range written.bindingIDs {
+		if details, ok := written.replacedBindings[id]; ok {
+			if err := toStore.CreateBindingDetails(id, details); err != nil {
+				logger.Error("failed-to-restore-binding-details", err, lager.Data{"id": id})
+			}
+			continue
+		}
+		if err := toStore.DeleteBindingDetails(id); err != nil {
+			logger.Error("failed-to-delete-binding-details", err, lager.Data{"id": id})
+		}
+	}
+	for id := range written.instanceIDs {
+		if details, ok := written.replacedInstances[id]; ok {
+			if err := toStore.CreateInstanceDetails(id, details); err != nil {
+				logger.Error("failed-to-restore-instance-details", err, lager.Data{"id": id})
+			}
+			continue
+		}
+		if err := toStore.DeleteInstanceDetails(id); err != nil {
+			logger.Error("failed-to-delete-instance-details", err, lager.Data{"id": id})
+		}
+	}
+
+	m.clearJournal(logger)
+}
+
+// readJournal returns the entries recorded by earlier runs and adds them to
+// the write log.
+func (m *migrator) readJournal(logger lager.Logger, written *writeLog) (map[JournalEntry]bool, error) {
+	copied := map[JournalEntry]bool{}
+	if m.journal == nil {
+		return copied, nil
+	}
+
+	entries, err := m.journal.Entries()
+	if err != nil {
+		logger.Error("failed-to-read-journal", err)
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		copied[entry] = true
+		written.add(entry.Kind, entry.ID)
+	}
+	logger.Info("journal", lager.Data{"entries": len(entries)})
+	return copied, nil
+}
+
+func (m *migrator) journalEntry(kind, id string, details interface{}) (JournalEntry, error) {
+	if m.journal == nil {
+		return JournalEntry{Kind: kind, ID: id}, nil
+	}
+
+	sum, err := checksum(details)
+	if err != nil {
+		return JournalEntry{}, err
+	}
+	return JournalEntry{Kind: kind, ID: id, Checksum: sum}, nil
+}
+
+func (m *migrator) record(logger lager.Logger, entry JournalEntry) error {
+	if m.journal == nil {
+		return nil
+	}
+
+	err := m.journal.Record(entry)
+	if err != nil {
+		logger.Error("failed-to-record-journal-entry", err, lager.Data{"kind": entry.Kind, "id": entry.ID})
+	}
+	return err
+}
+
+func (m *migrator) clearJournal(logger lager.Logger) {
+	if m.journal == nil {
+		return
+	}
+
+	if err := m.journal.Clear(); err != nil {
+		logger.Error("failed-to-clear-journal", err)
+	}
 }
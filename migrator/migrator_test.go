@@ -2,10 +2,16 @@ package migrator_test
 
 import (
 	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/pivotal-cf/brokerapi"
+	"golang.org/x/crypto/bcrypt"
 
 	"code.cloudfoundry.org/lager/lagertest"
 	"code.cloudfoundry.org/migrate_mysql_to_credhub/migrator"
@@ -18,6 +24,7 @@ var _ = Describe("Migrator", func() {
 		migrationObj migrator.Migrator
 		fromStore    *fakes.FakeRetirableStore
 		toStore      *fakes.FakeActivatableStore
+		report       migrator.Report
 		err          error
 	)
 
@@ -26,10 +33,11 @@ var _ = Describe("Migrator", func() {
 		migrationObj = migrator.NewMigrator(logger)
 		fromStore = &fakes.FakeRetirableStore{}
 		toStore = &fakes.FakeActivatableStore{}
+		storeDetails(toStore)
 	})
 
 	JustBeforeEach(func() {
-		err = migrationObj.Migrate(fromStore, toStore)
+		report, err = migrationObj.Migrate(fromStore, toStore)
 	})
 
 	Context("before the migration starts", func() {
@@ -44,6 +52,24 @@ var _ = Describe("Migrator", func() {
 				Expect(toStore.CreateInstanceDetailsCallCount()).To(Equal(0))
 				Expect(toStore.CreateBindingDetailsCallCount()).To(Equal(0))
 			})
+
+			Context("when Credhub has not been activated", func() {
+				It("should report the inconsistent state", func() {
+					Expect(err).To(Equal(migrator.ErrInconsistentState))
+					Expect(toStore.ActivateCallCount()).To(Equal(0))
+				})
+			})
+
+			Context("when Credhub has been activated", func() {
+				BeforeEach(func() {
+					toStore.IsActivatedReturns(true, nil)
+				})
+
+				It("should succeed without retiring SQL again", func() {
+					Expect(err).NotTo(HaveOccurred())
+					Expect(fromStore.RetireCallCount()).To(Equal(0))
+				})
+			})
 		})
 
 		Context("when the call to check retirement fails", func() {
@@ -58,13 +84,35 @@ var _ = Describe("Migrator", func() {
 		Context("when Credhub has already been activated", func() {
 			BeforeEach(func() {
 				toStore.IsActivatedReturns(true, nil)
+				fromStore.RetrieveAllInstanceDetailsReturns(map[string]brokerstore.ServiceInstance{
+					"123": brokerstore.ServiceInstance{ServiceID: "some-service-1"},
+				}, nil)
+				Expect(toStore.CreateInstanceDetails("123", brokerstore.ServiceInstance{ServiceID: "some-service-1"})).To(Succeed())
 			})
 
-			It("should skip the migration", func() {
-				Expect(fromStore.RetrieveAllInstanceDetailsCallCount()).To(Equal(0))
-				Expect(fromStore.RetrieveAllBindingDetailsCallCount()).To(Equal(0))
-				Expect(toStore.CreateInstanceDetailsCallCount()).To(Equal(0))
+			It("should not copy the details again", func() {
+				Expect(toStore.CreateInstanceDetailsCallCount()).To(Equal(1))
 				Expect(toStore.CreateBindingDetailsCallCount()).To(Equal(0))
+				Expect(toStore.ActivateCallCount()).To(Equal(0))
+			})
+
+			It("should verify the copied details and complete the migration by retiring SQL", func() {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(toStore.RetrieveInstanceDetailsCallCount()).To(Equal(1))
+				Expect(fromStore.RetireCallCount()).To(Equal(1))
+			})
+
+			Context("when the copied details differ", func() {
+				BeforeEach(func() {
+					fromStore.RetrieveAllInstanceDetailsReturns(map[string]brokerstore.ServiceInstance{
+						"123": brokerstore.ServiceInstance{ServiceID: "some-other-service"},
+					}, nil)
+				})
+
+				It("should not retire SQL", func() {
+					Expect(err).To(BeAssignableToTypeOf(&migrator.VerificationError{}))
+					Expect(fromStore.RetireCallCount()).To(Equal(0))
+				})
 			})
 		})
 
@@ -116,6 +164,464 @@ var _ = Describe("Migrator", func() {
 		})
 	})
 
+	Context("when verifying the migrated data", func() {
+		BeforeEach(func() {
+			fromStore.RetrieveAllInstanceDetailsReturns(map[string]brokerstore.ServiceInstance{
+				"123": brokerstore.ServiceInstance{ServiceID: "some-service-1", ServiceFingerPrint: map[string]interface{}{"size": 5}},
+				"456": brokerstore.ServiceInstance{ServiceID: "some-service-2"},
+			}, nil)
+			fromStore.RetrieveAllBindingDetailsReturns(map[string]brokerapi.BindDetails{
+				"789": brokerapi.BindDetails{AppGUID: "some-app-1", RawParameters: []byte(`{"paramsHash": "some-hash"}`)},
+			}, nil)
+		})
+
+		It("reads every instance and binding back from toStore", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(toStore.RetrieveInstanceDetailsCallCount()).To(Equal(2))
+			Expect(toStore.RetrieveBindingDetailsCallCount()).To(Equal(1))
+			Expect(toStore.RetrieveBindingDetailsArgsForCall(0)).To(Equal("789"))
+		})
+
+		Context("when the details only differ in their JSON encoding", func() {
+			BeforeEach(func() {
+				toStore.RetrieveInstanceDetailsStub = func(id string) (brokerstore.ServiceInstance, error) {
+					if id == "123" {
+						return brokerstore.ServiceInstance{ServiceID: "some-service-1", ServiceFingerPrint: map[string]interface{}{"size": float64(5)}}, nil
+					}
+					return brokerstore.ServiceInstance{ServiceID: "some-service-2"}, nil
+				}
+				toStore.RetrieveBindingDetailsReturns(brokerapi.BindDetails{AppGUID: "some-app-1", RawParameters: []byte(`{"paramsHash":"some-hash"}`)}, nil)
+			})
+
+			It("succeeds", func() {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(toStore.ActivateCallCount()).To(Equal(1))
+			})
+		})
+
+		Context("when an instance reads back differently", func() {
+			BeforeEach(func() {
+				toStore.RetrieveInstanceDetailsStub = func(id string) (brokerstore.ServiceInstance, error) {
+					if id == "123" {
+						return brokerstore.ServiceInstance{ServiceID: "some-service-1", ServiceFingerPrint: map[string]interface{}{"size": "5"}}, nil
+					}
+					return brokerstore.ServiceInstance{ServiceID: "some-service-2"}, nil
+				}
+			})
+
+			It("returns a verification error naming the instance", func() {
+				Expect(err).To(BeAssignableToTypeOf(&migrator.VerificationError{}))
+				Expect(err.(*migrator.VerificationError).InstanceIDs).To(Equal([]string{"123"}))
+				Expect(err.(*migrator.VerificationError).BindingIDs).To(BeEmpty())
+			})
+
+			It("neither activates toStore nor retires fromStore", func() {
+				Expect(toStore.ActivateCallCount()).To(Equal(0))
+				Expect(fromStore.RetireCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when a binding cannot be read back", func() {
+			BeforeEach(func() {
+				toStore.RetrieveBindingDetailsReturns(brokerapi.BindDetails{}, errors.New("not-found"))
+			})
+
+			It("returns a verification error naming the binding", func() {
+				Expect(err).To(BeAssignableToTypeOf(&migrator.VerificationError{}))
+				Expect(err.(*migrator.VerificationError).BindingIDs).To(Equal([]string{"789"}))
+			})
+
+			It("neither activates toStore nor retires fromStore", func() {
+				Expect(toStore.ActivateCallCount()).To(Equal(0))
+				Expect(fromStore.RetireCallCount()).To(Equal(0))
+			})
+		})
+	})
+
+	Context("when writing concurrently", func() {
+		BeforeEach(func() {
+			migrationObj = migrator.NewMigrator(lagertest.NewTestLogger("migrator-test"), migrator.WithConcurrency(4))
+
+			instances := map[string]brokerstore.ServiceInstance{}
+			bindings := map[string]brokerapi.BindDetails{}
+			for i := 0; i < 20; i++ {
+				instances[fmt.Sprintf("instance-%02d", i)] = brokerstore.ServiceInstance{ServiceID: "some-service"}
+				bindings[fmt.Sprintf("binding-%02d", i)] = brokerapi.BindDetails{AppGUID: "some-app"}
+			}
+			fromStore.RetrieveAllInstanceDetailsReturns(instances, nil)
+			fromStore.RetrieveAllBindingDetailsReturns(bindings, nil)
+		})
+
+		It("copies every detail and completes the migration", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(toStore.CreateInstanceDetailsCallCount()).To(Equal(20))
+			Expect(toStore.CreateBindingDetailsCallCount()).To(Equal(20))
+			Expect(toStore.ActivateCallCount()).To(Equal(1))
+			Expect(fromStore.RetireCallCount()).To(Equal(1))
+		})
+
+		Context("when several writes fail", func() {
+			BeforeEach(func() {
+				started := make(chan struct{})
+				release := make(chan struct{})
+				toStore.CreateInstanceDetailsStub = func(id string, details brokerstore.ServiceInstance) error {
+					switch id {
+					case "instance-00":
+						close(started)
+						<-release
+						return errors.New("create-failed-0")
+					case "instance-01":
+						<-started
+						close(release)
+						return errors.New("create-failed-1")
+					}
+					return nil
+				}
+			})
+
+			It("returns every failure in order", func() {
+				Expect(err).To(Equal(&migrator.CopyError{Failures: []migrator.CopyFailure{
+					{Kind: migrator.InstanceKind, ID: "instance-00", Err: errors.New("create-failed-0")},
+					{Kind: migrator.InstanceKind, ID: "instance-01", Err: errors.New("create-failed-1")},
+				}}))
+				Expect(err).To(MatchError("failed to copy 2 detail(s): instance instance-00: create-failed-0; instance instance-01: create-failed-1"))
+			})
+
+			It("neither activates toStore nor retires fromStore", func() {
+				Expect(toStore.ActivateCallCount()).To(Equal(0))
+				Expect(fromStore.RetireCallCount()).To(Equal(0))
+			})
+		})
+	})
+
+	Context("when the migration fails", func() {
+		var failSecondBinding bool
+
+		BeforeEach(func() {
+			failSecondBinding = true
+			fromStore.RetrieveAllInstanceDetailsReturns(map[string]brokerstore.ServiceInstance{
+				"123": brokerstore.ServiceInstance{ServiceID: "some-service-1"},
+			}, nil)
+			fromStore.RetrieveAllBindingDetailsReturns(map[string]brokerapi.BindDetails{
+				"456": brokerapi.BindDetails{AppGUID: "some-app-1"},
+				"789": brokerapi.BindDetails{AppGUID: "some-app-2"},
+			}, nil)
+			createBindingDetails := toStore.CreateBindingDetailsStub
+			toStore.CreateBindingDetailsStub = func(id string, details brokerapi.BindDetails) error {
+				if failSecondBinding && toStore.CreateBindingDetailsCallCount() > 1 {
+					return errors.New("create-failed")
+				}
+				return createBindingDetails(id, details)
+			}
+		})
+
+		It("leaves the written details in place", func() {
+			Expect(err).To(MatchError("failed to copy 1 detail(s): binding 789: create-failed"))
+			Expect(err).To(BeAssignableToTypeOf(&migrator.CopyError{}))
+			Expect(toStore.DeleteInstanceDetailsCallCount()).To(Equal(0))
+			Expect(toStore.DeleteBindingDetailsCallCount()).To(Equal(0))
+		})
+
+		Context("when rollback on failure is enabled", func() {
+			BeforeEach(func() {
+				migrationObj = migrator.NewMigrator(lagertest.NewTestLogger("migrator-test"), migrator.WithRollbackOnFailure())
+			})
+
+			It("deletes the details it wrote before the failure", func() {
+				Expect(err).To(MatchError("failed to copy 1 detail(s): binding 789: create-failed"))
+				Expect(toStore.DeleteInstanceDetailsCallCount()).To(Equal(1))
+				Expect(toStore.DeleteInstanceDetailsArgsForCall(0)).To(Equal("123"))
+				Expect(toStore.DeleteBindingDetailsCallCount()).To(Equal(1))
+				Expect(toStore.DeleteBindingDetailsArgsForCall(0)).To(BeElementOf("456", "789"))
+			})
+
+			It("neither activates toStore nor retires fromStore", func() {
+				Expect(toStore.ActivateCallCount()).To(Equal(0))
+				Expect(fromStore.RetireCallCount()).To(Equal(0))
+			})
+
+			Context("when deleting a detail fails", func() {
+				BeforeEach(func() {
+					toStore.DeleteInstanceDetailsReturns(errors.New("delete-failed"))
+				})
+
+				It("still deletes the remaining details and returns the original error", func() {
+					Expect(err).To(MatchError("failed to copy 1 detail(s): binding 789: create-failed"))
+					Expect(toStore.DeleteBindingDetailsCallCount()).To(Equal(1))
+				})
+			})
+
+			Context("when activating toStore fails", func() {
+				BeforeEach(func() {
+					failSecondBinding = false
+					toStore.ActivateReturns(errors.New("activate-failed"))
+				})
+
+				It("deletes everything it wrote", func() {
+					Expect(err).To(MatchError("activate-failed"))
+					Expect(toStore.DeleteInstanceDetailsCallCount()).To(Equal(1))
+					Expect(toStore.DeleteBindingDetailsCallCount()).To(Equal(2))
+				})
+			})
+
+			Context("when retiring fromStore fails", func() {
+				BeforeEach(func() {
+					failSecondBinding = false
+					fromStore.RetireReturns(errors.New("retire-failed"))
+				})
+
+				It("keeps the activated details", func() {
+					Expect(err).To(MatchError("retire-failed"))
+					Expect(toStore.DeleteInstanceDetailsCallCount()).To(Equal(0))
+					Expect(toStore.DeleteBindingDetailsCallCount()).To(Equal(0))
+				})
+			})
+		})
+	})
+
+	Context("when a journal is used", func() {
+		var (
+			dir     string
+			journal migrator.Journal
+		)
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "journal")
+			Expect(err).NotTo(HaveOccurred())
+			journal = migrator.NewFileJournal(filepath.Join(dir, "journal.jsonl"))
+			migrationObj = migrator.NewMigrator(lagertest.NewTestLogger("migrator-test"), migrator.WithJournal(journal))
+
+			fromStore.RetrieveAllInstanceDetailsReturns(map[string]brokerstore.ServiceInstance{
+				"123": brokerstore.ServiceInstance{ServiceID: "some-service-1"},
+				"456": brokerstore.ServiceInstance{ServiceID: "some-service-2"},
+			}, nil)
+			fromStore.RetrieveAllBindingDetailsReturns(map[string]brokerapi.BindDetails{
+				"789": brokerapi.BindDetails{AppGUID: "some-app-1"},
+			}, nil)
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("clears the journal once the migration is complete", func() {
+			Expect(err).NotTo(HaveOccurred())
+			entries, err := journal.Entries()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(BeEmpty())
+		})
+
+		Context("when an earlier run was interrupted", func() {
+			BeforeEach(func() {
+				createBindingDetails := toStore.CreateBindingDetailsStub
+				toStore.CreateBindingDetailsStub = func(string, brokerapi.BindDetails) error {
+					return errors.New("create-failed")
+				}
+				_, err := migrationObj.Migrate(fromStore, toStore)
+				Expect(err).To(MatchError("failed to copy 1 detail(s): binding 789: create-failed"))
+
+				toStore.CreateBindingDetailsStub = createBindingDetails
+			})
+
+			It("records the details it copied", func() {
+				Expect(toStore.CreateInstanceDetailsCallCount()).To(Equal(2))
+			})
+
+			It("does not copy them again", func() {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(toStore.CreateBindingDetailsCallCount()).To(Equal(2))
+				Expect(toStore.ActivateCallCount()).To(Equal(1))
+			})
+
+			Context("when a recorded detail has since changed in fromStore", func() {
+				BeforeEach(func() {
+					fromStore.RetrieveAllInstanceDetailsReturns(map[string]brokerstore.ServiceInstance{
+						"123": brokerstore.ServiceInstance{ServiceID: "some-service-1"},
+						"456": brokerstore.ServiceInstance{ServiceID: "some-changed-service"},
+					}, nil)
+				})
+
+				It("copies it again", func() {
+					Expect(toStore.CreateInstanceDetailsCallCount()).To(Equal(3))
+					id, details := toStore.CreateInstanceDetailsArgsForCall(2)
+					Expect(id).To(Equal("456"))
+					Expect(details.ServiceID).To(Equal("some-changed-service"))
+				})
+			})
+
+			Context("when rollback on failure is enabled and the rerun fails", func() {
+				BeforeEach(func() {
+					migrationObj = migrator.NewMigrator(lagertest.NewTestLogger("migrator-test"), migrator.WithJournal(journal), migrator.WithRollbackOnFailure())
+					toStore.ActivateReturns(errors.New("activate-failed"))
+				})
+
+				It("also deletes the details copied by the earlier run", func() {
+					Expect(err).To(MatchError("activate-failed"))
+					Expect(toStore.DeleteInstanceDetailsCallCount()).To(Equal(2))
+					Expect(toStore.DeleteBindingDetailsCallCount()).To(Equal(1))
+				})
+
+				It("clears the journal", func() {
+					entries, err := journal.Entries()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(entries).To(BeEmpty())
+				})
+			})
+		})
+
+		Context("when recording a journal entry fails", func() {
+			BeforeEach(func() {
+				fakeJournal := &fakes.FakeJournal{}
+				fakeJournal.RecordReturns(errors.New("record-failed"))
+				migrationObj = migrator.NewMigrator(lagertest.NewTestLogger("migrator-test"), migrator.WithJournal(fakeJournal))
+			})
+
+			It("stops the migration", func() {
+				Expect(err).To(MatchError("failed to copy 1 detail(s): instance 123: record-failed"))
+				Expect(toStore.CreateInstanceDetailsCallCount()).To(Equal(1))
+				Expect(toStore.ActivateCallCount()).To(Equal(0))
+			})
+		})
+	})
+
+	Context("when toStore already holds different details", func() {
+		BeforeEach(func() {
+			fromStore.RetrieveAllInstanceDetailsReturns(map[string]brokerstore.ServiceInstance{
+				"123": brokerstore.ServiceInstance{ServiceID: "some-service-1"},
+				"456": brokerstore.ServiceInstance{ServiceID: "some-service-2"},
+			}, nil)
+			fromStore.RetrieveAllBindingDetailsReturns(map[string]brokerapi.BindDetails{
+				"789": brokerapi.BindDetails{AppGUID: "some-app-1"},
+			}, nil)
+			toStore.IsInstanceConflictStub = func(id string, details brokerstore.ServiceInstance) bool {
+				return id == "456"
+			}
+			toStore.IsBindingConflictReturns(true)
+		})
+
+		It("checks every detail before writing anything", func() {
+			Expect(toStore.IsInstanceConflictCallCount()).To(Equal(2))
+			Expect(toStore.IsBindingConflictCallCount()).To(Equal(1))
+		})
+
+		It("returns a conflict error without writing anything", func() {
+			Expect(err).To(Equal(&migrator.ConflictError{InstanceIDs: []string{"456"}, BindingIDs: []string{"789"}}))
+			Expect(toStore.CreateInstanceDetailsCallCount()).To(Equal(0))
+			Expect(toStore.CreateBindingDetailsCallCount()).To(Equal(0))
+			Expect(toStore.ActivateCallCount()).To(Equal(0))
+			Expect(fromStore.RetireCallCount()).To(Equal(0))
+		})
+
+		Context("when conflicts are skipped", func() {
+			BeforeEach(func() {
+				migrationObj = migrator.NewMigrator(lagertest.NewTestLogger("migrator-test"), migrator.WithConflictPolicy(migrator.ConflictSkip))
+			})
+
+			It("copies only the details that do not conflict", func() {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(toStore.CreateInstanceDetailsCallCount()).To(Equal(1))
+				id, _ := toStore.CreateInstanceDetailsArgsForCall(0)
+				Expect(id).To(Equal("123"))
+				Expect(toStore.CreateBindingDetailsCallCount()).To(Equal(0))
+			})
+
+			It("does not verify the skipped details", func() {
+				Expect(toStore.RetrieveInstanceDetailsCallCount()).To(Equal(1))
+				Expect(toStore.RetrieveBindingDetailsCallCount()).To(Equal(0))
+			})
+
+			It("completes the migration", func() {
+				Expect(toStore.ActivateCallCount()).To(Equal(1))
+				Expect(fromStore.RetireCallCount()).To(Equal(1))
+			})
+		})
+
+		Context("when conflicts are overwritten", func() {
+			BeforeEach(func() {
+				migrationObj = migrator.NewMigrator(lagertest.NewTestLogger("migrator-test"), migrator.WithConflictPolicy(migrator.ConflictOverwrite))
+			})
+
+			It("copies every detail", func() {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(toStore.CreateInstanceDetailsCallCount()).To(Equal(2))
+				Expect(toStore.CreateBindingDetailsCallCount()).To(Equal(1))
+				Expect(toStore.ActivateCallCount()).To(Equal(1))
+			})
+		})
+	})
+
+	Context("when reporting on the migration", func() {
+		BeforeEach(func() {
+			migrationObj = migrator.NewMigrator(lagertest.NewTestLogger("migrator-test"), migrator.WithConflictPolicy(migrator.ConflictSkip))
+			fromStore.RetrieveAllInstanceDetailsReturns(map[string]brokerstore.ServiceInstance{
+				"123": brokerstore.ServiceInstance{ServiceID: "some-service-1"},
+				"456": brokerstore.ServiceInstance{ServiceID: "some-service-2"},
+			}, nil)
+			fromStore.RetrieveAllBindingDetailsReturns(map[string]brokerapi.BindDetails{
+				"789": brokerapi.BindDetails{AppGUID: "some-app-1"},
+			}, nil)
+			toStore.IsInstanceConflictStub = func(id string, details brokerstore.ServiceInstance) bool {
+				return id == "456"
+			}
+		})
+
+		It("reports the outcome of every detail", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(report.Instances).To(Equal([]migrator.Result{
+				{ID: "123", Outcome: migrator.OutcomeCopied},
+				{ID: "456", Outcome: migrator.OutcomeConflicted},
+			}))
+			Expect(report.Bindings).To(Equal([]migrator.Result{
+				{ID: "789", Outcome: migrator.OutcomeCopied},
+			}))
+			Expect(report.Counts["instances"]).To(Equal(map[migrator.Outcome]int{
+				migrator.OutcomeCopied:     1,
+				migrator.OutcomeSkipped:    0,
+				migrator.OutcomeConflicted: 1,
+				migrator.OutcomeFailed:     0,
+			}))
+		})
+
+		It("reports the stores, the final state and how long each phase took", func() {
+			Expect(report.Source).To(Equal("*fakes.FakeRetirableStore"))
+			Expect(report.Target).To(Equal("*fakes.FakeActivatableStore"))
+			Expect(report.State).To(Equal(migrator.StateRetired))
+			Expect(report.StartedAt).NotTo(BeZero())
+			Expect(report.Durations).To(HaveKey("preflight"))
+			Expect(report.Durations).To(HaveKey("copy"))
+			Expect(report.Durations).To(HaveKey("activate"))
+			Expect(report.Durations).To(HaveKey("retire"))
+			Expect(report.Durations).To(HaveKey("total"))
+			Expect(report.Error).To(BeEmpty())
+		})
+
+		Context("when a write fails", func() {
+			BeforeEach(func() {
+				toStore.CreateBindingDetailsReturns(errors.New("create-failed"))
+			})
+
+			It("reports the failure", func() {
+				Expect(err).To(MatchError("failed to copy 1 detail(s): binding 789: create-failed"))
+				Expect(report.Bindings).To(Equal([]migrator.Result{
+					{ID: "789", Outcome: migrator.OutcomeFailed, Error: "create-failed"},
+				}))
+				Expect(report.State).To(Equal(migrator.StateCopying))
+				Expect(report.Error).To(Equal("failed to copy 1 detail(s): binding 789: create-failed"))
+			})
+		})
+
+		Context("when a detail does not read back as it was written", func() {
+			BeforeEach(func() {
+				toStore.RetrieveInstanceDetailsReturns(brokerstore.ServiceInstance{ServiceID: "some-other-service"}, nil)
+			})
+
+			It("reports it as failed", func() {
+				Expect(report.Instances[0]).To(Equal(migrator.Result{ID: "123", Outcome: migrator.OutcomeFailed, Error: "details differ in the target store"}))
+			})
+		})
+	})
+
 	Context("when the migration is complete", func() {
 		It("calls activate on the Credhub store", func() {
 			Expect(err).NotTo(HaveOccurred())
@@ -148,3 +654,289 @@ var _ = Describe("Migrator", func() {
 		})
 	})
 })
+
+var _ = Describe("Plan", func() {
+	var (
+		migrationObj migrator.Migrator
+		fromStore    *fakes.FakeRetirableStore
+		toStore      *fakes.FakeActivatableStore
+		plan         migrator.Plan
+		err          error
+	)
+
+	BeforeEach(func() {
+		logger := lagertest.NewTestLogger("migrator-test")
+		migrationObj = migrator.NewMigrator(logger)
+		fromStore = &fakes.FakeRetirableStore{}
+		toStore = &fakes.FakeActivatableStore{}
+
+		fromStore.RetrieveAllInstanceDetailsReturns(map[string]brokerstore.ServiceInstance{
+			"456": brokerstore.ServiceInstance{ServiceID: "some-service-2"},
+			"123": brokerstore.ServiceInstance{ServiceID: "some-service-1"},
+		}, nil)
+		fromStore.RetrieveAllBindingDetailsReturns(map[string]brokerapi.BindDetails{
+			"789": brokerapi.BindDetails{AppGUID: "some-app-1"},
+		}, nil)
+	})
+
+	JustBeforeEach(func() {
+		plan, err = migrationObj.Plan(fromStore, toStore)
+	})
+
+	It("lists the instances and bindings that would be migrated in order", func() {
+		Expect(err).NotTo(HaveOccurred())
+		Expect(plan.Skipped()).To(BeFalse())
+		Expect(plan.InstanceIDs).To(Equal([]string{"123", "456"}))
+		Expect(plan.BindingIDs).To(Equal([]string{"789"}))
+	})
+
+	It("does not write to either store", func() {
+		Expect(toStore.CreateInstanceDetailsCallCount()).To(Equal(0))
+		Expect(toStore.CreateBindingDetailsCallCount()).To(Equal(0))
+		Expect(toStore.ActivateCallCount()).To(Equal(0))
+		Expect(fromStore.RetireCallCount()).To(Equal(0))
+	})
+
+	It("reports that the migration would copy the details", func() {
+		Expect(plan.State).To(Equal(migrator.StateCopying))
+	})
+
+	Context("when the migration is complete", func() {
+		BeforeEach(func() {
+			fromStore.IsRetiredReturns(true, nil)
+			toStore.IsActivatedReturns(true, nil)
+		})
+
+		It("reports that the migration would be skipped", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(plan.State).To(Equal(migrator.StateRetired))
+			Expect(plan.Skipped()).To(BeTrue())
+			Expect(fromStore.RetrieveAllInstanceDetailsCallCount()).To(Equal(0))
+		})
+	})
+
+	Context("when Credhub has already been activated", func() {
+		BeforeEach(func() {
+			toStore.IsActivatedReturns(true, nil)
+		})
+
+		It("reports that only the retirement is left", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(plan.State).To(Equal(migrator.StateActivated))
+			Expect(plan.Skipped()).To(BeTrue())
+			Expect(fromStore.RetrieveAllInstanceDetailsCallCount()).To(Equal(0))
+		})
+	})
+
+	Context("when SQL has been retired but Credhub has not been activated", func() {
+		BeforeEach(func() {
+			fromStore.IsRetiredReturns(true, nil)
+		})
+
+		It("reports the inconsistent state", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(plan.State).To(Equal(migrator.StateInconsistent))
+			Expect(plan.Skipped()).To(BeTrue())
+		})
+	})
+
+	Context("when toStore already holds different details", func() {
+		BeforeEach(func() {
+			toStore.IsInstanceConflictStub = func(id string, details brokerstore.ServiceInstance) bool {
+				return id == "456"
+			}
+		})
+
+		It("lists the conflicts and how they would be handled", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(plan.ConflictPolicy).To(Equal(migrator.ConflictFail))
+			Expect(plan.InstanceConflicts).To(Equal([]string{"456"}))
+			Expect(plan.BindingConflicts).To(BeEmpty())
+		})
+
+		It("lists the conflicts among the details that would be written", func() {
+			Expect(plan.InstanceIDs).To(Equal([]string{"123", "456"}))
+		})
+
+		Context("when conflicts are skipped", func() {
+			BeforeEach(func() {
+				migrationObj = migrator.NewMigrator(lagertest.NewTestLogger("migrator-test"), migrator.WithConflictPolicy(migrator.ConflictSkip))
+			})
+
+			It("leaves the conflicts out of the details that would be written", func() {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(plan.InstanceIDs).To(Equal([]string{"123"}))
+				Expect(plan.BindingIDs).To(Equal([]string{"789"}))
+				Expect(plan.InstanceConflicts).To(Equal([]string{"456"}))
+			})
+		})
+	})
+
+	Context("when retrieving the binding details fails", func() {
+		BeforeEach(func() {
+			fromStore.RetrieveAllBindingDetailsReturns(nil, errors.New("retrieve-failed"))
+		})
+
+		It("returns the error", func() {
+			Expect(err).To(MatchError("retrieve-failed"))
+		})
+	})
+})
+
+// storeDetails makes the fake remember the details it is given, so that they
+// read back as they were written.
+func storeDetails(store *fakes.FakeActivatableStore) {
+	lock := sync.Mutex{}
+	instances := map[string]brokerstore.ServiceInstance{}
+	bindings := map[string]brokerapi.BindDetails{}
+
+	store.CreateInstanceDetailsStub = func(id string, details brokerstore.ServiceInstance) error {
+		lock.Lock()
+		defer lock.Unlock()
+		instances[id] = details
+		return nil
+	}
+	store.RetrieveInstanceDetailsStub = func(id string) (brokerstore.ServiceInstance, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		details, ok := instances[id]
+		if !ok {
+			return brokerstore.ServiceInstance{}, brokerapi.ErrInstanceDoesNotExist
+		}
+		return details, nil
+	}
+	store.CreateBindingDetailsStub = func(id string, details brokerapi.BindDetails) error {
+		lock.Lock()
+		defer lock.Unlock()
+		bindings[id] = details
+		return nil
+	}
+	store.RetrieveBindingDetailsStub = func(id string) (brokerapi.BindDetails, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		details, ok := bindings[id]
+		if !ok {
+			return brokerapi.BindDetails{}, brokerapi.ErrBindingDoesNotExist
+		}
+		return details, nil
+	}
+}
+
+var _ = Describe("Verify", func() {
+	var (
+		migrationObj migrator.Migrator
+		fromStore    *fakes.FakeRetirableStore
+		toStore      *fakes.FakeActivatableStore
+		err          error
+	)
+
+	BeforeEach(func() {
+		migrationObj = migrator.NewMigrator(lagertest.NewTestLogger("migrator-test"))
+		fromStore = &fakes.FakeRetirableStore{}
+		toStore = &fakes.FakeActivatableStore{}
+
+		instances := map[string]brokerstore.ServiceInstance{
+			"123": brokerstore.ServiceInstance{ServiceID: "some-service-1"},
+		}
+		bindings := map[string]brokerapi.BindDetails{
+			"456": brokerapi.BindDetails{AppGUID: "some-app-1"},
+		}
+		fromStore.RetrieveAllInstanceDetailsReturns(instances, nil)
+		fromStore.RetrieveAllBindingDetailsReturns(bindings, nil)
+		toStore.RetrieveAllInstanceDetailsReturns(instances, nil)
+		toStore.RetrieveAllBindingDetailsReturns(bindings, nil)
+		toStore.RetrieveInstanceDetailsReturns(instances["123"], nil)
+		toStore.RetrieveBindingDetailsReturns(bindings["456"], nil)
+	})
+
+	JustBeforeEach(func() {
+		err = migrationObj.Verify(fromStore, toStore)
+	})
+
+	It("succeeds when both stores hold the same details", func() {
+		Expect(err).NotTo(HaveOccurred())
+		Expect(toStore.RetrieveInstanceDetailsArgsForCall(0)).To(Equal("123"))
+		Expect(toStore.RetrieveBindingDetailsArgsForCall(0)).To(Equal("456"))
+	})
+
+	It("does not write to either store", func() {
+		Expect(toStore.CreateInstanceDetailsCallCount()).To(Equal(0))
+		Expect(toStore.ActivateCallCount()).To(Equal(0))
+		Expect(fromStore.RetireCallCount()).To(Equal(0))
+	})
+
+	Context("when toStore holds details that fromStore does not", func() {
+		BeforeEach(func() {
+			toStore.RetrieveAllInstanceDetailsReturns(map[string]brokerstore.ServiceInstance{
+				"123": brokerstore.ServiceInstance{ServiceID: "some-service-1"},
+				"999": brokerstore.ServiceInstance{ServiceID: "some-other-service"},
+			}, nil)
+			toStore.RetrieveAllBindingDetailsReturns(map[string]brokerapi.BindDetails{
+				"456": brokerapi.BindDetails{AppGUID: "some-app-1"},
+				"888": brokerapi.BindDetails{AppGUID: "some-other-app"},
+			}, nil)
+		})
+
+		It("reports them as unexpected", func() {
+			Expect(err).To(BeAssignableToTypeOf(&migrator.VerificationError{}))
+			verificationErr := err.(*migrator.VerificationError)
+			Expect(verificationErr.UnexpectedInstanceIDs).To(Equal([]string{"999"}))
+			Expect(verificationErr.UnexpectedBindingIDs).To(Equal([]string{"888"}))
+			Expect(verificationErr.InstanceIDs).To(BeEmpty())
+			Expect(err).To(MatchError("verification failed for 0 instance(s) and 0 binding(s), with 1 unexpected instance(s) and 1 unexpected binding(s)"))
+		})
+	})
+
+	Context("when a detail differs", func() {
+		BeforeEach(func() {
+			toStore.RetrieveBindingDetailsReturns(brokerapi.BindDetails{AppGUID: "some-other-app"}, nil)
+		})
+
+		It("reports it", func() {
+			Expect(err).To(BeAssignableToTypeOf(&migrator.VerificationError{}))
+			Expect(err.(*migrator.VerificationError).BindingIDs).To(Equal([]string{"456"}))
+		})
+	})
+
+	Context("when toStore replaced the parameters of a binding by their hash, as SQL does", func() {
+		var hashed []byte
+
+		BeforeEach(func() {
+			hash, err := bcrypt.GenerateFromPassword([]byte(`{"mount":"/data"}`), bcrypt.MinCost)
+			Expect(err).NotTo(HaveOccurred())
+			hashed = []byte(`{"paramsHash":"` + string(hash) + `"}`)
+
+			fromStore.RetrieveAllBindingDetailsReturns(map[string]brokerapi.BindDetails{
+				"456": brokerapi.BindDetails{AppGUID: "some-app-1", RawParameters: []byte(`{"mount":"/data"}`)},
+			}, nil)
+			toStore.RetrieveBindingDetailsReturns(brokerapi.BindDetails{AppGUID: "some-app-1", RawParameters: hashed}, nil)
+		})
+
+		It("succeeds when the hash matches the parameters", func() {
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		Context("when the hash is of other parameters", func() {
+			BeforeEach(func() {
+				fromStore.RetrieveAllBindingDetailsReturns(map[string]brokerapi.BindDetails{
+					"456": brokerapi.BindDetails{AppGUID: "some-app-1", RawParameters: []byte(`{"mount":"/other"}`)},
+				}, nil)
+			})
+
+			It("reports the binding", func() {
+				Expect(err).To(BeAssignableToTypeOf(&migrator.VerificationError{}))
+				Expect(err.(*migrator.VerificationError).BindingIDs).To(Equal([]string{"456"}))
+			})
+		})
+	})
+
+	Context("when listing toStore fails", func() {
+		BeforeEach(func() {
+			toStore.RetrieveAllBindingDetailsReturns(nil, errors.New("list-failed"))
+		})
+
+		It("returns the error", func() {
+			Expect(err).To(MatchError("list-failed"))
+		})
+	})
+})
@@ -0,0 +1,25 @@
+package migrator
+
+//go:generate counterfeiter -o fakes/fake_marked_store.go . MarkedStore
+
+// MarkedStore has both a retirement and an activation marker, so that it can
+// be the source of one migration and the target of another, and either side
+// of a rollback.
+type MarkedStore interface {
+	RetirableStore
+	Unretire() error
+	Activate() error
+	IsActivated() (bool, error)
+	Deactivate() error
+}
+
+// Between returns the source and target of a migration from one store to
+// another, or of its rollback when reverse is set. A rollback copies the
+// details back from the activated store, deactivates it and unretires the
+// store they were migrated from.
+func Between(from, to MarkedStore, reverse bool) (RetirableStore, ActivatableStore) {
+	if reverse {
+		return ReverseSource(to), ReverseTarget(from)
+	}
+	return from, to
+}
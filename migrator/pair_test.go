@@ -0,0 +1,77 @@
+package migrator_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/migrate_mysql_to_credhub/migrator"
+	"code.cloudfoundry.org/migrate_mysql_to_credhub/migrator/fakes"
+	"code.cloudfoundry.org/service-broker-store/brokerstore"
+)
+
+var _ = Describe("Between", func() {
+	var (
+		migrationObj migrator.Migrator
+		fromStore    *fakes.FakeMarkedStore
+		toStore      *fakes.FakeMarkedStore
+	)
+
+	BeforeEach(func() {
+		migrationObj = migrator.NewMigrator(lagertest.NewTestLogger("migrator-test"))
+		fromStore = &fakes.FakeMarkedStore{}
+		toStore = &fakes.FakeMarkedStore{}
+	})
+
+	Context("when migrating", func() {
+		BeforeEach(func() {
+			fromStore.RetrieveAllInstanceDetailsReturns(map[string]brokerstore.ServiceInstance{
+				"123": brokerstore.ServiceInstance{ServiceID: "some-service"},
+			}, nil)
+			toStore.RetrieveInstanceDetailsReturns(brokerstore.ServiceInstance{ServiceID: "some-service"}, nil)
+		})
+
+		It("copies the details to the target, activates it and retires the source", func() {
+			source, target := migrator.Between(fromStore, toStore, false)
+			_, err := migrationObj.Migrate(source, target)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(toStore.CreateInstanceDetailsCallCount()).To(Equal(1))
+			Expect(toStore.ActivateCallCount()).To(Equal(1))
+			Expect(fromStore.RetireCallCount()).To(Equal(1))
+		})
+
+		It("reads the activation marker of the target rather than its retirement marker", func() {
+			toStore.IsRetiredReturns(true, nil)
+
+			source, target := migrator.Between(fromStore, toStore, false)
+			plan, err := migrationObj.Plan(source, target)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(plan.State).To(Equal(migrator.StateCopying))
+			Expect(toStore.IsRetiredCallCount()).To(Equal(0))
+		})
+	})
+
+	Context("when rolling back", func() {
+		BeforeEach(func() {
+			fromStore.IsRetiredReturns(true, nil)
+			toStore.IsActivatedReturns(true, nil)
+			toStore.RetrieveAllInstanceDetailsReturns(map[string]brokerstore.ServiceInstance{
+				"123": brokerstore.ServiceInstance{ServiceID: "some-service"},
+			}, nil)
+			fromStore.RetrieveInstanceDetailsReturns(brokerstore.ServiceInstance{ServiceID: "some-service"}, nil)
+		})
+
+		It("copies the details back, unretires the source and deactivates the target", func() {
+			source, target := migrator.Between(fromStore, toStore, true)
+			_, err := migrationObj.Migrate(source, target)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fromStore.CreateInstanceDetailsCallCount()).To(Equal(1))
+			Expect(fromStore.UnretireCallCount()).To(Equal(1))
+			Expect(toStore.DeactivateCallCount()).To(Equal(1))
+			Expect(fromStore.ActivateCallCount()).To(Equal(0))
+			Expect(toStore.RetireCallCount()).To(Equal(0))
+		})
+	})
+})
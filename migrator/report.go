@@ -0,0 +1,164 @@
+package migrator
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Outcome is what Migrate did with a single detail.
+type Outcome string
+
+const (
+	// OutcomeCopied details were written to the target store.
+	OutcomeCopied Outcome = "copied"
+
+	// OutcomeSkipped details were written to the target store by an earlier
+	// run, as recorded by the journal or by the target store's activation.
+	OutcomeSkipped Outcome = "skipped"
+
+	// OutcomeConflicted details were not written because the target store
+	// already holds them with different content.
+	OutcomeConflicted Outcome = "conflicted"
+
+	// OutcomeFailed details could not be written, or did not read back as
+	// they were written.
+	OutcomeFailed Outcome = "failed"
+)
+
+// Outcomes lists every Outcome in the order reports show them.
+var Outcomes = []Outcome{OutcomeCopied, OutcomeSkipped, OutcomeConflicted, OutcomeFailed}
+
+// Report describes what a call to Migrate did, including when it failed.
+// Details that Migrate did not get to are left out.
+type Report struct {
+	Source    string                     `json:"source"`
+	Target    string                     `json:"target"`
+	State     State                      `json:"state"`
+	StartedAt time.Time                  `json:"started_at"`
+	Durations map[string]float64         `json:"durations_seconds"`
+	Counts    map[string]map[Outcome]int `json:"counts"`
+	Instances []Result                   `json:"instances"`
+	Bindings  []Result                   `json:"bindings"`
+	Error     string                     `json:"error,omitempty"`
+}
+
+// Result is the outcome of a single detail.
+type Result struct {
+	ID      string  `json:"id"`
+	Outcome Outcome `json:"outcome"`
+	Error   string  `json:"error,omitempty"`
+}
+
+// reporter collects the report of a migration from the workers copying it.
+type reporter struct {
+	lock      sync.Mutex
+	report    Report
+	instances map[string]Result
+	bindings  map[string]Result
+}
+
+func newReporter(fromStore RetirableStore, toStore ActivatableStore) *reporter {
+	return &reporter{
+		report: Report{
+			Source:    describe(fromStore),
+			Target:    describe(toStore),
+			StartedAt: time.Now(),
+			Durations: map[string]float64{},
+		},
+		instances: map[string]Result{},
+		bindings:  map[string]Result{},
+	}
+}
+
+// describe names a store by its String method, or else by its type.
+func describe(store interface{}) string {
+	for {
+		if stringer, ok := store.(fmt.Stringer); ok {
+			return stringer.String()
+		}
+		w, ok := store.(wrapper)
+		if !ok {
+			return fmt.Sprintf("%T", store)
+		}
+		store = w.unwrap()
+	}
+}
+
+func (r *reporter) outcome(kind, id string, outcome Outcome, err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	result := Result{ID: id, Outcome: outcome}
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	if kind == InstanceKind {
+		r.instances[id] = result
+	} else {
+		r.bindings[id] = result
+	}
+}
+
+func (r *reporter) outcomes(kind string, ids []string, outcome Outcome, err error) {
+	for _, id := range ids {
+		r.outcome(kind, id, outcome, err)
+	}
+}
+
+func (r *reporter) state(state State) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.report.State = state
+}
+
+// timed runs fn and adds the time it took to the duration of phase.
+func (r *reporter) timed(phase string, fn func() error) error {
+	start := time.Now()
+	err := fn()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.report.Durations[phase] += time.Since(start).Seconds()
+	return err
+}
+
+func (r *reporter) finish(err error) Report {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	report := r.report
+	report.Durations["total"] = time.Since(report.StartedAt).Seconds()
+	report.Instances = results(r.instances)
+	report.Bindings = results(r.bindings)
+	report.Counts = map[string]map[Outcome]int{
+		"instances": counts(report.Instances),
+		"bindings":  counts(report.Bindings),
+	}
+	if err != nil {
+		report.Error = err.Error()
+	}
+	return report
+}
+
+func results(byID map[string]Result) []Result {
+	results := []Result{}
+	for _, result := range byID {
+		results = append(results, result)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].ID < results[j].ID })
+	return results
+}
+
+func counts(results []Result) map[Outcome]int {
+	counts := map[Outcome]int{}
+	for _, outcome := range Outcomes {
+		counts[outcome] = 0
+	}
+	for _, result := range results {
+		counts[result.Outcome]++
+	}
+	return counts
+}
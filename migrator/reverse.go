@@ -0,0 +1,66 @@
+package migrator
+
+//go:generate counterfeiter -o fakes/fake_deactivatable_store.go . DeactivatableStore
+
+// DeactivatableStore is an activated store that can hand its details back to
+// the store it was migrated from.
+type DeactivatableStore interface {
+	ActivatableStore
+	Deactivate() error
+}
+
+//go:generate counterfeiter -o fakes/fake_unretirable_store.go . UnretirableStore
+
+// UnretirableStore is a retired store that can become authoritative again.
+type UnretirableStore interface {
+	RetirableStore
+	Unretire() error
+}
+
+// ReverseSource lets an activated store act as the source of a reverse
+// migration. It counts as retired once it is no longer activated, and
+// retiring it removes its activation marker.
+func ReverseSource(store DeactivatableStore) RetirableStore {
+	return &reverseSource{store}
+}
+
+// ReverseTarget lets a retired store act as the target of a reverse
+// migration. It counts as activated while it is not retired, and activating
+// it removes its retirement marker.
+func ReverseTarget(store UnretirableStore) ActivatableStore {
+	return &reverseTarget{store}
+}
+
+type reverseSource struct {
+	DeactivatableStore
+}
+
+func (s *reverseSource) Retire() error {
+	return s.Deactivate()
+}
+
+func (s *reverseSource) IsRetired() (bool, error) {
+	activated, err := s.IsActivated()
+	return !activated, err
+}
+
+type reverseTarget struct {
+	UnretirableStore
+}
+
+func (s *reverseTarget) Activate() error {
+	return s.Unretire()
+}
+
+func (s *reverseTarget) IsActivated() (bool, error) {
+	retired, err := s.IsRetired()
+	return !retired, err
+}
+
+func (s *reverseSource) unwrap() interface{} {
+	return s.DeactivatableStore
+}
+
+func (s *reverseTarget) unwrap() interface{} {
+	return s.UnretirableStore
+}
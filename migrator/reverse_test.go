@@ -0,0 +1,101 @@
+package migrator_test
+
+import (
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/migrate_mysql_to_credhub/migrator"
+	"code.cloudfoundry.org/migrate_mysql_to_credhub/migrator/fakes"
+	"code.cloudfoundry.org/service-broker-store/brokerstore"
+)
+
+var _ = Describe("Reverse migration", func() {
+	var (
+		migrationObj migrator.Migrator
+		credhubStore *fakes.FakeDeactivatableStore
+		sqlStore     *fakes.FakeUnretirableStore
+		err          error
+	)
+
+	BeforeEach(func() {
+		migrationObj = migrator.NewMigrator(lagertest.NewTestLogger("migrator-test"))
+		credhubStore = &fakes.FakeDeactivatableStore{}
+		credhubStore.IsActivatedReturns(true, nil)
+		credhubStore.RetrieveAllInstanceDetailsReturns(map[string]brokerstore.ServiceInstance{
+			"123": brokerstore.ServiceInstance{ServiceID: "some-service-1"},
+		}, nil)
+
+		sqlStore = &fakes.FakeUnretirableStore{}
+		sqlStore.IsRetiredReturns(true, nil)
+		sqlStore.RetrieveInstanceDetailsReturns(brokerstore.ServiceInstance{ServiceID: "some-service-1"}, nil)
+	})
+
+	JustBeforeEach(func() {
+		_, err = migrationObj.Migrate(migrator.ReverseSource(credhubStore), migrator.ReverseTarget(sqlStore))
+	})
+
+	It("copies the details from the activated store to the retired store", func() {
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sqlStore.CreateInstanceDetailsCallCount()).To(Equal(1))
+		id, details := sqlStore.CreateInstanceDetailsArgsForCall(0)
+		Expect(id).To(Equal("123"))
+		Expect(details.ServiceID).To(Equal("some-service-1"))
+	})
+
+	It("unretires the retired store and then deactivates the activated store", func() {
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sqlStore.UnretireCallCount()).To(Equal(1))
+		Expect(credhubStore.DeactivateCallCount()).To(Equal(1))
+		Expect(sqlStore.RetireCallCount()).To(Equal(0))
+		Expect(credhubStore.ActivateCallCount()).To(Equal(0))
+	})
+
+	Context("when the store to migrate from is not activated", func() {
+		BeforeEach(func() {
+			credhubStore.IsActivatedReturns(false, nil)
+		})
+
+		It("reports that neither store holds the details", func() {
+			Expect(err).To(Equal(migrator.ErrInconsistentState))
+			Expect(credhubStore.RetrieveAllInstanceDetailsCallCount()).To(Equal(0))
+			Expect(sqlStore.UnretireCallCount()).To(Equal(0))
+		})
+	})
+
+	Context("when the store to migrate to is not retired", func() {
+		BeforeEach(func() {
+			sqlStore.IsRetiredReturns(false, nil)
+		})
+
+		It("completes the interrupted migration without copying the details again", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sqlStore.CreateInstanceDetailsCallCount()).To(Equal(0))
+			Expect(sqlStore.UnretireCallCount()).To(Equal(0))
+			Expect(credhubStore.DeactivateCallCount()).To(Equal(1))
+		})
+	})
+
+	Context("when checking for retirement fails", func() {
+		BeforeEach(func() {
+			sqlStore.IsRetiredReturns(false, errors.New("is-retired-failed"))
+		})
+
+		It("returns the error", func() {
+			Expect(err).To(MatchError("is-retired-failed"))
+		})
+	})
+
+	Context("when unretiring fails", func() {
+		BeforeEach(func() {
+			sqlStore.UnretireReturns(errors.New("unretire-failed"))
+		})
+
+		It("does not deactivate the activated store", func() {
+			Expect(err).To(MatchError("unretire-failed"))
+			Expect(credhubStore.DeactivateCallCount()).To(Equal(0))
+		})
+	})
+})
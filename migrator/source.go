@@ -0,0 +1,111 @@
+package migrator
+
+import (
+	"sort"
+
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/service-broker-store/brokerstore"
+	"github.com/pivotal-cf/brokerapi"
+)
+
+// PagedStore is implemented by source stores that can list their details a
+// page at a time, so that a migration does not hold every detail in memory.
+// Each call returns up to limit details with IDs that the store orders after
+// the given ID, and the last of those IDs to start the next page from. An
+// empty after starts from the beginning.
+type PagedStore interface {
+	InstanceDetailsPage(after string, limit int) (map[string]brokerstore.ServiceInstance, string, error)
+	BindingDetailsPage(after string, limit int) (map[string]brokerapi.BindDetails, string, error)
+}
+
+// source hands the details of a source store to fn, all at once or a page at
+// a time. A page only holds one kind of detail, so the other map is empty.
+type source interface {
+	each(fn func(map[string]brokerstore.ServiceInstance, map[string]brokerapi.BindDetails) error) error
+}
+
+// source reads the details of fromStore a page at a time if it supports it
+// and a page size was given, or else all at once.
+func (m *migrator) source(logger lager.Logger, fromStore RetirableStore) (source, error) {
+	if pagedStore, ok := fromStore.(PagedStore); ok && m.pageSize > 0 {
+		logger.Info("reading-pages", lager.Data{"page-size": m.pageSize})
+		return &pagedSource{logger: logger, store: pagedStore, pageSize: m.pageSize}, nil
+	}
+
+	instanceDetails, bindingDetails, err := m.retrieve(logger, fromStore)
+	if err != nil {
+		return nil, err
+	}
+	return &wholeSource{instanceDetails: instanceDetails, bindingDetails: bindingDetails}, nil
+}
+
+type wholeSource struct {
+	instanceDetails map[string]brokerstore.ServiceInstance
+	bindingDetails  map[string]brokerapi.BindDetails
+}
+
+func (s *wholeSource) each(fn func(map[string]brokerstore.ServiceInstance, map[string]brokerapi.BindDetails) error) error {
+	return fn(s.instanceDetails, s.bindingDetails)
+}
+
+type pagedSource struct {
+	logger   lager.Logger
+	store    PagedStore
+	pageSize int
+}
+
+func (s *pagedSource) each(fn func(map[string]brokerstore.ServiceInstance, map[string]brokerapi.BindDetails) error) error {
+	after := ""
+	for {
+		instanceDetails, last, err := s.store.InstanceDetailsPage(after, s.pageSize)
+		if err != nil {
+			s.logger.Error("failed-to-retrieve-instance-details-page", err, lager.Data{"after": after})
+			return err
+		}
+		if len(instanceDetails) == 0 {
+			break
+		}
+
+		err = fn(instanceDetails, map[string]brokerapi.BindDetails{})
+		if err != nil {
+			return err
+		}
+		after = last
+	}
+
+	after = ""
+	for {
+		bindingDetails, last, err := s.store.BindingDetailsPage(after, s.pageSize)
+		if err != nil {
+			s.logger.Error("failed-to-retrieve-binding-details-page", err, lager.Data{"after": after})
+			return err
+		}
+		if len(bindingDetails) == 0 {
+			break
+		}
+
+		err = fn(map[string]brokerstore.ServiceInstance{}, bindingDetails)
+		if err != nil {
+			return err
+		}
+		after = last
+	}
+
+	return nil
+}
+
+// idSet collects the IDs of the details a source hands out.
+type idSet struct {
+	instanceIDs []string
+	bindingIDs  []string
+}
+
+func (s *idSet) add(instanceDetails map[string]brokerstore.ServiceInstance, bindingDetails map[string]brokerapi.BindDetails) {
+	s.instanceIDs = append(s.instanceIDs, instanceIDs(instanceDetails)...)
+	s.bindingIDs = append(s.bindingIDs, bindingIDs(bindingDetails)...)
+}
+
+func (s *idSet) sort() {
+	sort.Strings(s.instanceIDs)
+	sort.Strings(s.bindingIDs)
+}
@@ -0,0 +1,156 @@
+package migrator_test
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf/brokerapi"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/migrate_mysql_to_credhub/migrator"
+	"code.cloudfoundry.org/migrate_mysql_to_credhub/migrator/fakes"
+	"code.cloudfoundry.org/service-broker-store/brokerstore"
+)
+
+var _ = Describe("Paged migration", func() {
+	var (
+		migrationObj migrator.Migrator
+		fromStore    *pagedStore
+		toStore      *fakes.FakeActivatableStore
+		err          error
+	)
+
+	BeforeEach(func() {
+		migrationObj = migrator.NewMigrator(lagertest.NewTestLogger("migrator-test"), migrator.WithPageSize(2))
+		fromStore = &pagedStore{
+			FakeRetirableStore: &fakes.FakeRetirableStore{},
+			instances:          map[string]brokerstore.ServiceInstance{},
+			bindings:           map[string]brokerapi.BindDetails{},
+		}
+		for i := 0; i < 5; i++ {
+			fromStore.instances[fmt.Sprintf("instance-%d", i)] = brokerstore.ServiceInstance{ServiceID: "some-service"}
+			fromStore.bindings[fmt.Sprintf("binding-%d", i)] = brokerapi.BindDetails{AppGUID: "some-app"}
+		}
+		toStore = &fakes.FakeActivatableStore{}
+		storeDetails(toStore)
+		fromStore.toStore = toStore
+		fromStore.writtenBeforePage = map[string]int{}
+	})
+
+	JustBeforeEach(func() {
+		_, err = migrationObj.Migrate(fromStore, toStore)
+	})
+
+	It("reads the details a page at a time", func() {
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fromStore.RetrieveAllInstanceDetailsCallCount()).To(Equal(0))
+		Expect(fromStore.RetrieveAllBindingDetailsCallCount()).To(Equal(0))
+		Expect(fromStore.instancePages).To(Equal([]string{"", "instance-1", "instance-3", "instance-4", "", "instance-1", "instance-3", "instance-4"}))
+	})
+
+	It("copies every detail and completes the migration", func() {
+		Expect(err).NotTo(HaveOccurred())
+		Expect(toStore.CreateInstanceDetailsCallCount()).To(Equal(5))
+		Expect(toStore.CreateBindingDetailsCallCount()).To(Equal(5))
+		Expect(toStore.ActivateCallCount()).To(Equal(1))
+		Expect(fromStore.RetireCallCount()).To(Equal(1))
+	})
+
+	It("writes each page before reading the next", func() {
+		Expect(fromStore.writtenBeforePage["instance-1"]).To(Equal(2))
+		Expect(fromStore.writtenBeforePage["instance-3"]).To(Equal(4))
+	})
+
+	Context("when reading a page fails", func() {
+		BeforeEach(func() {
+			fromStore.bindingErr = errors.New("page-failed")
+		})
+
+		It("returns the error without writing anything", func() {
+			Expect(err).To(MatchError("page-failed"))
+			Expect(toStore.CreateInstanceDetailsCallCount()).To(Equal(0))
+			Expect(toStore.ActivateCallCount()).To(Equal(0))
+		})
+	})
+
+	Context("without a page size", func() {
+		BeforeEach(func() {
+			migrationObj = migrator.NewMigrator(lagertest.NewTestLogger("migrator-test"))
+			fromStore.RetrieveAllInstanceDetailsReturns(fromStore.instances, nil)
+			fromStore.RetrieveAllBindingDetailsReturns(fromStore.bindings, nil)
+		})
+
+		It("reads every detail at once", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fromStore.RetrieveAllInstanceDetailsCallCount()).To(Equal(1))
+			Expect(fromStore.instancePages).To(BeEmpty())
+			Expect(toStore.CreateInstanceDetailsCallCount()).To(Equal(5))
+		})
+	})
+})
+
+// pagedStore is a source store that hands out its details a page at a time,
+// recording where each page started and how many instances had been written
+// to the target store by then.
+type pagedStore struct {
+	*fakes.FakeRetirableStore
+	instances         map[string]brokerstore.ServiceInstance
+	bindings          map[string]brokerapi.BindDetails
+	bindingErr        error
+	instancePages     []string
+	writtenBeforePage map[string]int
+	toStore           *fakes.FakeActivatableStore
+}
+
+func (s *pagedStore) InstanceDetailsPage(after string, limit int) (map[string]brokerstore.ServiceInstance, string, error) {
+	s.instancePages = append(s.instancePages, after)
+	s.writtenBeforePage[after] = s.toStore.CreateInstanceDetailsCallCount()
+
+	page := map[string]brokerstore.ServiceInstance{}
+	last := ""
+	for _, id := range pageIDs(s.instances, after, limit) {
+		page[id] = s.instances[id]
+		last = id
+	}
+	return page, last, nil
+}
+
+func (s *pagedStore) BindingDetailsPage(after string, limit int) (map[string]brokerapi.BindDetails, string, error) {
+	if s.bindingErr != nil {
+		return nil, "", s.bindingErr
+	}
+
+	page := map[string]brokerapi.BindDetails{}
+	last := ""
+	for _, id := range pageIDs(s.bindings, after, limit) {
+		page[id] = s.bindings[id]
+		last = id
+	}
+	return page, last, nil
+}
+
+func pageIDs(details interface{}, after string, limit int) []string {
+	var ids []string
+	switch d := details.(type) {
+	case map[string]brokerstore.ServiceInstance:
+		for id := range d {
+			ids = append(ids, id)
+		}
+	case map[string]brokerapi.BindDetails:
+		for id := range d {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	var page []string
+	for _, id := range ids {
+		if id > after && len(page) < limit {
+			page = append(page, id)
+		}
+	}
+	return page
+}
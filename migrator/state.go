@@ -0,0 +1,63 @@
+package migrator
+
+import (
+	"errors"
+
+	"code.cloudfoundry.org/lager"
+)
+
+// State is how far a migration has got, as recorded by the retirement marker
+// of the source store and the activation marker of the target store. Migrate
+// moves from StateCopying to StateActivated to StateRetired, so a run that
+// was interrupted can be completed by the next one.
+type State string
+
+const (
+	// StateCopying is the state before the target store is activated. Details
+	// may already have been copied by an interrupted run.
+	StateCopying State = "copying"
+
+	// StateActivated is the state once the target store is activated and
+	// before the source store is retired.
+	StateActivated State = "activated"
+
+	// StateRetired is the state of a complete migration.
+	StateRetired State = "retired"
+
+	// StateInconsistent is the state of a source store that is retired while
+	// the target store is not activated, which Migrate never leaves behind.
+	StateInconsistent State = "inconsistent"
+)
+
+// ErrInconsistentState is returned by Migrate when the source store is
+// retired but the target store is not activated, so that neither holds the
+// broker's state.
+var ErrInconsistentState = errors.New("the source store is retired but the target store is not activated")
+
+func (m *migrator) state(logger lager.Logger, fromStore RetirableStore, toStore ActivatableStore) (State, error) {
+	retired, err := fromStore.IsRetired()
+	if err != nil {
+		logger.Error("failed-to-check-if-source-is-retired", err)
+		return "", err
+	}
+
+	activated, err := toStore.IsActivated()
+	if err != nil {
+		logger.Error("failed-to-check-if-target-is-activated", err)
+		return "", err
+	}
+
+	switch {
+	case retired && activated:
+		logger.Info("source-already-retired")
+		return StateRetired, nil
+	case retired:
+		logger.Info("source-retired-but-target-not-activated")
+		return StateInconsistent, nil
+	case activated:
+		logger.Info("target-already-activated")
+		return StateActivated, nil
+	default:
+		return StateCopying, nil
+	}
+}
@@ -0,0 +1,109 @@
+package migrator
+
+import (
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/service-broker-store/brokerstore"
+)
+
+// Counter is implemented by stores that can count the details they hold
+// without reading each of them.
+type Counter interface {
+	CountInstanceDetails() (int, error)
+	CountBindingDetails() (int, error)
+}
+
+// Status describes both stores of a migration without changing either.
+type Status struct {
+	State  State       `json:"state"`
+	Source StoreStatus `json:"source"`
+	Target StoreStatus `json:"target"`
+}
+
+// StoreStatus describes one store of a migration. Marked is whether the
+// source store is retired, or whether the target store is activated.
+type StoreStatus struct {
+	Store     string `json:"store"`
+	Marked    bool   `json:"marked"`
+	Instances int    `json:"instances"`
+	Bindings  int    `json:"bindings"`
+}
+
+// Inconsistent reports whether only one of the stores holds its marker,
+// which is left behind by a migration that was interrupted or by changes
+// made to either store by hand.
+func (s Status) Inconsistent() bool {
+	return s.Source.Marked != s.Target.Marked
+}
+
+func (m *migrator) Status(fromStore RetirableStore, toStore ActivatableStore) (Status, error) {
+	logger := m.logger.Session("status")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	state, err := m.state(logger, fromStore, toStore)
+	if err != nil {
+		return Status{}, err
+	}
+
+	source, err := storeStatus(logger, fromStore)
+	if err != nil {
+		return Status{}, err
+	}
+	source.Marked = state == StateRetired || state == StateInconsistent
+
+	target, err := storeStatus(logger, toStore)
+	if err != nil {
+		return Status{}, err
+	}
+	target.Marked = state == StateRetired || state == StateActivated
+
+	return Status{State: state, Source: source, Target: target}, nil
+}
+
+func storeStatus(logger lager.Logger, store brokerstore.Store) (StoreStatus, error) {
+	counter := counterFor(store)
+
+	instances, err := counter.CountInstanceDetails()
+	if err != nil {
+		logger.Error("failed-to-count-instance-details", err, lager.Data{"store": describe(store)})
+		return StoreStatus{}, err
+	}
+
+	bindings, err := counter.CountBindingDetails()
+	if err != nil {
+		logger.Error("failed-to-count-binding-details", err, lager.Data{"store": describe(store)})
+		return StoreStatus{}, err
+	}
+
+	return StoreStatus{Store: describe(store), Instances: instances, Bindings: bindings}, nil
+}
+
+// counterFor finds the Counter of a store, looking through the wrappers
+// that reverse a migration, or else counts the details the store lists.
+func counterFor(store brokerstore.Store) Counter {
+	for s := interface{}(store); ; {
+		if counter, ok := s.(Counter); ok {
+			return counter
+		}
+		w, ok := s.(wrapper)
+		if !ok {
+			break
+		}
+		s = w.unwrap()
+	}
+	return &listingCounter{store}
+}
+
+type listingCounter struct {
+	brokerstore.Store
+}
+
+func (c *listingCounter) CountInstanceDetails() (int, error) {
+	instances, err := c.RetrieveAllInstanceDetails()
+	return len(instances), err
+}
+
+func (c *listingCounter) CountBindingDetails() (int, error) {
+	bindings, err := c.RetrieveAllBindingDetails()
+	return len(bindings), err
+}
@@ -0,0 +1,171 @@
+package migrator_test
+
+import (
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf/brokerapi"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/migrate_mysql_to_credhub/migrator"
+	"code.cloudfoundry.org/migrate_mysql_to_credhub/migrator/fakes"
+	"code.cloudfoundry.org/service-broker-store/brokerstore"
+)
+
+var _ = Describe("Status", func() {
+	var (
+		migrationObj migrator.Migrator
+		fromStore    *fakes.FakeRetirableStore
+		source       migrator.RetirableStore
+		toStore      *fakes.FakeActivatableStore
+		status       migrator.Status
+		err          error
+	)
+
+	BeforeEach(func() {
+		migrationObj = migrator.NewMigrator(lagertest.NewTestLogger("migrator-test"))
+		fromStore = &fakes.FakeRetirableStore{}
+		source = fromStore
+		toStore = &fakes.FakeActivatableStore{}
+
+		fromStore.RetrieveAllInstanceDetailsReturns(map[string]brokerstore.ServiceInstance{
+			"123": brokerstore.ServiceInstance{ServiceID: "some-service-1"},
+			"456": brokerstore.ServiceInstance{ServiceID: "some-service-2"},
+		}, nil)
+		fromStore.RetrieveAllBindingDetailsReturns(map[string]brokerapi.BindDetails{
+			"789": brokerapi.BindDetails{AppGUID: "some-app"},
+		}, nil)
+		toStore.RetrieveAllInstanceDetailsReturns(map[string]brokerstore.ServiceInstance{
+			"123": brokerstore.ServiceInstance{ServiceID: "some-service-1"},
+		}, nil)
+	})
+
+	JustBeforeEach(func() {
+		status, err = migrationObj.Status(source, toStore)
+	})
+
+	It("counts the details held by each store", func() {
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status.Source).To(Equal(migrator.StoreStatus{Store: "*fakes.FakeRetirableStore", Instances: 2, Bindings: 1}))
+		Expect(status.Target).To(Equal(migrator.StoreStatus{Store: "*fakes.FakeActivatableStore", Instances: 1, Bindings: 0}))
+	})
+
+	It("changes neither store", func() {
+		Expect(toStore.CreateInstanceDetailsCallCount()).To(Equal(0))
+		Expect(toStore.ActivateCallCount()).To(Equal(0))
+		Expect(fromStore.RetireCallCount()).To(Equal(0))
+	})
+
+	Context("before the migration", func() {
+		It("reports that neither store is marked", func() {
+			Expect(status.State).To(Equal(migrator.StateCopying))
+			Expect(status.Source.Marked).To(BeFalse())
+			Expect(status.Target.Marked).To(BeFalse())
+			Expect(status.Inconsistent()).To(BeFalse())
+		})
+	})
+
+	Context("after the migration", func() {
+		BeforeEach(func() {
+			fromStore.IsRetiredReturns(true, nil)
+			toStore.IsActivatedReturns(true, nil)
+		})
+
+		It("reports that both stores are marked", func() {
+			Expect(status.State).To(Equal(migrator.StateRetired))
+			Expect(status.Source.Marked).To(BeTrue())
+			Expect(status.Target.Marked).To(BeTrue())
+			Expect(status.Inconsistent()).To(BeFalse())
+		})
+	})
+
+	Context("when the target store is activated but the source store is not retired", func() {
+		BeforeEach(func() {
+			toStore.IsActivatedReturns(true, nil)
+		})
+
+		It("reports an inconsistent status", func() {
+			Expect(status.State).To(Equal(migrator.StateActivated))
+			Expect(status.Target.Marked).To(BeTrue())
+			Expect(status.Inconsistent()).To(BeTrue())
+		})
+	})
+
+	Context("when the source store is retired but the target store is not activated", func() {
+		BeforeEach(func() {
+			fromStore.IsRetiredReturns(true, nil)
+		})
+
+		It("reports an inconsistent status", func() {
+			Expect(status.State).To(Equal(migrator.StateInconsistent))
+			Expect(status.Source.Marked).To(BeTrue())
+			Expect(status.Inconsistent()).To(BeTrue())
+		})
+	})
+
+	Context("when a store can count its details", func() {
+		BeforeEach(func() {
+			counter := &countingStore{FakeRetirableStore: fromStore, instances: 1000, bindings: 2000}
+			source = migrator.ReverseSource(&deactivatableStore{counter})
+		})
+
+		It("counts them without listing them", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(status.Source.Instances).To(Equal(1000))
+			Expect(status.Source.Bindings).To(Equal(2000))
+			Expect(fromStore.RetrieveAllInstanceDetailsCallCount()).To(Equal(0))
+		})
+	})
+
+	Context("when checking a marker fails", func() {
+		BeforeEach(func() {
+			toStore.IsActivatedReturns(false, errors.New("activated-failed"))
+		})
+
+		It("returns the error", func() {
+			Expect(err).To(MatchError("activated-failed"))
+		})
+	})
+
+	Context("when listing the details fails", func() {
+		BeforeEach(func() {
+			toStore.RetrieveAllBindingDetailsReturns(nil, errors.New("list-failed"))
+		})
+
+		It("returns the error", func() {
+			Expect(err).To(MatchError("list-failed"))
+		})
+	})
+})
+
+type countingStore struct {
+	*fakes.FakeRetirableStore
+	instances, bindings int
+}
+
+func (s *countingStore) CountInstanceDetails() (int, error) {
+	return s.instances, nil
+}
+
+func (s *countingStore) CountBindingDetails() (int, error) {
+	return s.bindings, nil
+}
+
+// deactivatableStore lets a retirable store act as the source of a reverse
+// migration, so that counting can be checked through the wrapper.
+type deactivatableStore struct {
+	*countingStore
+}
+
+func (s *deactivatableStore) Activate() error {
+	return nil
+}
+
+func (s *deactivatableStore) IsActivated() (bool, error) {
+	return true, nil
+}
+
+func (s *deactivatableStore) Deactivate() error {
+	return nil
+}
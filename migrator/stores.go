@@ -0,0 +1,59 @@
+package migrator
+
+import (
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/service-broker-store/brokerstore"
+	"github.com/pivotal-cf/brokerapi"
+)
+
+// StoreComparer compares details with those a store holds, read through the
+// retrieve functions of the store. Stores embed it to implement Comparer,
+// and IsInstanceConflict and IsBindingConflict of brokerstore.Store. Those
+// also report details that cannot be compared, so that they are never taken
+// for absent ones.
+type StoreComparer struct {
+	retrieveInstance func(id string) (brokerstore.ServiceInstance, error)
+	retrieveBinding  func(id string) (brokerapi.BindDetails, error)
+}
+
+func NewStoreComparer(retrieveInstance func(id string) (brokerstore.ServiceInstance, error), retrieveBinding func(id string) (brokerapi.BindDetails, error)) StoreComparer {
+	return StoreComparer{
+		retrieveInstance: retrieveInstance,
+		retrieveBinding:  retrieveBinding,
+	}
+}
+
+func (c StoreComparer) CompareInstanceDetails(id string, details brokerstore.ServiceInstance) (Comparison, error) {
+	return CompareInstance(c.retrieveInstance, id, details)
+}
+
+func (c StoreComparer) CompareBindingDetails(id string, details brokerapi.BindDetails) (Comparison, error) {
+	return CompareBinding(c.retrieveBinding, id, details)
+}
+
+func (c StoreComparer) IsInstanceConflict(id string, details brokerstore.ServiceInstance) bool {
+	comparison, err := c.CompareInstanceDetails(id, details)
+	return comparison == Conflicting || err != nil
+}
+
+func (c StoreComparer) IsBindingConflict(id string, details brokerapi.BindDetails) bool {
+	comparison, err := c.CompareBindingDetails(id, details)
+	return comparison == Conflicting || err != nil
+}
+
+// WriteThrough implements Restore, Save and Cleanup of brokerstore.Store for
+// stores that write every detail as it is created, and so have nothing to
+// restore, save or clean up.
+type WriteThrough struct{}
+
+func (WriteThrough) Restore(logger lager.Logger) error {
+	return nil
+}
+
+func (WriteThrough) Save(logger lager.Logger) error {
+	return nil
+}
+
+func (WriteThrough) Cleanup() error {
+	return nil
+}
@@ -0,0 +1,96 @@
+package migrator
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"code.cloudfoundry.org/lager"
+)
+
+// CopyError lists the details that could not be copied, in the order they
+// were to be written. It is returned however many writes failed, one
+// included.
+type CopyError struct {
+	Failures []CopyFailure
+}
+
+type CopyFailure struct {
+	Kind string
+	ID   string
+	Err  error
+}
+
+func (e *CopyError) Error() string {
+	failures := make([]string, len(e.Failures))
+	for i, f := range e.Failures {
+		failures[i] = fmt.Sprintf("%s %s: %s", f.Kind, f.ID, f.Err)
+	}
+	return fmt.Sprintf("failed to copy %d detail(s): %s", len(e.Failures), strings.Join(failures, "; "))
+}
+
+// copyTask writes a single detail to the target store.
+type copyTask struct {
+	entry JournalEntry
+	write func() error
+}
+
+// run performs the tasks on m.concurrency workers. Once a task fails no
+// further tasks are started, and the failures of the tasks already started
+// are returned in task order as a CopyError, however many there are.
+func (m *migrator) run(logger lager.Logger, tasks []copyTask, written *writeLog, rep *reporter) error {
+	errs := make([]error, len(tasks))
+	var failed int32
+
+	indexes := make(chan int)
+	wg := sync.WaitGroup{}
+	for w := 0; w < m.concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if atomic.LoadInt32(&failed) != 0 {
+					continue
+				}
+				errs[i] = m.runTask(logger, tasks[i], written, rep)
+				if errs[i] != nil {
+					atomic.StoreInt32(&failed, 1)
+				}
+			}
+		}()
+	}
+
+	for i := range tasks {
+		if atomic.LoadInt32(&failed) != 0 {
+			break
+		}
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	copyErr := &CopyError{}
+	for i, err := range errs {
+		if err != nil {
+			copyErr.Failures = append(copyErr.Failures, CopyFailure{Kind: tasks[i].entry.Kind, ID: tasks[i].entry.ID, Err: err})
+		}
+	}
+
+	if len(copyErr.Failures) == 0 {
+		return nil
+	}
+	return copyErr
+}
+
+func (m *migrator) runTask(logger lager.Logger, task copyTask, written *writeLog, rep *reporter) error {
+	err := task.write()
+	if err != nil {
+		rep.outcome(task.entry.Kind, task.entry.ID, OutcomeFailed, err)
+		return err
+	}
+	written.add(task.entry.Kind, task.entry.ID)
+	rep.outcome(task.entry.Kind, task.entry.ID, OutcomeCopied, nil)
+
+	return m.record(logger, task.entry)
+}
@@ -0,0 +1,13 @@
+package sqlstore_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestSqlstore(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Sqlstore Suite")
+}
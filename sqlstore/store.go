@@ -0,0 +1,373 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/migrate_mysql_to_credhub/migrator"
+	"code.cloudfoundry.org/service-broker-store/brokerstore"
+	"github.com/pivotal-cf/brokerapi"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	retirementMarker = "migrated-to-credhub"
+	activationMarker = "migrated-from-another-store"
+	stateTable       = "migration_state"
+)
+
+// ErrReservedID is returned when asked to store an instance under the ID of
+// the retirement marker that earlier versions kept in service_instances.
+var ErrReservedID = errors.New("instance id " + retirementMarker + " is reserved")
+
+// Store is a brokerstore.SqlStore that keeps its retirement marker in a
+// migration_state table of its own rather than in service_instances, can
+// remove it again, and can be written to as the target of a reverse
+// migration. Markers left in service_instances by earlier versions are still
+// recognised, and are never listed as instances. It also keeps an activation
+// marker in migration_state, so that it can be the target of a migration
+// from another store.
+type Store struct {
+	*brokerstore.SqlStore
+	migrator.StoreComparer
+	logger      lager.Logger
+	variant     brokerstore.SqlVariant
+	description string
+}
+
+func NewStore(logger lager.Logger, dbDriver, username, password, host, port, dbName, caCert string, skipHostnameValidation bool) (*Store, error) {
+	var variant brokerstore.SqlVariant
+	switch dbDriver {
+	case "mysql":
+		variant = brokerstore.NewMySqlVariant(username, password, host, port, dbName, caCert, skipHostnameValidation)
+	case "postgres":
+		variant = brokerstore.NewPostgresVariant(username, password, host, port, dbName, caCert)
+	default:
+		err := fmt.Errorf("Unrecognized Driver: %s", dbDriver)
+		logger.Error("db-driver-unrecognized", err)
+		return nil, err
+	}
+
+	sqlStore, err := brokerstore.NewSqlStoreWithVariant(logger, variant)
+	if err != nil {
+		return nil, err
+	}
+
+	return newStore(logger, sqlStore, variant, fmt.Sprintf("%s://%s:%s/%s", dbDriver, host, port, dbName))
+}
+
+func NewStoreWithVariant(logger lager.Logger, variant brokerstore.SqlVariant) (*Store, error) {
+	sqlStore, err := brokerstore.NewSqlStoreWithVariant(logger, variant)
+	if err != nil {
+		return nil, err
+	}
+
+	return newStore(logger, sqlStore, variant, "sql")
+}
+
+func newStore(logger lager.Logger, sqlStore *brokerstore.SqlStore, variant brokerstore.SqlVariant, description string) (*Store, error) {
+	_, err := sqlStore.Database.Exec(`
+			CREATE TABLE IF NOT EXISTS migration_state(
+				id VARCHAR(255) PRIMARY KEY,
+				value VARCHAR(4096)
+			)
+		`)
+	if err != nil {
+		logger.Error("sql-failed-to-create-migration-state-table", err)
+		return nil, err
+	}
+
+	s := &Store{
+		SqlStore:    sqlStore,
+		logger:      logger,
+		variant:     variant,
+		description: description,
+	}
+	s.StoreComparer = migrator.NewStoreComparer(s.RetrieveInstanceDetails, s.RetrieveBindingDetails)
+	return s, nil
+}
+
+// String names the database the store is connected to, without credentials.
+func (s *Store) String() string {
+	return s.description
+}
+
+func (s *Store) Retire() error {
+	s.logger.Info("retiring-sql")
+	_, err := s.Database.Exec("INSERT INTO migration_state (id, value) VALUES (?, ?)", retirementMarker, "true")
+	return err
+}
+
+func (s *Store) IsRetired() (bool, error) {
+	var value string
+	err := s.Database.QueryRow("SELECT value FROM migration_state WHERE id = ?", retirementMarker).Scan(&value)
+	if err == nil {
+		return true, nil
+	}
+	if err != sql.ErrNoRows {
+		return false, err
+	}
+
+	return s.SqlStore.IsRetired()
+}
+
+func (s *Store) Unretire() error {
+	s.logger.Info("unretiring-sql")
+	_, err := s.Database.Exec("DELETE FROM migration_state WHERE id = ?", retirementMarker)
+	if err != nil {
+		return err
+	}
+	_, err = s.Database.Exec("DELETE FROM service_instances WHERE id = ?", retirementMarker)
+	return err
+}
+
+func (s *Store) Activate() error {
+	s.logger.Info("activating-sql")
+	_, err := s.Database.Exec("INSERT INTO migration_state (id, value) VALUES (?, ?)", activationMarker, "true")
+	return err
+}
+
+func (s *Store) IsActivated() (bool, error) {
+	var value string
+	err := s.Database.QueryRow("SELECT value FROM migration_state WHERE id = ?", activationMarker).Scan(&value)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *Store) Deactivate() error {
+	s.logger.Info("deactivating-sql")
+	_, err := s.Database.Exec("DELETE FROM migration_state WHERE id = ?", activationMarker)
+	return err
+}
+
+// RetrieveAllInstanceDetails lists every instance, leaving out any
+// retirement marker kept in service_instances by earlier versions.
+func (s *Store) RetrieveAllInstanceDetails() (map[string]brokerstore.ServiceInstance, error) {
+	logger := s.logger.Session("retrieve-all-instance-details")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	serviceInstances := map[string]brokerstore.ServiceInstance{}
+
+	rows, err := s.Database.Query("SELECT id, value FROM service_instances WHERE id <> ?", retirementMarker)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var serviceInstance brokerstore.ServiceInstance
+		var id string
+		var jsonValue []byte
+		err = rows.Scan(&id, &jsonValue)
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal(jsonValue, &serviceInstance)
+		if err != nil {
+			return nil, err
+		}
+		serviceInstances[id] = serviceInstance
+	}
+
+	return serviceInstances, rows.Err()
+}
+
+// InstanceDetailsPage lists up to limit instances with IDs after the given
+// one, in ID order, and returns the last ID listed.
+func (s *Store) InstanceDetailsPage(after string, limit int) (map[string]brokerstore.ServiceInstance, string, error) {
+	logger := s.logger.Session("instance-details-page")
+	logger.Debug("start", lager.Data{"after": after, "limit": limit})
+	defer logger.Debug("end")
+
+	serviceInstances := map[string]brokerstore.ServiceInstance{}
+	last := ""
+
+	rows, err := s.Database.Query("SELECT id, value FROM service_instances WHERE id > ? AND id <> ? ORDER BY id LIMIT ?", after, retirementMarker, limit)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var serviceInstance brokerstore.ServiceInstance
+		var jsonValue []byte
+		err = rows.Scan(&last, &jsonValue)
+		if err != nil {
+			return nil, "", err
+		}
+		err = json.Unmarshal(jsonValue, &serviceInstance)
+		if err != nil {
+			return nil, "", err
+		}
+		serviceInstances[last] = serviceInstance
+	}
+
+	return serviceInstances, last, rows.Err()
+}
+
+// BindingDetailsPage lists up to limit bindings with IDs after the given one,
+// in ID order, and returns the last ID listed.
+func (s *Store) BindingDetailsPage(after string, limit int) (map[string]brokerapi.BindDetails, string, error) {
+	logger := s.logger.Session("binding-details-page")
+	logger.Debug("start", lager.Data{"after": after, "limit": limit})
+	defer logger.Debug("end")
+
+	bindingDetails := map[string]brokerapi.BindDetails{}
+	last := ""
+
+	rows, err := s.Database.Query("SELECT id, value FROM service_bindings WHERE id > ? ORDER BY id LIMIT ?", after, limit)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var bindDetails brokerapi.BindDetails
+		var jsonValue []byte
+		err = rows.Scan(&last, &jsonValue)
+		if err != nil {
+			return nil, "", err
+		}
+		err = json.Unmarshal(jsonValue, &bindDetails)
+		if err != nil {
+			return nil, "", err
+		}
+		bindingDetails[last] = bindDetails
+	}
+
+	return bindingDetails, last, rows.Err()
+}
+
+// CountInstanceDetails counts the rows of service_instances, leaving out any
+// retirement marker kept there by earlier versions.
+func (s *Store) CountInstanceDetails() (int, error) {
+	var count int
+	err := s.Database.QueryRow("SELECT COUNT(*) FROM service_instances WHERE id <> ?", retirementMarker).Scan(&count)
+	return count, err
+}
+
+// CountBindingDetails counts the rows of service_bindings.
+func (s *Store) CountBindingDetails() (int, error) {
+	var count int
+	err := s.Database.QueryRow("SELECT COUNT(*) FROM service_bindings").Scan(&count)
+	return count, err
+}
+
+// CreateInstanceDetails replaces any existing row for id, as the rows copied
+// by a migration are left in place and are overwritten by a reverse one.
+func (s *Store) CreateInstanceDetails(id string, details brokerstore.ServiceInstance) error {
+	logger := s.logger.Session("create-instance-details")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	if id == retirementMarker {
+		return ErrReservedID
+	}
+
+	jsonData, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+	return s.replace(logger, "service_instances", id, jsonData)
+}
+
+// CreateBindingDetails replaces any existing row for id, as the rows copied
+// by a migration are left in place and are overwritten by a reverse one.
+// Parameters are hashed as brokerstore.SqlStore hashes them.
+func (s *Store) CreateBindingDetails(id string, details brokerapi.BindDetails) error {
+	logger := s.logger.Session("create-binding-details")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	details, err := redactBindingDetails(details)
+	if err != nil {
+		return err
+	}
+	jsonData, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+	return s.replace(logger, "service_bindings", id, jsonData)
+}
+
+// replace deletes any row for id from table and inserts value in one
+// transaction, so that a failed insert leaves the row it was to replace.
+// Statements of a transaction bypass the connection, so they are flavorified
+// here.
+func (s *Store) replace(logger lager.Logger, table, id string, value []byte) error {
+	tx, err := s.Database.Begin()
+	if err != nil {
+		logger.Error("failed-to-begin-transaction", err)
+		return err
+	}
+
+	_, err = tx.Exec(s.variant.Flavorify("DELETE FROM "+table+" WHERE id = ?"), id)
+	if err == nil {
+		_, err = tx.Exec(s.variant.Flavorify("INSERT INTO "+table+" (id, value) VALUES (?, ?)"), id, value)
+	}
+	if err != nil {
+		logger.Error("failed-to-replace-row", err, lager.Data{"table": table, "id": id})
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// redactBindingDetails replaces the parameters of a binding by their bcrypt
+// hash, unless they are a hash already.
+func redactBindingDetails(details brokerapi.BindDetails) (brokerapi.BindDetails, error) {
+	if len(details.RawParameters) == 0 {
+		return details, nil
+	}
+	var opts map[string]interface{}
+	err := json.Unmarshal(details.RawParameters, &opts)
+	if err != nil {
+		return details, err
+	}
+	if _, ok := opts[brokerstore.HashKey]; ok && len(opts) == 1 {
+		return details, nil
+	}
+
+	b, err := json.Marshal(opts)
+	if err != nil {
+		return brokerapi.BindDetails{}, err
+	}
+	hash, err := bcrypt.GenerateFromPassword(b, bcrypt.DefaultCost)
+	if err != nil {
+		return brokerapi.BindDetails{}, err
+	}
+	details.RawParameters, err = json.Marshal(map[string]interface{}{brokerstore.HashKey: string(hash)})
+	if err != nil {
+		return brokerapi.BindDetails{}, err
+	}
+	return details, nil
+}
+
+// IsInstanceConflict is the one of the StoreComparer, which compares
+// parameters hashed by another store, rather than the one of brokerstore.SqlStore.
+func (s *Store) IsInstanceConflict(id string, details brokerstore.ServiceInstance) bool {
+	return s.StoreComparer.IsInstanceConflict(id, details)
+}
+
+func (s *Store) IsBindingConflict(id string, details brokerapi.BindDetails) bool {
+	return s.StoreComparer.IsBindingConflict(id, details)
+}
+
+func (s *Store) InstanceLocation(id string) string {
+	return "service_instances/" + id
+}
+
+func (s *Store) BindingLocation(id string) string {
+	return "service_bindings/" + id
+}
+
+func (s *Store) MarkerLocation() string {
+	return stateTable + "/" + activationMarker
+}
+
+func (s *Store) RetirementMarkerLocation() string {
+	return stateTable + "/" + retirementMarker
+}
@@ -0,0 +1,543 @@
+package sqlstore_test
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf/brokerapi"
+
+	"code.cloudfoundry.org/goshims/sqlshim"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/migrate_mysql_to_credhub/migrator"
+	migratorfakes "code.cloudfoundry.org/migrate_mysql_to_credhub/migrator/fakes"
+	"code.cloudfoundry.org/migrate_mysql_to_credhub/sqlstore"
+	"code.cloudfoundry.org/service-broker-store/brokerstore"
+)
+
+var _ = Describe("Store", func() {
+	var (
+		db    *sql.DB
+		mock  sqlmock.Sqlmock
+		store *sqlstore.Store
+	)
+
+	BeforeEach(func() {
+		var err error
+		db, mock, err = sqlmock.New()
+		Expect(err).NotTo(HaveOccurred())
+
+		mock.ExpectExec("CREATE TABLE IF NOT EXISTS service_instances").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("CREATE TABLE IF NOT EXISTS service_bindings").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("CREATE TABLE IF NOT EXISTS migration_state").WillReturnResult(sqlmock.NewResult(0, 0))
+
+		store, err = sqlstore.NewStoreWithVariant(lagertest.NewTestLogger("sqlstore-test"), &mockVariant{db: db})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(mock.ExpectationsWereMet()).To(Succeed())
+		db.Close()
+	})
+
+	Describe("Retire", func() {
+		It("records the retirement marker in the migration state table", func() {
+			mock.ExpectExec(`INSERT INTO migration_state \(id, value\) VALUES \(\?, \?\)`).
+				WithArgs("migrated-to-credhub", "true").
+				WillReturnResult(sqlmock.NewResult(0, 1))
+
+			Expect(store.Retire()).To(Succeed())
+		})
+	})
+
+	Describe("IsRetired", func() {
+		It("reads the retirement marker from the migration state table", func() {
+			mock.ExpectQuery(`SELECT value FROM migration_state WHERE id = \?`).
+				WithArgs("migrated-to-credhub").
+				WillReturnRows(sqlmock.NewRows([]string{"value"}).AddRow("true"))
+
+			Expect(store.IsRetired()).To(BeTrue())
+		})
+
+		Context("when the marker was left in service_instances by an earlier version", func() {
+			It("is still retired", func() {
+				mock.ExpectQuery(`SELECT value FROM migration_state`).WillReturnError(sql.ErrNoRows)
+				mock.ExpectQuery(`SELECT id, value FROM service_instances WHERE id = \?`).
+					WithArgs("migrated-to-credhub").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "value"}).AddRow("migrated-to-credhub", "true"))
+
+				Expect(store.IsRetired()).To(BeTrue())
+			})
+		})
+
+		Context("when there is no marker", func() {
+			It("is not retired", func() {
+				mock.ExpectQuery(`SELECT value FROM migration_state`).WillReturnError(sql.ErrNoRows)
+				mock.ExpectQuery(`SELECT id, value FROM service_instances`).WillReturnError(sql.ErrNoRows)
+
+				Expect(store.IsRetired()).To(BeFalse())
+			})
+		})
+
+		Context("when reading the migration state fails", func() {
+			It("returns the error", func() {
+				mock.ExpectQuery(`SELECT value FROM migration_state`).WillReturnError(errors.New("select-failed"))
+
+				_, err := store.IsRetired()
+				Expect(err).To(MatchError("select-failed"))
+			})
+		})
+	})
+
+	Describe("Unretire", func() {
+		It("removes the retirement marker from both tables", func() {
+			mock.ExpectExec(`DELETE FROM migration_state WHERE id = \?`).
+				WithArgs("migrated-to-credhub").
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(`DELETE FROM service_instances WHERE id = \?`).
+				WithArgs("migrated-to-credhub").
+				WillReturnResult(sqlmock.NewResult(0, 0))
+
+			Expect(store.Unretire()).To(Succeed())
+		})
+
+		Context("when the delete fails", func() {
+			It("returns the error", func() {
+				mock.ExpectExec(`DELETE FROM migration_state`).WillReturnError(errors.New("delete-failed"))
+
+				Expect(store.Unretire()).To(MatchError("delete-failed"))
+			})
+		})
+	})
+
+	Describe("Activate", func() {
+		It("records the activation marker in the migration state table", func() {
+			mock.ExpectExec(`INSERT INTO migration_state \(id, value\) VALUES \(\?, \?\)`).
+				WithArgs("migrated-from-another-store", "true").
+				WillReturnResult(sqlmock.NewResult(0, 1))
+
+			Expect(store.Activate()).To(Succeed())
+		})
+	})
+
+	Describe("IsActivated", func() {
+		It("reads the activation marker from the migration state table", func() {
+			mock.ExpectQuery(`SELECT value FROM migration_state WHERE id = \?`).
+				WithArgs("migrated-from-another-store").
+				WillReturnRows(sqlmock.NewRows([]string{"value"}).AddRow("true"))
+
+			Expect(store.IsActivated()).To(BeTrue())
+		})
+
+		Context("when there is no marker", func() {
+			It("is not activated", func() {
+				mock.ExpectQuery(`SELECT value FROM migration_state`).WillReturnError(sql.ErrNoRows)
+
+				Expect(store.IsActivated()).To(BeFalse())
+			})
+		})
+
+		Context("when reading the migration state fails", func() {
+			It("returns the error", func() {
+				mock.ExpectQuery(`SELECT value FROM migration_state`).WillReturnError(errors.New("select-failed"))
+
+				_, err := store.IsActivated()
+				Expect(err).To(MatchError("select-failed"))
+			})
+		})
+	})
+
+	Describe("Deactivate", func() {
+		It("removes the activation marker", func() {
+			mock.ExpectExec(`DELETE FROM migration_state WHERE id = \?`).
+				WithArgs("migrated-from-another-store").
+				WillReturnResult(sqlmock.NewResult(0, 1))
+
+			Expect(store.Deactivate()).To(Succeed())
+		})
+	})
+
+	Describe("RetrieveAllInstanceDetails", func() {
+		It("leaves out the retirement marker", func() {
+			mock.ExpectQuery(`SELECT id, value FROM service_instances WHERE id <> \?`).
+				WithArgs("migrated-to-credhub").
+				WillReturnRows(sqlmock.NewRows([]string{"id", "value"}).AddRow("123", `{"service_id":"some-service"}`))
+
+			instances, err := store.RetrieveAllInstanceDetails()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(instances).To(Equal(map[string]brokerstore.ServiceInstance{
+				"123": brokerstore.ServiceInstance{ServiceID: "some-service"},
+			}))
+		})
+	})
+
+	Describe("InstanceDetailsPage", func() {
+		It("lists a page of instances after the given id", func() {
+			mock.ExpectQuery(`SELECT id, value FROM service_instances WHERE id > \? AND id <> \? ORDER BY id LIMIT \?`).
+				WithArgs("100", "migrated-to-credhub", 2).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "value"}).
+					AddRow("123", `{"service_id":"some-service-1"}`).
+					AddRow("456", `{"service_id":"some-service-2"}`))
+
+			instances, last, err := store.InstanceDetailsPage("100", 2)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(instances).To(Equal(map[string]brokerstore.ServiceInstance{
+				"123": brokerstore.ServiceInstance{ServiceID: "some-service-1"},
+				"456": brokerstore.ServiceInstance{ServiceID: "some-service-2"},
+			}))
+			Expect(last).To(Equal("456"))
+		})
+
+		Context("when the query fails", func() {
+			It("returns the error", func() {
+				mock.ExpectQuery(`SELECT id, value FROM service_instances`).WillReturnError(errors.New("select-failed"))
+
+				_, _, err := store.InstanceDetailsPage("", 2)
+				Expect(err).To(MatchError("select-failed"))
+			})
+		})
+	})
+
+	Describe("BindingDetailsPage", func() {
+		It("lists a page of bindings after the given id", func() {
+			mock.ExpectQuery(`SELECT id, value FROM service_bindings WHERE id > \? ORDER BY id LIMIT \?`).
+				WithArgs("", 2).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "value"}).AddRow("789", `{"app_guid":"some-app"}`))
+
+			bindings, last, err := store.BindingDetailsPage("", 2)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bindings).To(HaveLen(1))
+			Expect(bindings["789"].AppGUID).To(Equal("some-app"))
+			Expect(last).To(Equal("789"))
+		})
+	})
+
+	Describe("counting details", func() {
+		It("counts the instances other than the retirement marker", func() {
+			mock.ExpectQuery(`SELECT COUNT\(\*\) FROM service_instances WHERE id <> \?`).
+				WithArgs("migrated-to-credhub").
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+
+			Expect(store.CountInstanceDetails()).To(Equal(3))
+		})
+
+		It("counts the bindings", func() {
+			mock.ExpectQuery(`SELECT COUNT\(\*\) FROM service_bindings`).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(5))
+
+			Expect(store.CountBindingDetails()).To(Equal(5))
+		})
+
+		Context("when the query fails", func() {
+			It("returns the error", func() {
+				mock.ExpectQuery(`SELECT COUNT\(\*\) FROM service_bindings`).WillReturnError(errors.New("count-failed"))
+
+				_, err := store.CountBindingDetails()
+				Expect(err).To(MatchError("count-failed"))
+			})
+		})
+	})
+
+	Describe("CreateInstanceDetails", func() {
+		It("replaces any existing row in one transaction", func() {
+			mock.ExpectBegin()
+			mock.ExpectExec(`DELETE FROM service_instances WHERE id = \?`).
+				WithArgs("123").
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(`INSERT INTO service_instances \(id, value\) VALUES \(\?, \?\)`).
+				WithArgs("123", sqlmock.AnyArg()).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			Expect(store.CreateInstanceDetails("123", brokerstore.ServiceInstance{ServiceID: "some-service"})).To(Succeed())
+		})
+
+		Context("when the delete fails", func() {
+			It("does not insert the row", func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(`DELETE FROM service_instances`).WillReturnError(errors.New("delete-failed"))
+				mock.ExpectRollback()
+
+				Expect(store.CreateInstanceDetails("123", brokerstore.ServiceInstance{})).To(MatchError("delete-failed"))
+			})
+		})
+
+		Context("when the insert fails", func() {
+			It("rolls back the delete", func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(`DELETE FROM service_instances`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`INSERT INTO service_instances`).WillReturnError(errors.New("insert-failed"))
+				mock.ExpectRollback()
+
+				Expect(store.CreateInstanceDetails("123", brokerstore.ServiceInstance{})).To(MatchError("insert-failed"))
+			})
+		})
+
+		Context("when the transaction cannot begin", func() {
+			It("returns the error", func() {
+				mock.ExpectBegin().WillReturnError(errors.New("begin-failed"))
+
+				Expect(store.CreateInstanceDetails("123", brokerstore.ServiceInstance{})).To(MatchError("begin-failed"))
+			})
+		})
+
+		Context("when the id is the retirement marker", func() {
+			It("refuses to store it", func() {
+				Expect(store.CreateInstanceDetails("migrated-to-credhub", brokerstore.ServiceInstance{})).To(Equal(sqlstore.ErrReservedID))
+			})
+		})
+	})
+
+	Describe("CreateBindingDetails", func() {
+		It("replaces any existing row in one transaction", func() {
+			mock.ExpectBegin()
+			mock.ExpectExec(`DELETE FROM service_bindings WHERE id = \?`).
+				WithArgs("456").
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(`INSERT INTO service_bindings \(id, value\) VALUES \(\?, \?\)`).
+				WithArgs("456", sqlmock.AnyArg()).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			Expect(store.CreateBindingDetails("456", brokerapi.BindDetails{AppGUID: "some-app"})).To(Succeed())
+		})
+
+		Context("when the insert fails", func() {
+			It("rolls back the delete", func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(`DELETE FROM service_bindings`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`INSERT INTO service_bindings`).WillReturnError(errors.New("insert-failed"))
+				mock.ExpectRollback()
+
+				Expect(store.CreateBindingDetails("456", brokerapi.BindDetails{AppGUID: "some-app"})).To(MatchError("insert-failed"))
+			})
+		})
+
+		It("keeps parameters that are already a hash", func() {
+			written := &capturedValue{}
+			mock.ExpectBegin()
+			mock.ExpectExec(`DELETE FROM service_bindings`).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(`INSERT INTO service_bindings`).
+				WithArgs("456", written).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			Expect(store.CreateBindingDetails("456", brokerapi.BindDetails{AppGUID: "some-app", RawParameters: []byte(`{"paramsHash":"some-hash"}`)})).To(Succeed())
+			Expect(written.value).To(ContainSubstring(`"parameters":{"paramsHash":"some-hash"}`))
+		})
+	})
+
+	Describe("verifying a binding written with unhashed parameters", func() {
+		It("matches the hash it reads back with the parameters", func() {
+			details := brokerapi.BindDetails{AppGUID: "some-app", RawParameters: []byte(`{"mount":"/data"}`)}
+			written := &capturedValue{}
+			mock.ExpectBegin()
+			mock.ExpectExec(`DELETE FROM service_bindings WHERE id = \?`).
+				WithArgs("456").
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(`INSERT INTO service_bindings \(id, value\) VALUES \(\?, \?\)`).
+				WithArgs("456", written).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+			Expect(store.CreateBindingDetails("456", details)).To(Succeed())
+			Expect(written.value).To(ContainSubstring("paramsHash"))
+
+			mock.ExpectQuery(`SELECT id, value FROM service_bindings WHERE id = \?`).
+				WithArgs("456").
+				WillReturnRows(sqlmock.NewRows([]string{"id", "value"}).AddRow("456", written.value))
+			mock.ExpectQuery(`SELECT id, value FROM service_instances WHERE id <> \?`).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "value"}))
+			mock.ExpectQuery(`SELECT id, value FROM service_bindings`).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "value"}).AddRow("456", written.value))
+
+			fromStore := &migratorfakes.FakeRetirableStore{}
+			fromStore.RetrieveAllInstanceDetailsReturns(map[string]brokerstore.ServiceInstance{}, nil)
+			fromStore.RetrieveAllBindingDetailsReturns(map[string]brokerapi.BindDetails{"456": details}, nil)
+			Expect(migrator.NewMigrator(lagertest.NewTestLogger("sqlstore-test")).Verify(fromStore, store)).To(Succeed())
+		})
+	})
+
+	Describe("IsBindingConflict", func() {
+		var hashed []byte
+
+		BeforeEach(func() {
+			hashed = []byte(`{"paramsHash":"some-hash"}`)
+			value := `{"app_guid":"some-app","parameters":{"paramsHash":"some-hash"}}`
+			mock.ExpectQuery(`SELECT id, value FROM service_bindings WHERE id = \?`).
+				WithArgs("456").
+				WillReturnRows(sqlmock.NewRows([]string{"id", "value"}).AddRow("456", value))
+		})
+
+		It("does not report details with the same hashed parameters", func() {
+			Expect(store.IsBindingConflict("456", brokerapi.BindDetails{AppGUID: "some-app", RawParameters: hashed})).To(BeFalse())
+		})
+
+		It("does not report the same parameters laid out differently", func() {
+			Expect(store.IsBindingConflict("456", brokerapi.BindDetails{AppGUID: "some-app", RawParameters: []byte(`{ "paramsHash": "some-hash" }`)})).To(BeFalse())
+		})
+
+		It("reports details that differ otherwise", func() {
+			Expect(store.IsBindingConflict("456", brokerapi.BindDetails{AppGUID: "other-app", RawParameters: hashed})).To(BeTrue())
+		})
+	})
+
+	Describe("CompareBindingDetails", func() {
+		It("reports a binding that is not in the table as absent", func() {
+			mock.ExpectQuery(`SELECT id, value FROM service_bindings WHERE id = \?`).
+				WithArgs("456").
+				WillReturnRows(sqlmock.NewRows([]string{"id", "value"}))
+
+			Expect(store.CompareBindingDetails("456", brokerapi.BindDetails{AppGUID: "some-app"})).To(Equal(migrator.Absent))
+		})
+
+		It("returns the error when the table cannot be read", func() {
+			mock.ExpectQuery(`SELECT id, value FROM service_bindings WHERE id = \?`).
+				WithArgs("456").
+				WillReturnError(errors.New("connection-lost"))
+
+			_, err := store.CompareBindingDetails("456", brokerapi.BindDetails{AppGUID: "some-app"})
+			Expect(err).To(MatchError("connection-lost"))
+		})
+	})
+
+	It("locates details by table and id", func() {
+		Expect(store.InstanceLocation("123")).To(Equal("service_instances/123"))
+		Expect(store.BindingLocation("456")).To(Equal("service_bindings/456"))
+		Expect(store.MarkerLocation()).To(Equal("migration_state/migrated-from-another-store"))
+		Expect(store.RetirementMarkerLocation()).To(Equal("migration_state/migrated-to-credhub"))
+	})
+
+	It("describes itself without connection details when given a variant", func() {
+		Expect(store.String()).To(Equal("sql"))
+	})
+})
+
+var _ = Describe("Store on Postgres", func() {
+	var (
+		db    *sql.DB
+		mock  sqlmock.Sqlmock
+		store *sqlstore.Store
+	)
+
+	BeforeEach(func() {
+		var err error
+		db, mock, err = sqlmock.New()
+		Expect(err).NotTo(HaveOccurred())
+
+		mock.ExpectExec("CREATE TABLE IF NOT EXISTS service_instances").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("CREATE TABLE IF NOT EXISTS service_bindings").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("CREATE TABLE IF NOT EXISTS migration_state").WillReturnResult(sqlmock.NewResult(0, 0))
+
+		variant := &postgresMockVariant{
+			SqlVariant: brokerstore.NewPostgresVariant("some-username", "some-password", "some-host", "5432", "some-db", ""),
+			db:         db,
+		}
+		store, err = sqlstore.NewStoreWithVariant(lagertest.NewTestLogger("sqlstore-test"), variant)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(mock.ExpectationsWereMet()).To(Succeed())
+		db.Close()
+	})
+
+	It("records the retirement marker with numbered placeholders", func() {
+		mock.ExpectExec(`INSERT INTO migration_state \(id, value\) VALUES \(\$1, \$2\)`).
+			WithArgs("migrated-to-credhub", "true").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		Expect(store.Retire()).To(Succeed())
+	})
+
+	It("reads the retirement marker with numbered placeholders", func() {
+		mock.ExpectQuery(`SELECT value FROM migration_state WHERE id = \$1`).
+			WithArgs("migrated-to-credhub").
+			WillReturnRows(sqlmock.NewRows([]string{"value"}).AddRow("true"))
+
+		Expect(store.IsRetired()).To(BeTrue())
+	})
+
+	It("lists a page of instances with numbered placeholders", func() {
+		mock.ExpectQuery(`SELECT id, value FROM service_instances WHERE id > \$1 AND id <> \$2 ORDER BY id LIMIT \$3`).
+			WithArgs("", "migrated-to-credhub", 2).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "value"}).AddRow("123", `{"service_id":"some-service"}`))
+
+		instances, last, err := store.InstanceDetailsPage("", 2)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(instances).To(HaveLen(1))
+		Expect(last).To(Equal("123"))
+	})
+
+	It("counts the instances with numbered placeholders", func() {
+		mock.ExpectQuery(`SELECT COUNT\(\*\) FROM service_instances WHERE id <> \$1`).
+			WithArgs("migrated-to-credhub").
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(int64(3)))
+
+		Expect(store.CountInstanceDetails()).To(Equal(3))
+	})
+
+	It("replaces existing rows with numbered placeholders", func() {
+		mock.ExpectBegin()
+		mock.ExpectExec(`DELETE FROM service_bindings WHERE id = \$1`).
+			WithArgs("456").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`INSERT INTO service_bindings \(id, value\) VALUES \(\$1, \$2\)`).
+			WithArgs("456", sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		Expect(store.CreateBindingDetails("456", brokerapi.BindDetails{AppGUID: "some-app"})).To(Succeed())
+	})
+})
+
+// capturedValue matches any argument and keeps it.
+type capturedValue struct {
+	value string
+}
+
+func (c *capturedValue) Match(v driver.Value) bool {
+	switch value := v.(type) {
+	case string:
+		c.value = value
+	case []byte:
+		c.value = string(value)
+	default:
+		return false
+	}
+	return true
+}
+
+type mockVariant struct {
+	db *sql.DB
+}
+
+func (v *mockVariant) Connect(logger lager.Logger) (sqlshim.SqlDB, error) {
+	return v.db, nil
+}
+
+func (v *mockVariant) Flavorify(query string) string {
+	return query
+}
+
+func (v *mockVariant) Close() error {
+	return nil
+}
+
+// postgresMockVariant rewrites queries as the Postgres variant does, but
+// connects to a mock database.
+type postgresMockVariant struct {
+	brokerstore.SqlVariant
+	db *sql.DB
+}
+
+func (v *postgresMockVariant) Connect(logger lager.Logger) (sqlshim.SqlDB, error) {
+	return v.db, nil
+}
+
+func (v *postgresMockVariant) Close() error {
+	return nil
+}
@@ -0,0 +1,186 @@
+package storetest
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf/brokerapi"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/migrate_mysql_to_credhub/migrator"
+	"code.cloudfoundry.org/migrate_mysql_to_credhub/migrator/fakes"
+	"code.cloudfoundry.org/service-broker-store/brokerstore"
+)
+
+// Store can be either side of a migration and compares the details it holds.
+type Store interface {
+	migrator.MarkedStore
+	migrator.Comparer
+}
+
+// ItBehavesLikeAStore adds the specs that every store is held to, run
+// against the empty store that store returns after the BeforeEach blocks
+// around them. Specs that depend on how a store keeps details belong with
+// the store.
+func ItBehavesLikeAStore(store func() Store) {
+	var s Store
+
+	BeforeEach(func() {
+		s = store()
+	})
+
+	Context("when the store holds instances and bindings", func() {
+		BeforeEach(func() {
+			Expect(s.CreateInstanceDetails("instance-1", brokerstore.ServiceInstance{ServiceID: "some-service", OrganizationGUID: "some-org"})).To(Succeed())
+			Expect(s.CreateInstanceDetails("instance-2", brokerstore.ServiceInstance{ServiceID: "some-service", ServiceFingerPrint: map[string]interface{}{"share": "some-share"}})).To(Succeed())
+			Expect(s.CreateBindingDetails("binding-1", brokerapi.BindDetails{AppGUID: "some-app", RawParameters: []byte(`{"paramsHash":"some-hash"}`)})).To(Succeed())
+		})
+
+		It("reads back an instance and a binding", func() {
+			serviceInstance, err := s.RetrieveInstanceDetails("instance-1")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(serviceInstance).To(Equal(brokerstore.ServiceInstance{ServiceID: "some-service", OrganizationGUID: "some-org"}))
+
+			bindDetails, err := s.RetrieveBindingDetails("binding-1")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bindDetails.AppGUID).To(Equal("some-app"))
+			Expect(bindDetails.RawParameters).To(MatchJSON(`{"paramsHash":"some-hash"}`))
+		})
+
+		It("replaces the details of an existing ID", func() {
+			Expect(s.CreateInstanceDetails("instance-1", brokerstore.ServiceInstance{ServiceID: "other-service"})).To(Succeed())
+
+			serviceInstance, err := s.RetrieveInstanceDetails("instance-1")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(serviceInstance).To(Equal(brokerstore.ServiceInstance{ServiceID: "other-service"}))
+		})
+
+		It("lists every instance and binding by ID, but not the markers", func() {
+			Expect(s.Activate()).To(Succeed())
+			Expect(s.Retire()).To(Succeed())
+
+			instances, err := s.RetrieveAllInstanceDetails()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(instances).To(Equal(map[string]brokerstore.ServiceInstance{
+				"instance-1": brokerstore.ServiceInstance{ServiceID: "some-service", OrganizationGUID: "some-org"},
+				"instance-2": brokerstore.ServiceInstance{ServiceID: "some-service", ServiceFingerPrint: map[string]interface{}{"share": "some-share"}},
+			}))
+
+			bindings, err := s.RetrieveAllBindingDetails()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bindings).To(HaveLen(1))
+			Expect(bindings).To(HaveKey("binding-1"))
+		})
+
+		It("deletes a detail", func() {
+			Expect(s.DeleteInstanceDetails("instance-1")).To(Succeed())
+			_, err := s.RetrieveInstanceDetails("instance-1")
+			Expect(err).To(Equal(brokerapi.ErrInstanceDoesNotExist))
+
+			Expect(s.DeleteBindingDetails("binding-1")).To(Succeed())
+			_, err = s.RetrieveBindingDetails("binding-1")
+			Expect(err).To(Equal(brokerapi.ErrBindingDoesNotExist))
+		})
+
+		It("reports conflicting details", func() {
+			Expect(s.IsInstanceConflict("instance-1", brokerstore.ServiceInstance{ServiceID: "some-service", OrganizationGUID: "some-org"})).To(BeFalse())
+			Expect(s.IsInstanceConflict("instance-1", brokerstore.ServiceInstance{ServiceID: "other-service"})).To(BeTrue())
+			Expect(s.IsBindingConflict("binding-1", brokerapi.BindDetails{AppGUID: "some-app", RawParameters: []byte(`{"paramsHash":"some-hash"}`)})).To(BeFalse())
+			Expect(s.IsBindingConflict("binding-1", brokerapi.BindDetails{AppGUID: "other-app", RawParameters: []byte(`{"paramsHash":"some-hash"}`)})).To(BeTrue())
+			Expect(s.IsBindingConflict("binding-3", brokerapi.BindDetails{AppGUID: "other-app"})).To(BeFalse())
+		})
+
+		It("tells identical details apart from absent ones", func() {
+			Expect(s.CompareInstanceDetails("instance-1", brokerstore.ServiceInstance{ServiceID: "some-service", OrganizationGUID: "some-org"})).To(Equal(migrator.Identical))
+			Expect(s.CompareInstanceDetails("instance-3", brokerstore.ServiceInstance{ServiceID: "some-service"})).To(Equal(migrator.Absent))
+			Expect(s.CompareBindingDetails("binding-1", brokerapi.BindDetails{AppGUID: "some-app", RawParameters: []byte(`{ "paramsHash": "some-hash" }`)})).To(Equal(migrator.Identical))
+			Expect(s.CompareBindingDetails("binding-3", brokerapi.BindDetails{AppGUID: "some-app"})).To(Equal(migrator.Absent))
+		})
+	})
+
+	Context("when a detail does not exist", func() {
+		It("returns the error of brokerapi", func() {
+			_, err := s.RetrieveInstanceDetails("missing")
+			Expect(err).To(Equal(brokerapi.ErrInstanceDoesNotExist))
+			_, err = s.RetrieveBindingDetails("missing")
+			Expect(err).To(Equal(brokerapi.ErrBindingDoesNotExist))
+		})
+
+		It("deletes nothing", func() {
+			Expect(s.DeleteInstanceDetails("missing")).To(Succeed())
+			Expect(s.DeleteBindingDetails("missing")).To(Succeed())
+		})
+	})
+
+	Context("when the store is empty", func() {
+		It("lists nothing", func() {
+			instances, err := s.RetrieveAllInstanceDetails()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(instances).To(BeEmpty())
+
+			bindings, err := s.RetrieveAllBindingDetails()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bindings).To(BeEmpty())
+		})
+	})
+
+	Describe("markers", func() {
+		It("sets and removes the activation marker", func() {
+			Expect(s.IsActivated()).To(BeFalse())
+
+			Expect(s.Activate()).To(Succeed())
+			Expect(s.IsActivated()).To(BeTrue())
+			Expect(s.IsRetired()).To(BeFalse())
+
+			Expect(s.Deactivate()).To(Succeed())
+			Expect(s.IsActivated()).To(BeFalse())
+			Expect(s.Deactivate()).To(Succeed())
+		})
+
+		It("sets and removes the retirement marker", func() {
+			Expect(s.IsRetired()).To(BeFalse())
+
+			Expect(s.Retire()).To(Succeed())
+			Expect(s.IsRetired()).To(BeTrue())
+			Expect(s.IsActivated()).To(BeFalse())
+
+			Expect(s.Unretire()).To(Succeed())
+			Expect(s.IsRetired()).To(BeFalse())
+		})
+
+		It("removes one marker and leaves the other", func() {
+			Expect(s.Activate()).To(Succeed())
+			Expect(s.Retire()).To(Succeed())
+
+			Expect(s.Deactivate()).To(Succeed())
+			Expect(s.IsActivated()).To(BeFalse())
+			Expect(s.IsRetired()).To(BeTrue())
+		})
+	})
+
+	Context("when it is the target of a migration", func() {
+		var (
+			fromStore *fakes.FakeRetirableStore
+			instances map[string]brokerstore.ServiceInstance
+		)
+
+		BeforeEach(func() {
+			instances = map[string]brokerstore.ServiceInstance{
+				"123": brokerstore.ServiceInstance{ServiceID: "some-service", OrganizationGUID: "some-org"},
+			}
+			fromStore = &fakes.FakeRetirableStore{}
+			fromStore.RetrieveAllInstanceDetailsReturns(instances, nil)
+			fromStore.RetrieveAllBindingDetailsReturns(map[string]brokerapi.BindDetails{
+				"456": brokerapi.BindDetails{AppGUID: "some-app", RawParameters: []byte(`{"paramsHash":"some-hash"}`)},
+			}, nil)
+		})
+
+		It("copies, verifies and activates", func() {
+			_, err := migrator.NewMigrator(lagertest.NewTestLogger("migrator-test")).Migrate(fromStore, s)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(s.RetrieveAllInstanceDetails()).To(Equal(instances))
+			Expect(s.IsActivated()).To(BeTrue())
+			Expect(fromStore.RetireCallCount()).To(Equal(1))
+		})
+	})
+}
@@ -0,0 +1,218 @@
+package vaultstore
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when there is no secret at a path.
+var ErrNotFound = errors.New("no secret at the path")
+
+// Auth is how a Client logs in to Vault: with Token, or else with the
+// RoleID and SecretID of an AppRole mounted at AppRoleMount.
+type Auth struct {
+	Token        string
+	RoleID       string
+	SecretID     string
+	AppRoleMount string
+}
+
+// Error is returned when Vault answers with a status other than success.
+type Error struct {
+	StatusCode int      `json:"-"`
+	Errors     []string `json:"errors"`
+}
+
+func (e *Error) Error() string {
+	if len(e.Errors) == 0 {
+		return fmt.Sprintf("vault returned status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("vault returned status %d: %s", e.StatusCode, strings.Join(e.Errors, ", "))
+}
+
+// Client reads and writes the secrets of a KV version 2 secrets engine
+// through the Vault HTTP API.
+type Client struct {
+	address    string
+	mount      string
+	token      string
+	httpClient *http.Client
+}
+
+// NewClient logs in to the Vault at address, trusting caCert as well as the
+// system roots when it is given, and returns a client of the KV version 2
+// secrets engine mounted at mount.
+func NewClient(address, caCert, mount string, auth Auth) (*Client, error) {
+	httpClient := &http.Client{Timeout: 30 * time.Second}
+	if caCert != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM([]byte(caCert)) {
+			return nil, errors.New("cannot parse the Vault CA certificate")
+		}
+		httpClient.Transport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}
+	}
+
+	c := &Client{
+		address:    strings.TrimSuffix(address, "/"),
+		mount:      strings.Trim(mount, "/"),
+		token:      auth.Token,
+		httpClient: httpClient,
+	}
+	if c.token != "" {
+		return c, nil
+	}
+	if auth.RoleID == "" || auth.SecretID == "" {
+		return nil, errors.New("a Vault token, or an AppRole role ID and secret ID, must be given")
+	}
+
+	appRoleMount := auth.AppRoleMount
+	if appRoleMount == "" {
+		appRoleMount = "approle"
+	}
+	var login struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+	err := c.do("POST", "auth/"+strings.Trim(appRoleMount, "/")+"/login", map[string]string{
+		"role_id":   auth.RoleID,
+		"secret_id": auth.SecretID,
+	}, &login)
+	if err != nil {
+		return nil, err
+	}
+	if login.Auth.ClientToken == "" {
+		return nil, errors.New("vault returned no token for the AppRole")
+	}
+	c.token = login.Auth.ClientToken
+	return c, nil
+}
+
+// Address is the address of the Vault server.
+func (c *Client) Address() string {
+	return c.address
+}
+
+// Mount is the path the secrets engine is mounted at.
+func (c *Client) Mount() string {
+	return c.mount
+}
+
+// Read unmarshals the latest version of the secret at path into data. It
+// returns ErrNotFound when there is no secret, or when its latest version was
+// deleted.
+func (c *Client) Read(path string, data interface{}) error {
+	var secret struct {
+		Data struct {
+			Data json.RawMessage `json:"data"`
+		} `json:"data"`
+	}
+	err := c.do("GET", c.mount+"/data/"+path, nil, &secret)
+	if err != nil {
+		return err
+	}
+	if len(secret.Data.Data) == 0 || string(secret.Data.Data) == "null" {
+		return ErrNotFound
+	}
+	return json.Unmarshal(secret.Data.Data, data)
+}
+
+// Write stores data, which must marshal to a JSON object, as a new version of
+// the secret at path.
+func (c *Client) Write(path string, data interface{}) error {
+	return c.do("POST", c.mount+"/data/"+path, map[string]interface{}{"data": data}, nil)
+}
+
+// List names the secrets and folders directly under path, with a trailing
+// slash on folders. It returns nothing when there is nothing under path.
+func (c *Client) List(path string) ([]string, error) {
+	var list struct {
+		Data struct {
+			Keys []string `json:"keys"`
+		} `json:"data"`
+	}
+	err := c.do("LIST", c.mount+"/metadata/"+path, nil, &list)
+	if err == ErrNotFound {
+		return nil, nil
+	}
+	return list.Data.Keys, err
+}
+
+// Delete removes every version of the secret at path.
+func (c *Client) Delete(path string) error {
+	err := c.do("DELETE", c.mount+"/metadata/"+path, nil, nil)
+	if err == ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+func (c *Client) do(method, path string, body interface{}, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(b)
+	}
+
+	request, err := http.NewRequest(method, c.address+"/v1/"+escapePath(path), reader)
+	if err != nil {
+		return err
+	}
+	if c.token != "" {
+		request.Header.Set("X-Vault-Token", c.token)
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	b, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+
+	if response.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		vaultErr := &Error{StatusCode: response.StatusCode}
+		json.Unmarshal(b, vaultErr)
+		return vaultErr
+	}
+
+	if result == nil || len(b) == 0 {
+		return nil
+	}
+	return json.Unmarshal(b, result)
+}
+
+// escapePath escapes each segment of a path, so that the escapes in the names
+// of secrets reach Vault as they are.
+func escapePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
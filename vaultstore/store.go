@@ -0,0 +1,225 @@
+package vaultstore
+
+import (
+	"net/url"
+	"path"
+	"strings"
+
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/migrate_mysql_to_credhub/migrator"
+	"code.cloudfoundry.org/service-broker-store/brokerstore"
+	"github.com/pivotal-cf/brokerapi"
+)
+
+const (
+	activationMarker = "migrated-from-another-store"
+	retirementMarker = "migrated-to-another-store"
+)
+
+// Store keeps broker details in the KV version 2 secrets engine of Vault, at
+// <prefix>/<storeID>/instances/<id> and <prefix>/<storeID>/bindings/<id>,
+// with each ID escaped by secretName, and with its activation and retirement markers as secrets beside them.
+type Store struct {
+	migrator.StoreComparer
+	migrator.WriteThrough
+	logger lager.Logger
+	client *Client
+	base   string
+}
+
+func NewStore(logger lager.Logger, client *Client, pathPrefix, storeID string) *Store {
+	s := &Store{
+		logger: logger,
+		client: client,
+		base:   strings.Trim(path.Join(pathPrefix, storeID), "/"),
+	}
+	s.StoreComparer = migrator.NewStoreComparer(s.RetrieveInstanceDetails, s.RetrieveBindingDetails)
+	return s
+}
+
+func (s *Store) String() string {
+	return "vault:" + s.client.Address() + "/" + s.client.Mount() + "/" + s.base
+}
+
+func (s *Store) Activate() error {
+	s.logger.Info("activating-vault")
+	return s.client.Write(s.path(activationMarker), marker{Value: "true"})
+}
+
+func (s *Store) IsActivated() (bool, error) {
+	return s.isMarked(activationMarker)
+}
+
+func (s *Store) Deactivate() error {
+	s.logger.Info("deactivating-vault")
+	return s.client.Delete(s.path(activationMarker))
+}
+
+func (s *Store) Retire() error {
+	s.logger.Info("retiring-vault")
+	return s.client.Write(s.path(retirementMarker), marker{Value: "true"})
+}
+
+func (s *Store) IsRetired() (bool, error) {
+	return s.isMarked(retirementMarker)
+}
+
+func (s *Store) Unretire() error {
+	s.logger.Info("unretiring-vault")
+	return s.client.Delete(s.path(retirementMarker))
+}
+
+func (s *Store) CreateInstanceDetails(id string, details brokerstore.ServiceInstance) error {
+	logger := s.logger.Session("create-instance-details")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	return s.client.Write(s.path("instances", secretName(id)), details)
+}
+
+func (s *Store) CreateBindingDetails(id string, details brokerapi.BindDetails) error {
+	logger := s.logger.Session("create-binding-details")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	return s.client.Write(s.path("bindings", secretName(id)), details)
+}
+
+func (s *Store) RetrieveInstanceDetails(id string) (brokerstore.ServiceInstance, error) {
+	var serviceInstance brokerstore.ServiceInstance
+	err := s.client.Read(s.path("instances", secretName(id)), &serviceInstance)
+	if err == ErrNotFound {
+		return brokerstore.ServiceInstance{}, brokerapi.ErrInstanceDoesNotExist
+	}
+	if err != nil {
+		return brokerstore.ServiceInstance{}, err
+	}
+	return serviceInstance, nil
+}
+
+func (s *Store) RetrieveBindingDetails(id string) (brokerapi.BindDetails, error) {
+	var bindDetails brokerapi.BindDetails
+	err := s.client.Read(s.path("bindings", secretName(id)), &bindDetails)
+	if err == ErrNotFound {
+		return brokerapi.BindDetails{}, brokerapi.ErrBindingDoesNotExist
+	}
+	if err != nil {
+		return brokerapi.BindDetails{}, err
+	}
+	return bindDetails, nil
+}
+
+func (s *Store) RetrieveAllInstanceDetails() (map[string]brokerstore.ServiceInstance, error) {
+	logger := s.logger.Session("retrieve-all-instance-details")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	serviceInstances := map[string]brokerstore.ServiceInstance{}
+	err := s.retrieveUnder(logger, "instances", func(id string) error {
+		serviceInstance, err := s.RetrieveInstanceDetails(id)
+		serviceInstances[id] = serviceInstance
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return serviceInstances, nil
+}
+
+func (s *Store) RetrieveAllBindingDetails() (map[string]brokerapi.BindDetails, error) {
+	logger := s.logger.Session("retrieve-all-binding-details")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	bindingDetails := map[string]brokerapi.BindDetails{}
+	err := s.retrieveUnder(logger, "bindings", func(id string) error {
+		bindDetails, err := s.RetrieveBindingDetails(id)
+		bindingDetails[id] = bindDetails
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return bindingDetails, nil
+}
+
+func (s *Store) DeleteInstanceDetails(id string) error {
+	return s.client.Delete(s.path("instances", secretName(id)))
+}
+
+func (s *Store) DeleteBindingDetails(id string) error {
+	return s.client.Delete(s.path("bindings", secretName(id)))
+}
+
+func (s *Store) InstanceLocation(id string) string {
+	return s.client.Mount() + "/" + s.path("instances", secretName(id))
+}
+
+func (s *Store) BindingLocation(id string) string {
+	return s.client.Mount() + "/" + s.path("bindings", secretName(id))
+}
+
+func (s *Store) MarkerLocation() string {
+	return s.client.Mount() + "/" + s.path(activationMarker)
+}
+
+func (s *Store) RetirementMarkerLocation() string {
+	return s.client.Mount() + "/" + s.path(retirementMarker)
+}
+
+// marker is the secret kept at the location of a marker.
+type marker struct {
+	Value string `json:"value"`
+}
+
+func (s *Store) isMarked(name string) (bool, error) {
+	var m marker
+	err := s.client.Read(s.path(name), &m)
+	if err == ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// retrieveUnder calls found with the ID of every secret directly under the
+// given folder of the store, leaving out any folders below it.
+func (s *Store) retrieveUnder(logger lager.Logger, folder string, found func(id string) error) error {
+	keys, err := s.client.List(s.path(folder))
+	if err != nil {
+		logger.Error("failed-to-list-secrets", err, lager.Data{"path": s.path(folder)})
+		return err
+	}
+
+	for _, key := range keys {
+		if strings.HasSuffix(key, "/") {
+			continue
+		}
+		id, err := url.PathUnescape(key)
+		if err != nil {
+			continue
+		}
+		err = found(id)
+		if err != nil {
+			logger.Error("failed-to-read-secret", err, lager.Data{"path": s.path(folder, key)})
+			return err
+		}
+	}
+	return nil
+}
+
+// secretName path escapes an ID, and escapes a leading dot as well, so that
+// an ID never names a folder, or a secret outside the folder of its kind.
+func secretName(id string) string {
+	name := url.PathEscape(id)
+	if strings.HasPrefix(name, ".") {
+		name = "%2E" + name[1:]
+	}
+	return name
+}
+
+func (s *Store) path(elements ...string) string {
+	if s.base == "" {
+		return strings.Join(elements, "/")
+	}
+	return s.base + "/" + strings.Join(elements, "/")
+}
@@ -0,0 +1,269 @@
+package vaultstore_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf/brokerapi"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/migrate_mysql_to_credhub/storetest"
+	"code.cloudfoundry.org/migrate_mysql_to_credhub/vaultstore"
+	"code.cloudfoundry.org/service-broker-store/brokerstore"
+)
+
+var _ = Describe("Store", func() {
+	var (
+		vault  *fakeVault
+		server *httptest.Server
+		client *vaultstore.Client
+		store  *vaultstore.Store
+	)
+
+	BeforeEach(func() {
+		vault = newFakeVault("some-token")
+		server = httptest.NewServer(vault)
+
+		var err error
+		client, err = vaultstore.NewClient(server.URL, "", "secret", vaultstore.Auth{Token: "some-token"})
+		Expect(err).NotTo(HaveOccurred())
+		store = vaultstore.NewStore(lagertest.NewTestLogger("vaultstore-test"), client, "some-prefix", "some-store-id")
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("describes itself by server, mount and path", func() {
+		Expect(store.String()).To(Equal("vault:" + server.URL + "/secret/some-prefix/some-store-id"))
+	})
+
+	It("locates details and markers by mount and path", func() {
+		Expect(store.InstanceLocation("123")).To(Equal("secret/some-prefix/some-store-id/instances/123"))
+		Expect(store.BindingLocation("456")).To(Equal("secret/some-prefix/some-store-id/bindings/456"))
+		Expect(store.MarkerLocation()).To(Equal("secret/some-prefix/some-store-id/migrated-from-another-store"))
+		Expect(store.RetirementMarkerLocation()).To(Equal("secret/some-prefix/some-store-id/migrated-to-another-store"))
+	})
+
+	It("escapes IDs that are not plain secret names", func() {
+		Expect(store.InstanceLocation("../123?a#b")).To(Equal("secret/some-prefix/some-store-id/instances/%2E.%2F123%3Fa%23b"))
+	})
+
+	Context("when an ID is not a plain secret name", func() {
+		BeforeEach(func() {
+			Expect(store.CreateInstanceDetails("../123?a#b", brokerstore.ServiceInstance{ServiceID: "some-service"})).To(Succeed())
+		})
+
+		It("keeps the detail in one secret in the folder of its kind", func() {
+			Expect(vault.secrets).To(HaveLen(1))
+			Expect(vault.secrets).To(HaveKey("some-prefix/some-store-id/instances/%2E.%2F123%3Fa%23b"))
+		})
+
+		It("reads and lists the detail by its ID", func() {
+			Expect(store.RetrieveInstanceDetails("../123?a#b")).To(Equal(brokerstore.ServiceInstance{ServiceID: "some-service"}))
+			Expect(store.RetrieveAllInstanceDetails()).To(Equal(map[string]brokerstore.ServiceInstance{
+				"../123?a#b": brokerstore.ServiceInstance{ServiceID: "some-service"},
+			}))
+		})
+	})
+
+	storetest.ItBehavesLikeAStore(func() storetest.Store { return store })
+
+	Context("when the store holds instances and bindings", func() {
+		BeforeEach(func() {
+			Expect(store.CreateInstanceDetails("instance-1", brokerstore.ServiceInstance{ServiceID: "some-service", OrganizationGUID: "some-org"})).To(Succeed())
+			Expect(store.CreateBindingDetails("binding-1", brokerapi.BindDetails{AppGUID: "some-app", RawParameters: []byte(`{"paramsHash":"some-hash"}`)})).To(Succeed())
+		})
+
+		It("writes each detail as a secret of the KV engine", func() {
+			Expect(vault.secrets).To(HaveKey("some-prefix/some-store-id/instances/instance-1"))
+			Expect(vault.secrets["some-prefix/some-store-id/instances/instance-1"]).To(MatchJSON(`{"service_id":"some-service","plan_id":"","organization_guid":"some-org","space_guid":"","ServiceFingerPrint":null}`))
+			Expect(vault.secrets).To(HaveKey("some-prefix/some-store-id/bindings/binding-1"))
+		})
+
+		It("deletes every version of a detail", func() {
+			Expect(store.DeleteInstanceDetails("instance-1")).To(Succeed())
+			Expect(vault.secrets).NotTo(HaveKey("some-prefix/some-store-id/instances/instance-1"))
+		})
+
+		Context("when Vault cannot be reached", func() {
+			BeforeEach(func() {
+				server.Close()
+			})
+
+			It("returns the error rather than taking the details for absent", func() {
+				_, err := store.CompareInstanceDetails("instance-1", brokerstore.ServiceInstance{ServiceID: "some-service"})
+				Expect(err).To(HaveOccurred())
+				Expect(store.IsInstanceConflict("instance-1", brokerstore.ServiceInstance{ServiceID: "some-service"})).To(BeTrue())
+			})
+		})
+	})
+
+	It("keeps the markers as secrets", func() {
+		Expect(store.Activate()).To(Succeed())
+		Expect(store.Retire()).To(Succeed())
+		Expect(vault.secrets).To(HaveKey("some-prefix/some-store-id/migrated-from-another-store"))
+		Expect(vault.secrets).To(HaveKey("some-prefix/some-store-id/migrated-to-another-store"))
+	})
+
+	Context("when the token is not accepted", func() {
+		BeforeEach(func() {
+			var err error
+			client, err = vaultstore.NewClient(server.URL, "", "secret", vaultstore.Auth{Token: "other-token"})
+			Expect(err).NotTo(HaveOccurred())
+			store = vaultstore.NewStore(lagertest.NewTestLogger("vaultstore-test"), client, "some-prefix", "some-store-id")
+		})
+
+		It("returns the error of Vault", func() {
+			_, err := store.IsActivated()
+			Expect(err).To(MatchError("vault returned status 403: permission denied"))
+
+			err = store.CreateInstanceDetails("123", brokerstore.ServiceInstance{})
+			Expect(err).To(BeAssignableToTypeOf(&vaultstore.Error{}))
+			Expect(err.(*vaultstore.Error).StatusCode).To(Equal(http.StatusForbidden))
+		})
+	})
+
+	Describe("AppRole login", func() {
+		BeforeEach(func() {
+			vault.roleID = "some-role-id"
+			vault.secretID = "some-secret-id"
+		})
+
+		It("logs in with the role and uses the token it is given", func() {
+			client, err := vaultstore.NewClient(server.URL, "", "secret", vaultstore.Auth{RoleID: "some-role-id", SecretID: "some-secret-id"})
+			Expect(err).NotTo(HaveOccurred())
+
+			store = vaultstore.NewStore(lagertest.NewTestLogger("vaultstore-test"), client, "", "some-store-id")
+			Expect(store.Activate()).To(Succeed())
+			Expect(vault.secrets).To(HaveKey("some-store-id/migrated-from-another-store"))
+		})
+
+		It("fails when the secret ID is wrong", func() {
+			_, err := vaultstore.NewClient(server.URL, "", "secret", vaultstore.Auth{RoleID: "some-role-id", SecretID: "other-secret-id"})
+			Expect(err).To(MatchError("vault returned status 400: invalid role or secret ID"))
+		})
+
+		It("fails when neither a token nor a role is given", func() {
+			_, err := vaultstore.NewClient(server.URL, "", "secret", vaultstore.Auth{})
+			Expect(err).To(MatchError("a Vault token, or an AppRole role ID and secret ID, must be given"))
+		})
+	})
+})
+
+// fakeVault serves the parts of the Vault HTTP API used by the store: the
+// data and metadata endpoints of a KV version 2 engine mounted at secret,
+// and AppRole login.
+type fakeVault struct {
+	mutex    sync.Mutex
+	token    string
+	roleID   string
+	secretID string
+	secrets  map[string]json.RawMessage
+}
+
+func newFakeVault(token string) *fakeVault {
+	return &fakeVault{token: token, secrets: map[string]json.RawMessage{}}
+}
+
+func (v *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	body, _ := ioutil.ReadAll(r.Body)
+	path := strings.TrimPrefix(r.URL.Path, "/v1/")
+
+	if path == "auth/approle/login" && r.Method == "POST" {
+		var login struct {
+			RoleID   string `json:"role_id"`
+			SecretID string `json:"secret_id"`
+		}
+		json.Unmarshal(body, &login)
+		if v.roleID == "" || login.RoleID != v.roleID || login.SecretID != v.secretID {
+			respond(w, http.StatusBadRequest, map[string]interface{}{"errors": []string{"invalid role or secret ID"}})
+			return
+		}
+		respond(w, http.StatusOK, map[string]interface{}{"auth": map[string]string{"client_token": v.token}})
+		return
+	}
+
+	if r.Header.Get("X-Vault-Token") != v.token {
+		respond(w, http.StatusForbidden, map[string]interface{}{"errors": []string{"permission denied"}})
+		return
+	}
+
+	switch {
+	case strings.HasPrefix(path, "secret/data/"):
+		name := strings.TrimPrefix(path, "secret/data/")
+		switch r.Method {
+		case "GET":
+			data, ok := v.secrets[name]
+			if !ok {
+				respond(w, http.StatusNotFound, map[string]interface{}{"errors": []string{}})
+				return
+			}
+			respond(w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{"data": data}})
+		case "POST", "PUT":
+			var secret struct {
+				Data json.RawMessage `json:"data"`
+			}
+			json.Unmarshal(body, &secret)
+			v.secrets[name] = secret.Data
+			respond(w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{"version": 1}})
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	case strings.HasPrefix(path, "secret/metadata/"):
+		name := strings.TrimPrefix(path, "secret/metadata/")
+		switch r.Method {
+		case "LIST":
+			keys := v.list(name)
+			if len(keys) == 0 {
+				respond(w, http.StatusNotFound, map[string]interface{}{"errors": []string{}})
+				return
+			}
+			respond(w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{"keys": keys}})
+		case "DELETE":
+			delete(v.secrets, name)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	default:
+		respond(w, http.StatusNotFound, map[string]interface{}{"errors": []string{"no handler for route"}})
+	}
+}
+
+func (v *fakeVault) list(folder string) []string {
+	seen := map[string]bool{}
+	for name := range v.secrets {
+		if !strings.HasPrefix(name, folder+"/") {
+			continue
+		}
+		key := strings.TrimPrefix(name, folder+"/")
+		if i := strings.Index(key, "/"); i >= 0 {
+			key = key[:i+1]
+		}
+		seen[key] = true
+	}
+
+	keys := []string{}
+	for key := range seen {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func respond(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
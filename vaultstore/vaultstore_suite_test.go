@@ -0,0 +1,13 @@
+package vaultstore_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestVaultstore(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Vaultstore Suite")
+}